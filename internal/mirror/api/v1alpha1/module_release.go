@@ -0,0 +1,54 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var ModuleReleaseGVR = schema.GroupVersionResource{
+	Group:    "deckhouse.io",
+	Version:  "v1alpha1",
+	Resource: "modulereleases",
+}
+
+// ModuleRelease is a release of the module from the ModuleSource.
+type ModuleRelease struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ModuleReleaseSpec `json:"spec"`
+}
+
+type ModuleReleaseSpec struct {
+	ModuleName   string                     `json:"moduleName"`
+	Version      string                     `json:"version"`
+	Requirements *ModuleReleaseRequirements `json:"requirements,omitempty"`
+	Disruptions  []string                   `json:"disruptions,omitempty"`
+	Changelog    map[string]interface{}     `json:"changelog,omitempty"`
+}
+
+// ModuleReleaseRequirements are the versions of Deckhouse, Kubernetes and other modules the release can be deployed with.
+type ModuleReleaseRequirements struct {
+	Deckhouse  string            `json:"deckhouse,omitempty"`
+	Kubernetes string            `json:"kubernetes,omitempty"`
+	Modules    map[string]string `json:"modules,omitempty"`
+}
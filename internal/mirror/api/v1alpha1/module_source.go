@@ -20,8 +20,15 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+var ModuleSourceGVR = schema.GroupVersionResource{
+	Group:    "deckhouse.io",
+	Version:  "v1alpha1",
+	Resource: "modulesources",
+}
+
 type ModuleSource struct {
 	metav1.TypeMeta `json:",inline"`
 	// Standard object's metadata.
@@ -33,19 +40,19 @@ type ModuleSource struct {
 	Spec ModuleSourceSpec `json:"spec"`
 
 	// Status of an ModuleSource.
-	Status ModuleSourceStatus `json:"status,omitempty"`
+	Status *ModuleSourceStatus `json:"status,omitempty"`
 }
 
 type ModuleSourceSpec struct {
 	Registry       ModuleSourceSpecRegistry `json:"registry"`
-	ReleaseChannel string                   `json:"releaseChannel"`
+	ReleaseChannel string                   `json:"releaseChannel,omitempty"`
 }
 
 type ModuleSourceSpecRegistry struct {
 	Scheme    string `json:"scheme,omitempty"`
 	Repo      string `json:"repo"`
 	DockerCFG string `json:"dockerCfg"`
-	CA        string `json:"ca"`
+	CA        string `json:"ca,omitempty"`
 }
 
 type ModuleSourceStatus struct {
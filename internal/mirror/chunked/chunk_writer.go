@@ -18,24 +18,40 @@ package chunked
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"path/filepath"
+	"hash"
+	"io"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
 )
 
+// FileWriter splits the data written to it into chunk files of at most chunkSize bytes.
+// Chunk index file with the order, sizes and checksums of all chunks is written on Close.
 type FileWriter struct {
 	chunkSize  int64
 	chunkIndex int
 
-	workingDir   string
-	baseFileName string
-	activeChunk  *os.File
+	storage         storage.Storage
+	baseFileName    string
+	activeChunk     io.WriteCloser
+	activeChunkName string
+	activeChunkSize int64
+	activeChunkHash hash.Hash
+	writtenChunks   []IndexEntry
 }
 
 func NewChunkedFileWriter(chunkSize int64, dirPath, baseFileName string) *FileWriter {
+	return NewStorageWriter(chunkSize, storage.NewLocal(dirPath), baseFileName)
+}
+
+// NewStorageWriter creates FileWriter that writes chunks and their index into the storage.
+// Every chunk is stored as soon as it is filled, so uploading to the remote storage goes along with writing the data.
+func NewStorageWriter(chunkSize int64, storage storage.Storage, baseFileName string) *FileWriter {
 	return &FileWriter{
 		chunkSize:    chunkSize,
-		workingDir:   filepath.Clean(dirPath),
+		storage:      storage,
 		baseFileName: baseFileName,
 	}
 }
@@ -51,44 +67,40 @@ func (c *FileWriter) Write(p []byte) (int, error) {
 		}
 	}
 
-	chunkStat, err := c.activeChunk.Stat()
-	if err != nil {
-		return 0, fmt.Errorf("Read chunk size: %w", err)
-	}
-
 	buf := bytes.NewBuffer(p)
 	bytesWritten := 0
 	for {
-		for c.chunkSize-chunkStat.Size() > 0 {
+		for c.chunkSize-c.activeChunkSize > 0 {
 			s := buf.Next(512 * 1024)
 			if len(s) == 0 {
 				return bytesWritten, nil
 			}
 
 			written, err := c.activeChunk.Write(s)
+			c.activeChunkHash.Write(s[:written])
+			c.activeChunkSize += int64(written)
 			bytesWritten += written
 			if err != nil {
 				return 0, fmt.Errorf("Write to chunk: %w", err)
 			}
-
-			chunkStat, err = c.activeChunk.Stat()
-			if err != nil {
-				return 0, fmt.Errorf("Read chunk size: %w", err)
-			}
 		}
 
-		if err = c.swapActiveChunk(); err != nil {
+		if err := c.swapActiveChunk(); err != nil {
 			return 0, fmt.Errorf("Swap active chunk: %w", err)
 		}
-		chunkStat, err = c.activeChunk.Stat()
-		if err != nil {
-			return 0, fmt.Errorf("Read chunk size: %w", err)
-		}
 	}
 }
 
 func (c *FileWriter) Close() error {
-	return c.closeActiveChunk()
+	if err := c.closeActiveChunk(); err != nil {
+		return err
+	}
+
+	index := &Index{BaseFileName: c.baseFileName, Chunks: c.writtenChunks}
+	if err := index.Write(c.storage); err != nil {
+		return fmt.Errorf("Write chunks index: %w", err)
+	}
+	return nil
 }
 
 func (c *FileWriter) swapActiveChunk() error {
@@ -99,23 +111,33 @@ func (c *FileWriter) swapActiveChunk() error {
 		c.chunkIndex += 1
 	}
 
-	newChunk, err := os.Create(filepath.Join(c.workingDir, fmt.Sprintf("%s.%04d.chunk", c.baseFileName, c.chunkIndex)))
+	chunkName := chunkFileName(c.baseFileName, c.chunkIndex)
+	newChunk, err := c.storage.Create(chunkName)
 	if err != nil {
 		return fmt.Errorf("Create new chunk file: %w", err)
 	}
 
 	c.activeChunk = newChunk
+	c.activeChunkName = chunkName
+	c.activeChunkSize = 0
+	c.activeChunkHash = sha256.New()
 	return nil
 }
 
 func (c *FileWriter) closeActiveChunk() error {
-	if c.activeChunk != nil {
-		if err := c.activeChunk.Sync(); err != nil {
-			return fmt.Errorf("Flush chunk: %w", err)
-		}
-		if err := c.activeChunk.Close(); err != nil {
-			return fmt.Errorf("Close chunk: %w", err)
-		}
+	if c.activeChunk == nil {
+		return nil
 	}
+
+	if err := c.activeChunk.Close(); err != nil {
+		return fmt.Errorf("Close chunk: %w", err)
+	}
+
+	c.writtenChunks = append(c.writtenChunks, IndexEntry{
+		Name:   c.activeChunkName,
+		Size:   c.activeChunkSize,
+		SHA256: hex.EncodeToString(c.activeChunkHash.Sum(nil)),
+	})
+	c.activeChunk = nil
 	return nil
 }
@@ -0,0 +1,27 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chunked
+
+import "regexp"
+
+var chunkSuffixRegex = regexp.MustCompile(`\.\d{4}\.chunk$`)
+
+// TrimChunkSuffix returns the base bundle file path for the path of one of its chunks.
+// Paths that do not point to a chunk are returned as is.
+func TrimChunkSuffix(chunkPath string) string {
+	return chunkSuffixRegex.ReplaceAllString(chunkPath, "")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chunked
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
+)
+
+// IndexFileSuffix is appended to the base file name of the chunked file to get the name of its chunks index.
+const IndexFileSuffix = ".chunks.json"
+
+// Index lists chunks of the file in the order they should be joined together.
+type Index struct {
+	BaseFileName string       `json:"baseFileName"`
+	Chunks       []IndexEntry `json:"chunks"`
+}
+
+type IndexEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// IndexFilePath returns the path to chunks index of the baseFileName in dirPath.
+func IndexFilePath(dirPath, baseFileName string) string {
+	return filepath.Join(dirPath, baseFileName+IndexFileSuffix)
+}
+
+// ReadIndex reads chunks index of the baseFileName in dirPath.
+// Error wrapping fs.ErrNotExist is returned if there is no index, like for the files that were chunked by older versions of d8.
+func ReadIndex(dirPath, baseFileName string) (*Index, error) {
+	return ReadStorageIndex(storage.NewLocal(dirPath), baseFileName)
+}
+
+// ReadStorageIndex reads chunks index of the baseFileName in the storage.
+func ReadStorageIndex(storage storage.Storage, baseFileName string) (*Index, error) {
+	indexFile, err := storage.Open(baseFileName + IndexFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer indexFile.Close()
+
+	rawIndex, err := io.ReadAll(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("read chunks index: %w", err)
+	}
+
+	index := &Index{}
+	if err = json.Unmarshal(rawIndex, index); err != nil {
+		return nil, fmt.Errorf("parse chunks index: %w", err)
+	}
+	return index, nil
+}
+
+func (idx *Index) Write(st storage.Storage) error {
+	rawIndex, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(st, idx.BaseFileName+IndexFileSuffix, bytes.NewReader(rawIndex))
+}
+
+// Validate checks that every chunk from the index is present in the storage and has the expected size,
+// and that there are no other chunks of the file, like the ones left from the earlier larger file.
+// Checksums are not verified here as it requires reading all the chunks, Reader does it while streaming the data.
+func (idx *Index) Validate(storage storage.Storage) error {
+	indexed := make(map[string]struct{}, len(idx.Chunks))
+	for _, chunk := range idx.Chunks {
+		indexed[chunk.Name] = struct{}{}
+		stat, err := storage.Stat(chunk.Name)
+		if err != nil {
+			return fmt.Errorf("chunk %s is missing: %w", chunk.Name, err)
+		}
+		if stat.Size != chunk.Size {
+			return fmt.Errorf("chunk %s is damaged: expected size is %d bytes, got %d bytes", chunk.Name, chunk.Size, stat.Size)
+		}
+	}
+
+	files, err := storage.List()
+	if err != nil {
+		return fmt.Errorf("read chunks directory: %w", err)
+	}
+	for _, file := range files {
+		if !chunkSuffixRegex.MatchString(file.Name) || TrimChunkSuffix(file.Name) != idx.BaseFileName {
+			continue
+		}
+		if _, found := indexed[file.Name]; !found {
+			return fmt.Errorf("chunk %s is not listed in chunks index, remove chunks left from the other file", file.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chunked
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"slices"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
+)
+
+// Reader joins chunks of the file back together, verifying checksums of every chunk as it is read.
+type Reader struct {
+	storage storage.Storage
+	chunks  []IndexEntry
+
+	activeChunk     io.ReadCloser
+	activeChunkHash hash.Hash
+	activeIdx       int
+}
+
+// NewReader opens chunks of the baseFileName in dirPath for reading.
+// Chunks are read in the order returned by ListChunks, checksums of chunks are verified as they are read.
+func NewReader(dirPath, baseFileName string) (*Reader, error) {
+	return NewStorageReader(storage.NewLocal(dirPath), baseFileName)
+}
+
+// NewStorageReader opens chunks of the baseFileName in the storage for reading.
+func NewStorageReader(storage storage.Storage, baseFileName string) (*Reader, error) {
+	chunks, err := ListStorageChunks(storage, baseFileName)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{storage: storage, chunks: chunks, activeIdx: -1}, nil
+}
+
+// ListChunks returns chunks of the baseFileName in dirPath in the order they should be joined together.
+// Chunks are listed in the order recorded in chunks index, presence and sizes of all of them are validated.
+// For files chunked without an index chunks are listed in the order of their numbers, gaps in numbering are reported as missing chunks.
+// Error wrapping fs.ErrNotExist is returned if no chunks are found.
+func ListChunks(dirPath, baseFileName string) ([]IndexEntry, error) {
+	return ListStorageChunks(storage.NewLocal(dirPath), baseFileName)
+}
+
+// ListStorageChunks returns chunks of the baseFileName in the storage in the order they should be joined together.
+func ListStorageChunks(storage storage.Storage, baseFileName string) ([]IndexEntry, error) {
+	index, err := ReadStorageIndex(storage, baseFileName)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		index, err = indexFromChunkNames(storage, baseFileName)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	if len(index.Chunks) == 0 {
+		return nil, fmt.Errorf("no chunks of %s found: %w", baseFileName, fs.ErrNotExist)
+	}
+	if err = index.Validate(storage); err != nil {
+		return nil, err
+	}
+	return index.Chunks, nil
+}
+
+// indexFromChunkNames builds index without checksums out of the chunk files found in the storage.
+func indexFromChunkNames(storage storage.Storage, baseFileName string) (*Index, error) {
+	files, err := storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("read chunks directory: %w", err)
+	}
+
+	chunks := make([]IndexEntry, 0)
+	for _, file := range files {
+		if chunkSuffixRegex.MatchString(file.Name) && TrimChunkSuffix(file.Name) == baseFileName {
+			chunks = append(chunks, IndexEntry{Name: file.Name, Size: file.Size})
+		}
+	}
+	slices.SortFunc(chunks, func(a, b IndexEntry) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	for i, chunk := range chunks {
+		if expectedName := chunkFileName(baseFileName, i); chunk.Name != expectedName {
+			return nil, fmt.Errorf("chunk %s is missing", expectedName)
+		}
+	}
+	return &Index{BaseFileName: baseFileName, Chunks: chunks}, nil
+}
+
+func chunkFileName(baseFileName string, chunkIndex int) string {
+	return fmt.Sprintf("%s.%04d.chunk", baseFileName, chunkIndex)
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for {
+		if r.activeChunk == nil {
+			if r.activeIdx+1 >= len(r.chunks) {
+				return 0, io.EOF
+			}
+			if err := r.openNextChunk(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.activeChunk.Read(p)
+		r.activeChunkHash.Write(p[:n])
+		if errors.Is(err, io.EOF) {
+			if err = r.finishActiveChunk(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (r *Reader) Close() error {
+	if r.activeChunk == nil {
+		return nil
+	}
+	err := r.activeChunk.Close()
+	r.activeChunk = nil
+	return err
+}
+
+func (r *Reader) openNextChunk() error {
+	r.activeIdx++
+	chunk := r.chunks[r.activeIdx]
+	chunkFile, err := r.storage.Open(chunk.Name)
+	if err != nil {
+		return fmt.Errorf("chunk %s is missing: %w", chunk.Name, err)
+	}
+	r.activeChunk = chunkFile
+	r.activeChunkHash = sha256.New()
+	return nil
+}
+
+func (r *Reader) finishActiveChunk() error {
+	chunk := r.chunks[r.activeIdx]
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	if chunk.SHA256 == "" {
+		return nil
+	}
+	if sum := hex.EncodeToString(r.activeChunkHash.Sum(nil)); sum != chunk.SHA256 {
+		return fmt.Errorf("chunk %s is damaged: expected sha256 checksum %s, got %s, transfer this chunk again", chunk.Name, chunk.SHA256, sum)
+	}
+	return nil
+}
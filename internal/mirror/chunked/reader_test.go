@@ -0,0 +1,101 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chunked
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderJoinsChunksInIndexOrder(t *testing.T) {
+	workingDir, sourceFile := writeChunkedTestFile(t)
+
+	r, err := NewReader(workingDir, "d8.tar")
+	require.NoError(t, err)
+	gotFile, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.True(t, bytes.Equal(sourceFile, gotFile), "Joined chunks should be equal to the source file")
+}
+
+func TestReaderReportsStrayChunk(t *testing.T) {
+	workingDir, _ := writeChunkedTestFile(t)
+
+	// Chunk left from the earlier larger bundle with the same name would be joined if index is lost, so it is an error.
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "d8.tar.0042.chunk"), []byte("garbage"), 0o666))
+
+	_, err := NewReader(workingDir, "d8.tar")
+	require.ErrorContains(t, err, "chunk d8.tar.0042.chunk is not listed in chunks index")
+}
+
+func TestReaderReportsMissingChunk(t *testing.T) {
+	workingDir, _ := writeChunkedTestFile(t)
+	require.NoError(t, os.Remove(filepath.Join(workingDir, "d8.tar.0001.chunk")))
+
+	_, err := NewReader(workingDir, "d8.tar")
+	require.ErrorContains(t, err, "chunk d8.tar.0001.chunk is missing")
+
+	// Same should be detected for chunks written by older versions without an index
+	require.NoError(t, os.Remove(IndexFilePath(workingDir, "d8.tar")))
+	_, err = NewReader(workingDir, "d8.tar")
+	require.ErrorContains(t, err, "chunk d8.tar.0001.chunk is missing")
+}
+
+func TestReaderReportsDamagedChunk(t *testing.T) {
+	workingDir, _ := writeChunkedTestFile(t)
+
+	chunkPath := filepath.Join(workingDir, "d8.tar.0002.chunk")
+	chunk, err := os.ReadFile(chunkPath)
+	require.NoError(t, err)
+	chunk[len(chunk)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(chunkPath, chunk, 0o666))
+
+	r, err := NewReader(workingDir, "d8.tar")
+	require.NoError(t, err, "Damaged chunk has the right size, so it can only be detected while reading")
+	_, err = io.Copy(io.Discard, r)
+	require.ErrorContains(t, err, "chunk d8.tar.0002.chunk is damaged")
+
+	require.NoError(t, os.WriteFile(chunkPath, chunk[:100], 0o666))
+	_, err = NewReader(workingDir, "d8.tar")
+	require.ErrorContains(t, err, "chunk d8.tar.0002.chunk is damaged")
+}
+
+func writeChunkedTestFile(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	const testDatasetSize, chunkSize = 10 * 1024 * 1024, 3 * 1024 * 1024
+	workingDir := t.TempDir()
+	sourceFile := make([]byte, testDatasetSize)
+	_, err := rand.Read(sourceFile)
+	require.NoError(t, err)
+
+	w := NewChunkedFileWriter(chunkSize, workingDir, "d8.tar")
+	_, err = io.CopyBuffer(w, bytes.NewReader(sourceFile), make([]byte, 512*1024))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	index, err := ReadIndex(workingDir, "d8.tar")
+	require.NoError(t, err)
+	require.Len(t, index.Chunks, 4)
+	return workingDir, sourceFile
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/bundle/merge"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/bundle/split"
+)
+
+var bundleLong = templates.LongDesc(`
+Combine Deckhouse Kubernetes Platform distribution bundles together or extract parts of them into new bundles.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a 
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:           "bundle",
+		Short:         "Combine Deckhouse Kubernetes Platform distribution bundles or extract parts of them",
+		Long:          bundleLong,
+		SilenceErrors: true,
+	}
+
+	bundleCmd.AddCommand(
+		merge.NewCommand(),
+		split.NewCommand(),
+	)
+
+	return bundleCmd
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package merge
+
+import (
+	"github.com/spf13/pflag"
+)
+
+func addFlags(flagSet *pflag.FlagSet) {
+	flagSet.Int64VarP(
+		&ImagesBundleChunkSizeGB,
+		"images-bundle-chunk-size",
+		"c",
+		0,
+		"Split resulting bundle file into chunks of at most N gigabytes",
+	)
+	flagSet.StringVar(
+		&BundleCompression,
+		"bundle-compression",
+		"",
+		"Compress resulting bundle tar stream, one of: gzip, zstd. Bundle is not compressed by default.",
+	)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package merge
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var mergeLong = templates.LongDesc(`
+Merge several Deckhouse Kubernetes Platform distribution bundles into one.
+
+Sources may be bundles created with "d8 mirror pull", directories with modules created
+with "d8 mirror modules pull" and directories with vulnerability databases created
+with "d8 mirror vulndb pull". Each source may be a tar archive, chunked tar archive or unpacked directory.
+Images that are shared between layouts are stored in the resulting bundle only once.
+If the same image reference is found in several sources, the image from the latter one is used.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a 
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	mergeCmd := &cobra.Command{
+		Use:           "merge <images-bundle-path> <source-path>...",
+		Short:         "Merge several Deckhouse Kubernetes Platform distribution bundles into one",
+		Long:          mergeLong,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          merge,
+		PostRunE: func(_ *cobra.Command, _ []string) error {
+			return os.RemoveAll(TempDir)
+		},
+	}
+
+	addFlags(mergeCmd.Flags())
+	return mergeCmd
+}
+
+var (
+	TempDir = filepath.Join(os.TempDir(), "mirror", "merge")
+
+	ImagesBundlePath        string
+	ImagesBundleChunkSizeGB int64
+	BundleCompression       string
+	SourcePaths             []string
+)
+
+func merge(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+	logger := log.NewSLogger(logLevel)
+
+	if err := os.RemoveAll(TempDir); err != nil {
+		return fmt.Errorf("Cleanup temporary data: %w", err)
+	}
+
+	err := logger.Process("Merge bundles", func() error {
+		return bundle.Merge(logger, TempDir, SourcePaths...)
+	})
+	if err != nil {
+		return err
+	}
+
+	return logger.Process("Pack images", func() error {
+		return bundle.Pack(&contexts.PullContext{
+			BaseContext: contexts.BaseContext{
+				Logger:             logger,
+				BundlePath:         ImagesBundlePath,
+				UnpackedImagesPath: TempDir,
+			},
+			BundleChunkSize:   ImagesBundleChunkSizeGB * 1000 * 1000 * 1000,
+			BundleCompression: BundleCompression,
+		})
+	})
+}
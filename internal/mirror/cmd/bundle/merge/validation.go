@@ -0,0 +1,60 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+)
+
+func parseAndValidateParameters(_ *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return errors.New("expected resulting bundle path and at least one source path")
+	}
+
+	ImagesBundlePath = filepath.Clean(args[0])
+	if filepath.Ext(ImagesBundlePath) != ".tar" {
+		return errors.New("images-bundle-path argument should be a path to tar archive (.tar)")
+	}
+	if _, err := os.Stat(filepath.Dir(ImagesBundlePath)); err != nil {
+		return err
+	}
+
+	SourcePaths = make([]string, 0, len(args)-1)
+	for _, sourcePath := range args[1:] {
+		sourcePath = filepath.Clean(sourcePath)
+		if sourcePath == ImagesBundlePath {
+			return fmt.Errorf("%s is used both as a source and as a resulting bundle", sourcePath)
+		}
+		SourcePaths = append(SourcePaths, sourcePath)
+	}
+
+	if ImagesBundleChunkSizeGB < 0 {
+		return errors.New("Chunk size cannot be less than zero GB")
+	}
+	if !bundle.IsSupportedCompression(BundleCompression) {
+		return fmt.Errorf("unknown bundle compression %q, expected one of: gzip, zstd", BundleCompression)
+	}
+
+	return nil
+}
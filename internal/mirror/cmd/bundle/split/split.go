@@ -0,0 +1,111 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package split
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var splitLong = templates.LongDesc(`
+Extract a subset of Deckhouse Kubernetes Platform distribution bundle into a new bundle.
+
+Releases selected with --release are copied along with images of all Deckhouse components
+they consist of, release channels pointing to them and vulnerability databases.
+Modules selected with --module are copied with all their versions.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a 
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	splitCmd := &cobra.Command{
+		Use:           "split <source-bundle-path> <images-bundle-path>",
+		Short:         "Extract a subset of Deckhouse Kubernetes Platform distribution bundle into a new bundle",
+		Long:          splitLong,
+		ValidArgs:     []string{"source-bundle-path", "images-bundle-path"},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          split,
+		PostRunE: func(_ *cobra.Command, _ []string) error {
+			return os.RemoveAll(TempDir)
+		},
+	}
+
+	addFlags(splitCmd.Flags())
+	return splitCmd
+}
+
+var (
+	TempDir = filepath.Join(os.TempDir(), "mirror", "split")
+
+	SourceBundlePath        string
+	ImagesBundlePath        string
+	ImagesBundleChunkSizeGB int64
+	BundleCompression       string
+
+	releaseStrings []string
+	Releases       []*semver.Version
+	Modules        []string
+)
+
+func split(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+	logger := log.NewSLogger(logLevel)
+
+	if err := os.RemoveAll(TempDir); err != nil {
+		return fmt.Errorf("Cleanup temporary data: %w", err)
+	}
+
+	err := logger.Process("Extract images", func() error {
+		return bundle.Split(SourceBundlePath, TempDir, bundle.SplitOptions{
+			Versions: Releases,
+			Modules:  Modules,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return logger.Process("Pack images", func() error {
+		return bundle.Pack(&contexts.PullContext{
+			BaseContext: contexts.BaseContext{
+				Logger:             logger,
+				BundlePath:         ImagesBundlePath,
+				UnpackedImagesPath: TempDir,
+			},
+			BundleChunkSize:   ImagesBundleChunkSizeGB * 1000 * 1000 * 1000,
+			BundleCompression: BundleCompression,
+		})
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package split
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+)
+
+func parseAndValidateParameters(_ *cobra.Command, args []string) error {
+	if l := len(args); l != 2 {
+		return fmt.Errorf("accepts 2 arguments, received %d", l)
+	}
+
+	SourceBundlePath = filepath.Clean(args[0])
+	ImagesBundlePath = filepath.Clean(args[1])
+	if filepath.Ext(ImagesBundlePath) != ".tar" {
+		return errors.New("images-bundle-path argument should be a path to tar archive (.tar)")
+	}
+	if _, err := os.Stat(filepath.Dir(ImagesBundlePath)); err != nil {
+		return err
+	}
+	if SourceBundlePath == ImagesBundlePath {
+		return errors.New("resulting bundle cannot overwrite the source bundle")
+	}
+
+	if len(releaseStrings) == 0 && len(Modules) == 0 {
+		return errors.New("Nothing to extract, at least one --release or --module should be specified")
+	}
+	Releases = make([]*semver.Version, 0, len(releaseStrings))
+	for _, releaseString := range releaseStrings {
+		release, err := semver.NewVersion(releaseString)
+		if err != nil {
+			return fmt.Errorf("Parse release version %q: %w", releaseString, err)
+		}
+		Releases = append(Releases, release)
+	}
+
+	if ImagesBundleChunkSizeGB < 0 {
+		return errors.New("Chunk size cannot be less than zero GB")
+	}
+	if !bundle.IsSupportedCompression(BundleCompression) {
+		return fmt.Errorf("unknown bundle compression %q, expected one of: gzip, zstd", BundleCompression)
+	}
+
+	return nil
+}
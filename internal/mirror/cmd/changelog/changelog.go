@@ -0,0 +1,93 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+)
+
+var changelogLong = templates.LongDesc(`
+Show the changelog of the Deckhouse Kubernetes Platform releases stored in the bundle.
+
+This command combines changelogs from release-channel images of the bundle for the Deckhouse versions
+between --from and --to, along with changelogs of all module versions in the bundle.
+Disruptions and requirements of each release are shown ahead of its changes,
+so the update could be reviewed before the bundle is imported.
+
+Changelog is rendered as Markdown, or as JSON with --output json.
+
+Bundle may be passed as a tar archive, chunked tar archive or unpacked directory.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	changelogCmd := &cobra.Command{
+		Use:           "changelog <images-bundle-path>",
+		Short:         "Show the changelog of the Deckhouse Kubernetes Platform releases stored in the bundle",
+		Long:          changelogLong,
+		ValidArgs:     []string{"images-bundle-path"},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          changelog,
+	}
+
+	addFlags(changelogCmd.Flags())
+	return changelogCmd
+}
+
+var (
+	BundlePath   string
+	FromVersion  string
+	ToVersion    string
+	OutputFormat string
+
+	versionsRange *semver.Constraints
+)
+
+func changelog(_ *cobra.Command, _ []string) error {
+	bundleFS, err := bundle.OpenFS(BundlePath)
+	if err != nil {
+		return fmt.Errorf("Open %s: %w", BundlePath, err)
+	}
+	defer bundleFS.Close()
+
+	releasesChangelog, err := bundle.ReadChangelog(bundleFS, versionsRange)
+	if err != nil {
+		return fmt.Errorf("Read changelog: %w", err)
+	}
+
+	if OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(releasesChangelog)
+	}
+
+	return releasesChangelog.WriteMarkdown(os.Stdout)
+}
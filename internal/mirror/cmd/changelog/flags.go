@@ -0,0 +1,43 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package changelog
+
+import (
+	"github.com/spf13/pflag"
+)
+
+func addFlags(flagSet *pflag.FlagSet) {
+	flagSet.StringVar(
+		&FromVersion,
+		"from",
+		"",
+		"The lowest Deckhouse version to include, like v1.60. All patch releases of the minor version are included if the patch is omitted.",
+	)
+	flagSet.StringVar(
+		&ToVersion,
+		"to",
+		"",
+		"The highest Deckhouse version to include, like v1.63. All patch releases of the minor version are included if the patch is omitted.",
+	)
+	flagSet.StringVarP(
+		&OutputFormat,
+		"output",
+		"o",
+		"markdown",
+		"Output format, one of: markdown, json.",
+	)
+}
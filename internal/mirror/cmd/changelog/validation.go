@@ -0,0 +1,66 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package changelog
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+func parseAndValidateParameters(_ *cobra.Command, args []string) error {
+	if l := len(args); l != 1 {
+		return fmt.Errorf("accepts 1 argument, received %d", l)
+	}
+
+	BundlePath = filepath.Clean(args[0])
+
+	if OutputFormat != "markdown" && OutputFormat != "json" {
+		return fmt.Errorf("unknown output format %q, expected one of: markdown, json", OutputFormat)
+	}
+
+	return parseVersionsRange()
+}
+
+func parseVersionsRange() error {
+	bounds := make([]string, 0, 2)
+	if FromVersion != "" {
+		if _, err := semver.NewVersion(FromVersion); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+		bounds = append(bounds, ">= "+FromVersion)
+	}
+	if ToVersion != "" {
+		if _, err := semver.NewVersion(ToVersion); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+		bounds = append(bounds, "<= "+ToVersion)
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+
+	var err error
+	versionsRange, err = semver.NewConstraint(strings.Join(bounds, ", "))
+	if err != nil {
+		return fmt.Errorf("invalid versions range: %w", err)
+	}
+	return nil
+}
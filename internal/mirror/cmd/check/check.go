@@ -0,0 +1,165 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/check"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var checkLong = templates.LongDesc(`
+Check that the registry holds complete Deckhouse Kubernetes Platform distribution.
+
+This command walks Deckhouse repositories in the registry: root, install, install-standalone, release-channel,
+security databases and modules with their releases. Every image is checked to have its manifest and all of its blobs.
+
+If the bundle is passed with --bundle, every image from it must be found in the registry
+under the same tag and digest. Tags pointing to different images are reported as drift.
+If the bundle was pushed with --rewrite-rules or --extra-images-repo, pass the same flags here,
+so that images are looked up in the repositories they were pushed to.
+
+Images left in the registry by the write access check of older d8 versions (d8WriteCheck tags) are reported as well.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	checkCmd := &cobra.Command{
+		Use:           "check",
+		Short:         "Check that the registry holds complete Deckhouse Kubernetes Platform distribution",
+		Long:          checkLong,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          checkRegistry,
+	}
+
+	addFlags(checkCmd.Flags())
+	return checkCmd
+}
+
+var (
+	RegistryRepo     string
+	RegistryHost     string
+	RegistryPath     string
+	RegistryUsername string
+	RegistryPassword string
+
+	Insecure      bool
+	TLSSkipVerify bool
+
+	BundlePath   string
+	OutputFormat string
+
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
+	RewriteRulesPath string
+	rewriteRules     *rewrite.Rules
+	ExtraImagesRepo  string
+)
+
+func checkRegistry(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+
+	mirrorCtx := &contexts.BaseContext{
+		Logger:              log.NewSLogger(logLevel),
+		RegistryAuth:        authn.Anonymous,
+		RegistryHost:        RegistryHost,
+		RegistryPath:        RegistryPath,
+		Insecure:            Insecure,
+		SkipTLSVerification: TLSSkipVerify,
+		SecurityArtifacts:   securityArtifacts,
+	}
+	if RegistryUsername != "" {
+		mirrorCtx.RegistryAuth = authn.FromConfig(authn.AuthConfig{
+			Username: RegistryUsername,
+			Password: RegistryPassword,
+		})
+	}
+
+	var bundleFS *bundle.FS
+	if BundlePath != "" {
+		var err error
+		bundleFS, err = bundle.OpenFS(BundlePath)
+		if err != nil {
+			return fmt.Errorf("Open %s: %w", BundlePath, err)
+		}
+		defer bundleFS.Close()
+	}
+
+	report, err := check.Registry(context.Background(), mirrorCtx, bundleFS, check.Options{
+		RewriteRules:    rewriteRules,
+		ExtraImagesRepo: ExtraImagesRepo,
+	})
+	if err != nil {
+		return fmt.Errorf("Check registry: %w", err)
+	}
+
+	if OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReport(os.Stdout, report)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("Registry check found %d problems", len(report.Issues))
+	}
+	return nil
+}
+
+func printReport(w io.Writer, report *check.Report) {
+	fmt.Fprintf(w, "Checked %d repositories, %d images, %d blobs\n", report.Repos, report.Images, report.Blobs)
+	if report.OK() {
+		fmt.Fprintln(w, "No problems found")
+		return
+	}
+
+	fmt.Fprintf(w, "\nProblems:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  KIND\tREFERENCE\tDETAILS")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", issue.Kind, issue.Reference, issue.Details)
+	}
+	_ = tw.Flush()
+}
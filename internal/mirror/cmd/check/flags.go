@@ -0,0 +1,89 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+func addFlags(flagSet *pflag.FlagSet) {
+	flagSet.StringVar(
+		&RegistryRepo,
+		"registry",
+		"",
+		"Registry repo Deckhouse was pushed to, like registry.example.com/deckhouse/ee.",
+	)
+	flagSet.StringVar(
+		&BundlePath,
+		"bundle",
+		"",
+		"Bundle that was pushed to the registry. If set, every image from the bundle must be in the registry with the same digest.",
+	)
+	flagSet.StringVarP(
+		&RegistryUsername,
+		"registry-login",
+		"u",
+		os.Getenv("D8_MIRROR_REGISTRY_LOGIN"),
+		"Username to log into the registry.",
+	)
+	flagSet.StringVarP(
+		&RegistryPassword,
+		"registry-password",
+		"p",
+		os.Getenv("D8_MIRROR_REGISTRY_PASSWORD"),
+		"Password to log into the registry.",
+	)
+	flagSet.StringVarP(
+		&OutputFormat,
+		"output",
+		"o",
+		"table",
+		"Output format, one of: table, json.",
+	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases, expected in the registry.",
+	)
+	flagSet.StringVar(
+		&RewriteRulesPath,
+		"rewrite-rules",
+		"",
+		"Path to the YAML file with rewrite rules the bundle was pushed with.",
+	)
+	flagSet.StringVar(
+		&ExtraImagesRepo,
+		"extra-images-repo",
+		"",
+		"Repo extra images and charts of the bundle were pushed under. Defaults to <registry>/extra.",
+	)
+	flagSet.BoolVar(
+		&TLSSkipVerify,
+		"tls-skip-verify",
+		false,
+		"Disable TLS certificate validation.",
+	)
+	flagSet.BoolVar(
+		&Insecure,
+		"insecure",
+		false,
+		"Interact with registries over HTTP.",
+	)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+)
+
+func parseAndValidateParameters(_ *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("accepts no arguments, received %d", len(args))
+	}
+
+	var err error
+	if err = parseAndValidateRegistryFlag(); err != nil {
+		return err
+	}
+	if RegistryPassword != "" && RegistryUsername == "" {
+		return errors.New("registry username not specified")
+	}
+	if OutputFormat != "table" && OutputFormat != "json" {
+		return fmt.Errorf("unknown output format %q", OutputFormat)
+	}
+	if err = validateExtraImagesRepo(); err != nil {
+		return err
+	}
+	if RewriteRulesPath != "" {
+		if rewriteRules, err = rewrite.Load(RewriteRulesPath); err != nil {
+			return err
+		}
+	}
+	if SecurityArtifactsPath != "" {
+		if securityArtifacts, err = security.Load(SecurityArtifactsPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateExtraImagesRepo() error {
+	if ExtraImagesRepo == "" {
+		return nil
+	}
+
+	ExtraImagesRepo = strings.TrimSuffix(strings.NewReplacer("http://", "", "https://", "").Replace(ExtraImagesRepo), "/")
+	if _, err := name.NewRepository(ExtraImagesRepo); err != nil {
+		return fmt.Errorf("invalid --extra-images-repo: %w", err)
+	}
+	return nil
+}
+
+func parseAndValidateRegistryFlag() error {
+	registry := strings.NewReplacer("http://", "", "https://", "").Replace(RegistryRepo)
+	if registry == "" {
+		return errors.New("--registry is required")
+	}
+
+	registryUrl, err := url.ParseRequestURI("docker://" + registry)
+	if err != nil {
+		return fmt.Errorf("Validate registry address: %w", err)
+	}
+	RegistryHost = registryUrl.Host
+	RegistryPath = registryUrl.Path
+	if RegistryHost == "" {
+		return errors.New("--registry you provided contains no registry host. Please specify registry address correctly.")
+	}
+	if RegistryPath == "" {
+		return errors.New("--registry you provided contains no path to repo. Please specify registry repo path correctly.")
+	}
+
+	return nil
+}
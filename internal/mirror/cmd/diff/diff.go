@@ -0,0 +1,172 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+)
+
+var diffLong = templates.LongDesc(`
+Compare two Deckhouse Kubernetes Platform distribution bundles.
+
+This command reads OCI Image Layouts indexes of both bundles and reports added and removed
+Deckhouse releases, modules versions and images, images that changed their digests
+while keeping the same tag and the difference in bundles sizes.
+
+Bundles may be passed as tar archives, chunked tar archives or unpacked directories.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a 
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:           "diff <old-images-bundle-path> <new-images-bundle-path>",
+		Short:         "Show what has changed between two Deckhouse Kubernetes Platform distribution bundles",
+		Long:          diffLong,
+		ValidArgs:     []string{"old-images-bundle-path", "new-images-bundle-path"},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          diff,
+	}
+
+	addFlags(diffCmd.Flags())
+	return diffCmd
+}
+
+var (
+	OldBundlePath string
+	NewBundlePath string
+	OutputFormat  string
+)
+
+func diff(_ *cobra.Command, _ []string) error {
+	oldBundle, err := bundle.OpenFS(OldBundlePath)
+	if err != nil {
+		return fmt.Errorf("Open %s: %w", OldBundlePath, err)
+	}
+	defer oldBundle.Close()
+
+	newBundle, err := bundle.OpenFS(NewBundlePath)
+	if err != nil {
+		return fmt.Errorf("Open %s: %w", NewBundlePath, err)
+	}
+	defer newBundle.Close()
+
+	bundlesDiff, err := bundle.Compare(oldBundle, newBundle)
+	if err != nil {
+		return fmt.Errorf("Compare bundles: %w", err)
+	}
+
+	if OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bundlesDiff)
+	}
+
+	printDiff(os.Stdout, bundlesDiff)
+	return nil
+}
+
+func printDiff(w io.Writer, d *bundle.Diff) {
+	sign := "+"
+	if d.SizeDelta() < 0 {
+		sign = "-"
+	}
+	delta := d.SizeDelta()
+	if delta < 0 {
+		delta = -delta
+	}
+	fmt.Fprintf(w, "Bundle size: %s -> %s (%s%s)\n",
+		humanize.IBytes(uint64(d.OldSize)),
+		humanize.IBytes(uint64(d.NewSize)),
+		sign, humanize.IBytes(uint64(delta)),
+	)
+
+	fmt.Fprintln(w, "\nDeckhouse releases:")
+	printChanges(w, "  ", d.DeckhouseVersions)
+
+	fmt.Fprintln(w, "\nModules:")
+	if len(d.ModuleVersions) == 0 {
+		fmt.Fprintln(w, "  no changes")
+	}
+	moduleNames := maps.Keys(d.ModuleVersions)
+	slices.Sort(moduleNames)
+	for _, moduleName := range moduleNames {
+		fmt.Fprintf(w, "  %s:\n", moduleName)
+		printChanges(w, "    ", d.ModuleVersions[moduleName])
+	}
+
+	fmt.Fprintln(w, "\nLayouts:")
+	if len(d.Layouts) == 0 {
+		fmt.Fprintln(w, "  no changes")
+	}
+	for _, layoutDiff := range d.Layouts {
+		layoutName := layoutDiff.Path
+		if layoutName == "." {
+			layoutName = "<root>"
+		}
+		switch {
+		case layoutDiff.Added:
+			layoutName += " (new layout)"
+		case layoutDiff.Removed:
+			layoutName += " (removed layout)"
+		}
+		fmt.Fprintf(w, "  %s:\n", layoutName)
+
+		for _, tag := range layoutDiff.AddedTags {
+			fmt.Fprintf(w, "    + tag %s\n", tag)
+		}
+		for _, tag := range layoutDiff.RemovedTags {
+			fmt.Fprintf(w, "    - tag %s\n", tag)
+		}
+		for _, change := range layoutDiff.ChangedTags {
+			fmt.Fprintf(w, "    ~ tag %s: %s -> %s\n", change.Tag, change.OldDigest, change.NewDigest)
+		}
+		if len(layoutDiff.AddedImages) > 0 || len(layoutDiff.RemovedImages) > 0 {
+			fmt.Fprintf(w, "    images: %d added, %d removed\n", len(layoutDiff.AddedImages), len(layoutDiff.RemovedImages))
+		}
+	}
+}
+
+func printChanges(w io.Writer, indent string, changes bundle.Changes) {
+	if changes.IsEmpty() {
+		fmt.Fprintln(w, indent+"no changes")
+		return
+	}
+	if len(changes.Added) > 0 {
+		fmt.Fprintln(w, indent+"added:   "+strings.Join(changes.Added, ", "))
+	}
+	if len(changes.Removed) > 0 {
+		fmt.Fprintln(w, indent+"removed: "+strings.Join(changes.Removed, ", "))
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+)
+
+var inspectLong = templates.LongDesc(`
+Show contents of the Deckhouse Kubernetes Platform distribution bundle.
+
+This command lists OCI Image Layouts stored in the bundle with images and tags in each of them,
+Deckhouse releases with their version.json and changelog metadata from release-channel images,
+modules versions, bundle size and chunks it is split into.
+
+Bundle may be passed as a tar archive, chunked tar archive or unpacked directory.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	inspectCmd := &cobra.Command{
+		Use:           "inspect <images-bundle-path>",
+		Aliases:       []string{"ls"},
+		Short:         "Show contents of the Deckhouse Kubernetes Platform distribution bundle",
+		Long:          inspectLong,
+		ValidArgs:     []string{"images-bundle-path"},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          inspect,
+	}
+
+	addFlags(inspectCmd.Flags())
+	return inspectCmd
+}
+
+var (
+	BundlePath   string
+	OutputFormat string
+)
+
+func inspect(_ *cobra.Command, _ []string) error {
+	bundleFS, err := bundle.OpenFS(BundlePath)
+	if err != nil {
+		return fmt.Errorf("Open %s: %w", BundlePath, err)
+	}
+	defer bundleFS.Close()
+
+	contents, err := bundle.Inspect(bundleFS)
+	if err != nil {
+		return fmt.Errorf("Inspect bundle: %w", err)
+	}
+
+	if OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(contents)
+	}
+
+	printContents(os.Stdout, contents)
+	return nil
+}
+
+func printContents(w io.Writer, contents *bundle.Contents) {
+	fmt.Fprintf(w, "Bundle size: %s\n", humanize.IBytes(uint64(contents.Size)))
+	if len(contents.Chunks) > 0 {
+		fmt.Fprintf(w, "\nChunks:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tSIZE")
+		for _, chunk := range contents.Chunks {
+			fmt.Fprintf(tw, "  %s\t%s\n", chunk.Name, humanize.IBytes(uint64(chunk.Size)))
+		}
+		_ = tw.Flush()
+	}
+
+	if len(contents.Releases) > 0 {
+		fmt.Fprintf(w, "\nDeckhouse releases:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TAG\tVERSION\tSUSPENDED\tREQUIREMENTS\tDISRUPTIONS\tCHANGELOG")
+		for _, release := range contents.Releases {
+			changelog := maps.Keys(release.Changelog)
+			slices.Sort(changelog)
+			fmt.Fprintf(tw, "  %s\t%s\t%t\t%s\t%s\t%s\n",
+				release.Tag,
+				release.Version,
+				release.Suspended,
+				valueOrNone(formatRequirements(release.Requirements.Flat())),
+				valueOrNone(formatDisruptions(release.Disruptions)),
+				valueOrNone(strings.Join(changelog, ", ")),
+			)
+		}
+		_ = tw.Flush()
+	}
+
+	if len(contents.Modules) > 0 {
+		fmt.Fprintf(w, "\nModules:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tVERSIONS")
+		for _, module := range contents.Modules {
+			fmt.Fprintf(tw, "  %s\t%s\n", module.Name, valueOrNone(strings.Join(module.Versions, ", ")))
+		}
+		_ = tw.Flush()
+	}
+
+	for _, layout := range contents.Layouts {
+		layoutName := layout.Path
+		if layoutName == "." {
+			layoutName = "<root>"
+		}
+		fmt.Fprintf(w, "\nLayout %s (%d images):\n", layoutName, len(layout.Images))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TAG\tDIGEST\tSIZE\tREFERENCE")
+		for _, img := range layout.Images {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n",
+				valueOrNone(img.Tag),
+				img.Digest,
+				humanize.IBytes(uint64(img.Size)),
+				img.Reference,
+			)
+		}
+		_ = tw.Flush()
+	}
+}
+
+func formatRequirements(requirements map[string]string) string {
+	keys := maps.Keys(requirements)
+	slices.Sort(keys)
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key+"="+requirements[key])
+	}
+	return strings.Join(result, ", ")
+}
+
+func formatDisruptions(disruptions map[string][]string) string {
+	keys := maps.Keys(disruptions)
+	slices.Sort(keys)
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key+": "+strings.Join(disruptions[key], " "))
+	}
+	return strings.Join(result, ", ")
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
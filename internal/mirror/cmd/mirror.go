@@ -23,9 +23,16 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/kubectl/pkg/util/templates"
 
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/bundle"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/changelog"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/check"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/diff"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/inspect"
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/modules"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/prune"
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/pull"
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/push"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/serve"
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/vulndb"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
 )
@@ -55,6 +62,13 @@ func NewCommand() *cobra.Command {
 		push.NewCommand(),
 		modules.NewCommand(),
 		vulndb.NewCommand(),
+		diff.NewCommand(),
+		inspect.NewCommand(),
+		changelog.NewCommand(),
+		bundle.NewCommand(),
+		serve.NewCommand(),
+		prune.NewCommand(),
+		check.NewCommand(),
 	)
 
 	debugLogLevel := log.DebugLogLevel()
@@ -17,21 +17,26 @@ limitations under the License.
 package pull
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
 	"k8s.io/kubectl/pkg/util/templates"
 	"sigs.k8s.io/yaml"
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/api/v1alpha1"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/manifests"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/modules"
@@ -41,6 +46,10 @@ import (
 var pullLong = templates.LongDesc(`
 Download Deckhouse modules images from ModuleSource to local filesystem.
 
+ModuleRelease manifests for the pulled module versions are written to modulereleases.yaml
+in the modules directory, so the cluster could show their changelogs and let updates be approved
+when the ModuleSource is not reachable from it.
+
 For more information on how to use it, consult the docs at 
 https://deckhouse.io/products/kubernetes-platform/documentation/v1/deckhouse-faq.html#manually-uploading-images-of-deckhouse-modules-into-an-air-gapped-registry
 
@@ -80,16 +89,25 @@ func pull(_ *cobra.Command, _ []string) error {
 	}
 	logger := log.NewSLogger(logLevel)
 
-	return pullExternalModulesToLocalFS(
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := pullExternalModulesToLocalFS(
+		ctx,
 		logger,
 		ModuleSourcePath,
 		ModulesDirectory,
 		ModulesFilter,
 		SkipTLSVerify,
 	)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("Pull interrupted, modules pulled so far are kept in %s", ModulesDirectory)
+	}
+	return err
 }
 
 func pullExternalModulesToLocalFS(
+	ctx context.Context,
 	logger contexts.Logger,
 	sourceYmlPath, mirrorDirectoryPath, moduleFilterExpression string,
 	skipVerifyTLS bool,
@@ -105,7 +123,7 @@ func pullExternalModulesToLocalFS(
 		return fmt.Errorf("Parse dockerCfg: %w", err)
 	}
 
-	modulesFromRepo, err := modules.GetExternalModulesFromRepo(src.Spec.Registry.Repo, authProvider, insecure, skipVerifyTLS)
+	modulesFromRepo, err := modules.GetExternalModulesFromRepoContext(ctx, src.Spec.Registry.Repo, authProvider, insecure, skipVerifyTLS)
 	if err != nil {
 		return fmt.Errorf("Get external modules from %q: %w", src.Spec.Registry.Repo, err)
 	}
@@ -132,6 +150,7 @@ func pullExternalModulesToLocalFS(
 	}
 
 	tagsResolver := layouts.NewTagsResolver()
+	modulesReleasesLayouts := make(map[string]layout.Path, len(modulesFromRepo))
 	for i, module := range modulesFromRepo {
 		logger.InfoF("[%d / %d] Pulling module %s ", i+1, len(modulesFromRepo), module.RegistryPath)
 
@@ -144,13 +163,13 @@ func pullExternalModulesToLocalFS(
 			return fmt.Errorf("Create module OCI Layouts: %w", err)
 		}
 
-		moduleImageSet, releasesImageSet, err := modules.FindExternalModuleImages(&module, modulesFilter, authProvider, insecure, skipVerifyTLS)
+		moduleImageSet, releasesImageSet, err := modules.FindExternalModuleImagesContext(ctx, &module, modulesFilter, authProvider, insecure, skipVerifyTLS)
 		if err != nil {
 			return fmt.Errorf("Find external module images`: %w", err)
 		}
 
 		for _, imageSet := range []map[string]struct{}{moduleImageSet, releasesImageSet} {
-			if err = tagsResolver.ResolveTagsDigestsFromImageSet(imageSet, authProvider, insecure, skipVerifyTLS); err != nil {
+			if err = tagsResolver.ResolveTagsDigestsFromImageSetContext(ctx, imageSet, authProvider, insecure, skipVerifyTLS); err != nil {
 				return fmt.Errorf("Resolve digests for images tags: %w", err)
 			}
 		}
@@ -165,16 +184,23 @@ func pullExternalModulesToLocalFS(
 		}
 
 		logger.InfoLn("Pulling module contents")
-		err = layouts.PullImageSet(pullCtx, moduleLayout, moduleImageSet, layouts.WithTagToDigestMapper(tagsResolver.GetTagDigest))
+		err = layouts.PullImageSetContext(ctx, pullCtx, moduleLayout, moduleImageSet, layouts.WithTagToDigestMapper(tagsResolver.GetTagDigest))
 		if err != nil {
 			return fmt.Errorf("Pull images: %w", err)
 		}
 
 		logger.InfoLn("Pulling module release data")
-		err = layouts.PullImageSet(pullCtx, moduleReleasesLayout, releasesImageSet, layouts.WithTagToDigestMapper(tagsResolver.GetTagDigest))
+		err = layouts.PullImageSetContext(ctx, pullCtx, moduleReleasesLayout, releasesImageSet, layouts.WithTagToDigestMapper(tagsResolver.GetTagDigest))
 		if err != nil {
 			return fmt.Errorf("Pull images: %w", err)
 		}
+		modulesReleasesLayouts[module.Name] = moduleReleasesLayout
+	}
+
+	logger.InfoLn("Generating ModuleRelease manifests")
+	manifestFile := filepath.Join(mirrorDirectoryPath, "modulereleases.yaml")
+	if err = manifests.GenerateModuleReleaseManifests(modulesReleasesLayouts, src.Name, manifestFile); err != nil {
+		return fmt.Errorf("Generate ModuleRelease manifests: %w", err)
 	}
 
 	return nil
@@ -20,6 +20,8 @@ import (
 	"os"
 
 	"github.com/spf13/pflag"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 )
 
 func addFlags(flagSet *pflag.FlagSet) {
@@ -51,6 +53,30 @@ func addFlags(flagSet *pflag.FlagSet) {
 		os.Getenv("D8_MIRROR_REGISTRY_PASSWORD"),
 		"Password to log into your registry",
 	)
+	flagSet.StringVar(
+		&RewriteRulesPath,
+		"rewrite-rules",
+		"",
+		"Path to the YAML file with rules to push modules into other repositories than the ones under the registry path",
+	)
+	flagSet.IntVar(
+		&MirrorModulesParallelism.Modules,
+		"parallel-modules",
+		contexts.DefaultParallelism.Modules,
+		"Number of modules pushed at once",
+	)
+	flagSet.IntVar(
+		&MirrorModulesParallelism.Images,
+		"parallel-images",
+		contexts.DefaultParallelism.Images,
+		"Number of images of the repository pushed at once",
+	)
+	flagSet.IntVar(
+		&MirrorModulesParallelism.Blobs,
+		"parallel-blobs",
+		contexts.DefaultParallelism.Blobs,
+		"Number of blobs of the image pushed at once",
+	)
 	flagSet.BoolVar(
 		&MirrorModulesTLSSkipVerify,
 		"tls-skip-verify",
@@ -33,7 +33,9 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/concurrent"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
 )
 
@@ -75,6 +77,11 @@ var (
 
 	MirrorModulesInsecure      bool
 	MirrorModulesTLSSkipVerify bool
+
+	MirrorModulesParallelism = contexts.DefaultParallelism
+
+	RewriteRulesPath string
+	rewriteRules     *rewrite.Rules
 )
 
 func push(_ *cobra.Command, _ []string) error {
@@ -97,6 +104,7 @@ func push(_ *cobra.Command, _ []string) error {
 		MirrorModulesDirectory,
 		MirrorModulesRegistry,
 		authProvider,
+		MirrorModulesParallelism,
 		MirrorModulesInsecure,
 		MirrorModulesTLSSkipVerify,
 	)
@@ -107,6 +115,7 @@ func pushModulesToRegistry(
 	modulesDir string,
 	registryPath string,
 	authProvider authn.Authenticator,
+	parallelism contexts.ParallelismConfig,
 	insecure, skipVerifyTLS bool,
 ) error {
 	dirEntries, err := os.ReadDir(modulesDir)
@@ -114,71 +123,94 @@ func pushModulesToRegistry(
 		return fmt.Errorf("Read modules directory: %w", err)
 	}
 
-	refOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
-
-	for i, entry := range dirEntries {
-		if !entry.IsDir() {
-			continue
+	modules := make([]string, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if entry.IsDir() {
+			modules = append(modules, entry.Name())
 		}
+	}
 
-		moduleName := entry.Name()
-		moduleRegistryPath := path.Join(registryPath, moduleName)
-		moduleReleasesRegistryPath := path.Join(registryPath, moduleName, "release")
-
-		logger.InfoF("Pushing module %s [%d / %d]", moduleName, i+1, len(dirEntries))
-
-		moduleLayout, err := layout.FromPath(filepath.Join(modulesDir, moduleName))
-		if err != nil {
-			return fmt.Errorf("Module %s: Read OCI layout: %w", moduleName, err)
-		}
-		moduleReleasesLayout, err := layout.FromPath(filepath.Join(modulesDir, moduleName, "release"))
-		if err != nil {
-			return fmt.Errorf("Module %s: Read OCI layout: %w", moduleName, err)
+	err = concurrent.ForEach(modules, parallelism.Modules, func(moduleName string) error {
+		logger.InfoF("Pushing module %s", moduleName)
+		if err := pushModule(logger, modulesDir, registryPath, moduleName, authProvider, parallelism, insecure, skipVerifyTLS); err != nil {
+			return fmt.Errorf("Module %s: %w", moduleName, err)
 		}
+		logger.InfoF("Module %s pushed successfully", moduleName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		if err = layouts.PushLayoutToRepo(
-			moduleLayout,
-			moduleRegistryPath,
-			authProvider,
-			logger,
-			contexts.DefaultParallelism,
-			insecure,
-			skipVerifyTLS,
-		); err != nil {
-			return fmt.Errorf("Push module to registry: %w", err)
+	if rewriteRules != nil {
+		settings := rewriteRules.MakeModuleSourceSettings(registryPath, modules)
+		logger.InfoF("ModuleSource registry repo for the cluster: %s", settings.ModulesRepo)
+		for _, warning := range settings.Warnings {
+			logger.WarnLn(warning)
 		}
+	}
+	return nil
+}
 
-		logger.InfoF("Pushing releases for module %s", moduleName)
-		if err = layouts.PushLayoutToRepo(
-			moduleReleasesLayout,
-			moduleReleasesRegistryPath,
-			authProvider,
-			logger,
-			contexts.DefaultParallelism,
-			insecure,
-			skipVerifyTLS,
-		); err != nil {
-			return fmt.Errorf("Push module to registry: %w", err)
-		}
+func pushModule(
+	logger contexts.Logger,
+	modulesDir, registryPath, moduleName string,
+	authProvider authn.Authenticator,
+	parallelism contexts.ParallelismConfig,
+	insecure, skipVerifyTLS bool,
+) error {
+	refOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
+	moduleRegistryPath := rewriteRules.Repo(path.Join(registryPath, moduleName))
+	moduleReleasesRegistryPath := rewriteRules.Repo(path.Join(registryPath, moduleName, "release"))
 
-		logger.InfoF("Pushing index tag for module %s", moduleName)
+	moduleLayout, err := layout.FromPath(filepath.Join(modulesDir, moduleName))
+	if err != nil {
+		return fmt.Errorf("Read OCI layout: %w", err)
+	}
+	moduleReleasesLayout, err := layout.FromPath(filepath.Join(modulesDir, moduleName, "release"))
+	if err != nil {
+		return fmt.Errorf("Read OCI layout: %w", err)
+	}
 
-		imageRef, err := name.ParseReference(registryPath+":"+moduleName, refOpts...)
-		if err != nil {
-			return fmt.Errorf("Parse image reference: %w", err)
-		}
+	if err = layouts.PushLayoutToRepo(
+		moduleLayout,
+		moduleRegistryPath,
+		authProvider,
+		logger,
+		parallelism,
+		insecure,
+		skipVerifyTLS,
+	); err != nil {
+		return fmt.Errorf("Push module to registry: %w", err)
+	}
 
-		img, err := random.Image(16, 1)
-		if err != nil {
-			return fmt.Errorf("random.Image: %w", err)
-		}
+	logger.InfoF("Pushing releases for module %s", moduleName)
+	if err = layouts.PushLayoutToRepo(
+		moduleReleasesLayout,
+		moduleReleasesRegistryPath,
+		authProvider,
+		logger,
+		parallelism,
+		insecure,
+		skipVerifyTLS,
+	); err != nil {
+		return fmt.Errorf("Push module to registry: %w", err)
+	}
 
-		if err = remote.Write(imageRef, img, remoteOpts...); err != nil {
-			return fmt.Errorf("Write module index tag: %w", err)
-		}
+	logger.InfoF("Pushing index tag for module %s", moduleName)
 
-		logger.InfoF("Module %s pushed successfully", moduleName)
+	imageRef, err := name.ParseReference(rewriteRules.Repo(registryPath)+":"+moduleName, refOpts...)
+	if err != nil {
+		return fmt.Errorf("Parse image reference: %w", err)
 	}
 
+	img, err := random.Image(16, 1)
+	if err != nil {
+		return fmt.Errorf("random.Image: %w", err)
+	}
+
+	if err = remote.Write(imageRef, img, remoteOpts...); err != nil {
+		return fmt.Errorf("Write module index tag: %w", err)
+	}
 	return nil
 }
@@ -22,12 +22,23 @@ import (
 	"net/url"
 
 	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
 )
 
 func parseAndValidateParameters(_ *cobra.Command, _ []string) error {
 	if err := validateRegistryFlags(); err != nil {
 		return err
 	}
+	if err := MirrorModulesParallelism.Validate(); err != nil {
+		return err
+	}
+	if RewriteRulesPath != "" {
+		var err error
+		if rewriteRules, err = rewrite.Load(RewriteRulesPath); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/prune"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var pruneLong = templates.LongDesc(`
+Delete Deckhouse Kubernetes Platform and modules versions that are not needed anymore from the registry.
+
+This command reads versions that are currently on the release channels of Deckhouse and of every module
+in the registry. Versions older than the oldest version on release channels are deleted, except for
+the --keep-versions most recent of them. Images of Deckhouse components and modules pulled by digests are
+deleted if none of the kept versions reference them.
+
+Registry only deletes manifests, run garbage collection of the registry afterwards to free the storage.
+Use --dry-run to only see what would be deleted.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:           "prune",
+		Short:         "Delete Deckhouse Kubernetes Platform versions that are not needed anymore from the registry",
+		Long:          pruneLong,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          pruneRegistry,
+	}
+
+	addFlags(pruneCmd.Flags())
+	return pruneCmd
+}
+
+var (
+	RegistryRepo     string
+	RegistryHost     string
+	RegistryPath     string
+	RegistryUsername string
+	RegistryPassword string
+
+	Insecure      bool
+	TLSSkipVerify bool
+
+	KeepVersions int
+	DryRun       bool
+)
+
+func pruneRegistry(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+
+	mirrorCtx := &contexts.BaseContext{
+		Logger:              log.NewSLogger(logLevel),
+		RegistryAuth:        authn.Anonymous,
+		RegistryHost:        RegistryHost,
+		RegistryPath:        RegistryPath,
+		Insecure:            Insecure,
+		SkipTLSVerification: TLSSkipVerify,
+	}
+	if RegistryUsername != "" {
+		mirrorCtx.RegistryAuth = authn.FromConfig(authn.AuthConfig{
+			Username: RegistryUsername,
+			Password: RegistryPassword,
+		})
+	}
+
+	plan, err := prune.MakePlan(context.Background(), mirrorCtx, prune.Options{KeepOlderVersions: KeepVersions})
+	if err != nil {
+		return fmt.Errorf("Find versions to prune: %w", err)
+	}
+	printPlan(os.Stdout, plan)
+
+	if DryRun {
+		return nil
+	}
+	return mirrorCtx.Logger.Process("Deleting images", func() error {
+		return plan.Execute(context.Background(), mirrorCtx)
+	})
+}
+
+func printPlan(w io.Writer, plan *prune.Plan) {
+	for _, productPlan := range plan.Products {
+		fmt.Fprintf(w, "%s:\n", productPlan.Name)
+
+		channels := maps.Keys(productPlan.Channels)
+		slices.Sort(channels)
+		for _, channel := range channels {
+			fmt.Fprintf(w, "  Release channel %s: %s\n", channel, productPlan.Channels[channel])
+		}
+		fmt.Fprintf(w, "  Kept versions: %s\n", strings.Join(productPlan.KeptVersions, ", "))
+		for _, warning := range productPlan.Warnings {
+			fmt.Fprintf(w, "  Warning: %s\n", warning)
+		}
+
+		if len(productPlan.Delete) == 0 {
+			fmt.Fprintln(w, "  Nothing to delete")
+			continue
+		}
+		fmt.Fprintln(w, "  To delete:")
+		for _, ref := range productPlan.Delete {
+			fmt.Fprintf(w, "  - %s\n", ref)
+		}
+	}
+}
@@ -68,6 +68,12 @@ func addFlags(flagSet *pflag.FlagSet) {
 		0,
 		"Split resulting bundle file into chunks of at most N gigabytes",
 	)
+	flagSet.StringVar(
+		&BundleCompression,
+		"bundle-compression",
+		"",
+		"Compress resulting bundle tar stream, one of: gzip, zstd. Bundle is not compressed by default.",
+	)
 	flagSet.BoolVar(
 		&DoGOSTDigest,
 		"gost-digest",
@@ -86,6 +92,18 @@ func addFlags(flagSet *pflag.FlagSet) {
 		false,
 		"Do not pull Deckhouse modules into bundle.",
 	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases, copied along with Deckhouse.",
+	)
+	flagSet.StringVar(
+		&ExtraImagesPath,
+		"extra-images",
+		"",
+		"Path to the YAML file with the list of other images and OCI Helm charts to add to the bundle. Only linux/amd64 images are pulled.",
+	)
 	flagSet.BoolVar(
 		&TLSSkipVerify,
 		"tls-skip-verify",
@@ -20,15 +20,20 @@ import (
 	"bufio"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/maps"
 	"k8s.io/kubectl/pkg/util/templates"
@@ -38,9 +43,12 @@ import (
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/modules"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
 )
@@ -59,6 +67,36 @@ This command downloads the Deckhouse Kubernetes Platform distribution bundle
 containing specific platform releases and it's modules, 
 to be pushed into the air-gapped container registry at a later time.
 
+Bundle may also be stored in S3-compatible object storage or on the SFTP server:
+  s3://<bucket>/<path>/d8.tar[?endpoint=http://minio:9000&region=<region>]
+  sftp://[<user>@]<host>[:<port>]/<path>/d8.tar
+S3 credentials are read from the standard AWS environment variables and configuration files.
+SFTP server host key is checked against ~/.ssh/known_hosts, password may be passed in
+the D8_MIRROR_SFTP_PASSWORD environment variable, private key in D8_MIRROR_SFTP_IDENTITY_FILE.
+Chunks of the bundle are uploaded as soon as they are written.
+
+Security artifacts pulled along with Deckhouse may be changed with --security-artifacts, like:
+  artifacts:
+    - name: trivy-checks
+      disabled: true
+    - name: grype-db
+      tag: v6
+      optional: true
+Artifacts are pulled from <source>/security/<name>:<tag>, the same file should be passed to push.
+
+Other images and OCI Helm charts may be added to the bundle with --extra-images, like:
+  images:
+    - docker.io/grafana/grafana:10.4.2
+  charts:
+    - oci://ghcr.io/actions/actions-runner-controller-charts/gha-runner-scale-set:0.9.3
+They are pulled with the credentials for their registries from the docker config and pushed
+under <registry>/extra, or under the repo passed to push with --extra-images-repo.
+Only linux/amd64 image is pulled from multi-platform images, the same as for Deckhouse images.
+
+DeckhouseRelease and ModuleRelease manifests for the pulled versions are written next to the bundle
+to deckhousereleases.yaml and modulereleases.yaml. Applied to the cluster, they show changelogs
+of the releases and let updates be approved when release sources are not reachable.
+
 For more information on how to use it, consult the docs at 
 https://deckhouse.io/products/kubernetes-platform/documentation/v1/deckhouse-faq.html#manually-uploading-images-to-an-air-gapped-registry
 
@@ -95,6 +133,7 @@ var (
 
 	ImagesBundlePath        string
 	ImagesBundleChunkSizeGB int64
+	BundleCompression       string
 
 	minVersionString string
 	MinVersion       *semver.Version
@@ -110,6 +149,12 @@ var (
 	DoGOSTDigest            bool
 	DontContinuePartialPull bool
 	NoModules               bool
+
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
+	ExtraImagesPath string
+	extraImages     []extra.Image
 )
 
 func buildPullContext() *contexts.PullContext {
@@ -127,6 +172,7 @@ func buildPullContext() *contexts.PullContext {
 			DeckhouseRegistryRepo: SourceRegistryRepo,
 			RegistryAuth:          getSourceRegistryAuthProvider(),
 			BundlePath:            ImagesBundlePath,
+			SecurityArtifacts:     securityArtifacts,
 			UnpackedImagesPath: filepath.Join(
 				TempDir,
 				"pull",
@@ -134,12 +180,15 @@ func buildPullContext() *contexts.PullContext {
 			),
 		},
 
-		BundleChunkSize: ImagesBundleChunkSizeGB * 1000 * 1000 * 1000,
+		BundleChunkSize:   ImagesBundleChunkSizeGB * 1000 * 1000 * 1000,
+		BundleCompression: BundleCompression,
 
 		DoGOSTDigests:   DoGOSTDigest,
 		SkipModulesPull: NoModules,
 		SpecificVersion: SpecificRelease,
 		MinVersion:      MinVersion,
+
+		ExtraImages: extraImages,
 	}
 	return mirrorCtx
 }
@@ -161,7 +210,11 @@ func pull(_ *cobra.Command, _ []string) error {
 		patch := mirrorCtx.SpecificVersion.Patch()
 		accessValidationTag = fmt.Sprintf("v%d.%d.%d", major, minor, patch)
 	}
-	readAccessTimeoutCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	// Interrupted pull keeps the images that are already pulled, so the next pull would not download them again.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	readAccessTimeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	if err := auth.ValidateReadAccessForImageContext(
 		readAccessTimeoutCtx,
 		mirrorCtx.DeckhouseRegistryRepo+":"+accessValidationTag,
@@ -185,7 +238,7 @@ func pull(_ *cobra.Command, _ []string) error {
 			return nil
 		}
 
-		versionsToMirror, err = releases.VersionsToMirror(mirrorCtx)
+		versionsToMirror, err = releases.VersionsToMirrorContext(ctx, mirrorCtx)
 		if err != nil {
 			return fmt.Errorf("Find versions to mirror: %w", err)
 		}
@@ -193,15 +246,23 @@ func pull(_ *cobra.Command, _ []string) error {
 		return nil
 	})
 	if err != nil {
+		if ctx.Err() != nil {
+			return errors.New("Pull interrupted")
+		}
 		return err
 	}
 
 	err = logger.Process("Pull images", func() error {
-		return PullDeckhouseToLocalFS(mirrorCtx, versionsToMirror)
+		return PullDeckhouseToLocalFSContext(ctx, mirrorCtx, versionsToMirror)
 	})
 	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("Pull interrupted, images pulled so far are kept in %s for the next pull to continue from", mirrorCtx.UnpackedImagesPath)
+		}
 		return err
 	}
+	// Packing is not interruptible, let the signal terminate the process as usual.
+	stop()
 
 	err = logger.Process("Pack images", func() error {
 		return bundle.Pack(mirrorCtx)
@@ -230,31 +291,9 @@ func pull(_ *cobra.Command, _ []string) error {
 }
 
 func computeGOSTDigest(mirrorCtx *contexts.BaseContext) error {
-	bundleDir := filepath.Dir(mirrorCtx.BundlePath)
-	catalog, err := os.ReadDir(bundleDir)
+	bundleStream, err := bundle.OpenBundleStream(mirrorCtx.BundlePath)
 	if err != nil {
-		return fmt.Errorf("read tar bundle directory: %w", err)
-	}
-	streams := make([]io.Reader, 0)
-	for _, entry := range catalog {
-		fileName := entry.Name()
-		if !entry.Type().IsRegular() || filepath.Ext(fileName) != ".chunk" {
-			continue
-		}
-		chunkStream, err := os.Open(filepath.Join(bundleDir, fileName))
-		if err != nil {
-			return fmt.Errorf("open bundle chunk for reading: %w", err)
-		}
-		defer chunkStream.Close() // nolint // defer in a loop is valid here as we need those streams to survive until everything is calculated at the end of this function
-		streams = append(streams, chunkStream)
-	}
-
-	bundleStream := io.NopCloser(io.MultiReader(streams...))
-	if len(streams) == 0 {
-		bundleStream, err = os.Open(mirrorCtx.BundlePath)
-		if err != nil {
-			return fmt.Errorf("read tar bundle: %w", err)
-		}
+		return err
 	}
 	defer bundleStream.Close()
 
@@ -262,12 +301,61 @@ func computeGOSTDigest(mirrorCtx *contexts.BaseContext) error {
 	if err != nil {
 		return fmt.Errorf("Calculate GOST Checksum: %w", err)
 	}
-	if err = os.WriteFile(mirrorCtx.BundlePath+".gostsum", []byte(gostDigest), 0o666); err != nil {
+	gostsumFileName, err := writeNextToBundle(mirrorCtx.BundlePath, ".gostsum", strings.NewReader(gostDigest))
+	if err != nil {
 		return fmt.Errorf("Write GOST Checksum: %w", err)
 	}
 
 	mirrorCtx.Logger.InfoF("Digest: %s", gostDigest)
-	mirrorCtx.Logger.InfoF("Written to %s", mirrorCtx.BundlePath+".gostsum")
+	mirrorCtx.Logger.InfoF("Written to %s", gostsumFileName)
+	return nil
+}
+
+// writeNextToBundle writes data to the file named after the bundle file with the suffix appended, in the same place the bundle is stored.
+func writeNextToBundle(bundlePath, suffix string, data io.Reader) (string, error) {
+	bundleStorage, bundleFileName, err := storage.Open(bundlePath)
+	if err != nil {
+		return "", err
+	}
+	defer bundleStorage.Close()
+
+	if err = storage.WriteFile(bundleStorage, bundleFileName+suffix, data); err != nil {
+		return "", err
+	}
+	return bundleFileName + suffix, nil
+}
+
+// uploadNextToBundle copies the local file into the remote storage the bundle is written to.
+func uploadNextToBundle(bundlePath, localFilePath string) error {
+	localFile, err := os.Open(localFilePath)
+	if err != nil {
+		return err
+	}
+	defer localFile.Close()
+
+	bundleStorage, _, err := storage.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer bundleStorage.Close()
+
+	return storage.WriteFile(bundleStorage, filepath.Base(localFilePath), localFile)
+}
+
+// generateNextToBundle writes the file with the given name next to the bundle with generate.
+// Files for the bundles in remote storages are written to the temporary directory and uploaded.
+func generateNextToBundle(bundlePath, fileName string, generate func(filePath string) error) error {
+	if !storage.IsRemote(bundlePath) {
+		return generate(filepath.Join(filepath.Dir(bundlePath), fileName))
+	}
+
+	localFilePath := filepath.Join(TempDir, fileName)
+	if err := generate(localFilePath); err != nil {
+		return err
+	}
+	if err := uploadNextToBundle(bundlePath, localFilePath); err != nil {
+		return fmt.Errorf("Upload %s: %w", fileName, err)
+	}
 	return nil
 }
 
@@ -301,6 +389,14 @@ func getSourceRegistryAuthProvider() authn.Authenticator {
 func PullDeckhouseToLocalFS(
 	pullCtx *contexts.PullContext,
 	versions []semver.Version,
+) error {
+	return PullDeckhouseToLocalFSContext(context.Background(), pullCtx, versions)
+}
+
+func PullDeckhouseToLocalFSContext(
+	ctx context.Context,
+	pullCtx *contexts.PullContext,
+	versions []semver.Version,
 ) error {
 	logger := pullCtx.Logger
 	var err error
@@ -308,29 +404,29 @@ func PullDeckhouseToLocalFS(
 
 	if !pullCtx.SkipModulesPull {
 		logger.InfoF("Fetching Deckhouse external modules list")
-		modulesData, err = modules.GetDeckhouseExternalModules(pullCtx)
+		modulesData, err = modules.GetDeckhouseExternalModulesContext(ctx, pullCtx)
 		if err != nil {
 			return fmt.Errorf("get Deckhouse modules: %w", err)
 		}
 	}
 
 	logger.InfoF("Creating OCI Image Layouts")
-	imageLayouts, err := layouts.CreateOCIImageLayoutsForDeckhouse(pullCtx.UnpackedImagesPath, modulesData)
+	imageLayouts, err := layouts.CreateOCIImageLayoutsForDeckhouse(pullCtx.UnpackedImagesPath, modulesData, pullCtx.Security(), pullCtx.ExtraImages)
 	if err != nil {
 		return fmt.Errorf("create OCI Image Layouts: %w", err)
 	}
 	logger.InfoLn("Created OCI Image Layouts")
 
 	layouts.FillLayoutsWithBasicDeckhouseImages(pullCtx, imageLayouts, versions)
-	if err = imageLayouts.TagsResolver.ResolveTagsDigestsForImageLayouts(&pullCtx.BaseContext, imageLayouts); err != nil {
+	if err = imageLayouts.TagsResolver.ResolveTagsDigestsForImageLayoutsContext(ctx, &pullCtx.BaseContext, imageLayouts); err != nil {
 		return fmt.Errorf("Resolve images tags to digests: %w", err)
 	}
 
-	if err = layouts.PullInstallers(pullCtx, imageLayouts); err != nil {
+	if err = layouts.PullInstallersContext(ctx, pullCtx, imageLayouts); err != nil {
 		return fmt.Errorf("pull installers: %w", err)
 	}
 
-	if err = layouts.PullStandaloneInstallers(pullCtx, imageLayouts); err != nil {
+	if err = layouts.PullStandaloneInstallersContext(ctx, pullCtx, imageLayouts); err != nil {
 		return fmt.Errorf("pull standalone installers: %w", err)
 	}
 
@@ -344,38 +440,62 @@ func PullDeckhouseToLocalFS(
 	}
 	logger.InfoF("Found %d images", len(imageLayouts.DeckhouseImages))
 
-	if err = layouts.PullDeckhouseReleaseChannels(pullCtx, imageLayouts); err != nil {
+	if err = layouts.PullDeckhouseReleaseChannelsContext(ctx, pullCtx, imageLayouts); err != nil {
 		return fmt.Errorf("pull release channels: %w", err)
 	}
 
 	// We should not generate deckhousereleases.yaml manifest for single-release bundles
 	if pullCtx.SpecificVersion == nil {
 		logger.InfoF("Generating DeckhouseRelease manifests")
-		deckhouseReleasesManifestFile := filepath.Join(filepath.Dir(pullCtx.BundlePath), "deckhousereleases.yaml")
-		if err = manifests.GenerateDeckhouseReleaseManifestsForVersions(versions, deckhouseReleasesManifestFile, imageLayouts.ReleaseChannel); err != nil {
+		err = generateNextToBundle(pullCtx.BundlePath, "deckhousereleases.yaml", func(manifestFile string) error {
+			return manifests.GenerateDeckhouseReleaseManifestsForVersions(versions, manifestFile, imageLayouts.ReleaseChannel)
+		})
+		if err != nil {
 			return fmt.Errorf("Generate DeckhouseRelease manifests: %w", err)
 		}
 	}
 
-	if err = layouts.PullDeckhouseImages(pullCtx, imageLayouts); err != nil {
+	if err = layouts.PullDeckhouseImagesContext(ctx, pullCtx, imageLayouts); err != nil {
 		return fmt.Errorf("pull Deckhouse: %w", err)
 	}
 
-	logger.InfoLn("Pulling Trivy vulnerability databases")
-	if err = layouts.PullTrivyVulnerabilityDatabasesImages(pullCtx, imageLayouts); err != nil {
-		return fmt.Errorf("pull vulnerability database: %w", err)
+	logger.InfoLn("Pulling security artifacts")
+	if err = layouts.PullTrivyVulnerabilityDatabasesImagesContext(ctx, pullCtx, imageLayouts); err != nil {
+		return fmt.Errorf("pull security artifacts: %w", err)
+	}
+	logger.InfoLn("Security artifacts pulled")
+
+	if len(pullCtx.ExtraImages) > 0 {
+		logger.InfoLn("Pulling extra images")
+		if err = layouts.PullExtraImagesContext(ctx, pullCtx, imageLayouts); err != nil {
+			return fmt.Errorf("pull extra images: %w", err)
+		}
+		logger.InfoLn("Extra images pulled")
 	}
-	logger.InfoLn("Trivy vulnerability databases pulled")
 
 	if !pullCtx.SkipModulesPull {
 		logger.InfoLn("Searching for Deckhouse external modules images")
-		if err = layouts.FindDeckhouseModulesImages(pullCtx, imageLayouts); err != nil {
+		if err = layouts.FindDeckhouseModulesImagesContext(ctx, pullCtx, imageLayouts); err != nil {
 			return fmt.Errorf("find Deckhouse modules images: %w", err)
 		}
 
-		if err = layouts.PullModules(pullCtx, imageLayouts); err != nil {
+		if err = layouts.PullModulesContext(ctx, pullCtx, imageLayouts); err != nil {
 			return fmt.Errorf("pull Deckhouse modules: %w", err)
 		}
+
+		if len(imageLayouts.Modules) > 0 {
+			logger.InfoF("Generating ModuleRelease manifests")
+			modulesReleasesLayouts := make(map[string]layout.Path, len(imageLayouts.Modules))
+			for moduleName, moduleLayouts := range imageLayouts.Modules {
+				modulesReleasesLayouts[moduleName] = moduleLayouts.ReleasesLayout
+			}
+			err = generateNextToBundle(pullCtx.BundlePath, "modulereleases.yaml", func(manifestFile string) error {
+				return manifests.GenerateModuleReleaseManifests(modulesReleasesLayouts, manifests.ModuleSourceName, manifestFile)
+			})
+			if err != nil {
+				return fmt.Errorf("Generate ModuleRelease manifests: %w", err)
+			}
+		}
 	}
 
 	return nil
@@ -20,11 +20,18 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
 )
 
 func parseAndValidateParameters(_ *cobra.Command, args []string) error {
@@ -38,6 +45,19 @@ func parseAndValidateParameters(_ *cobra.Command, args []string) error {
 	if err = validateChunkSizeFlag(); err != nil {
 		return err
 	}
+	if err = validateCompressionFlag(); err != nil {
+		return err
+	}
+	if SecurityArtifactsPath != "" {
+		if securityArtifacts, err = security.Load(SecurityArtifactsPath); err != nil {
+			return err
+		}
+	}
+	if ExtraImagesPath != "" {
+		if extraImages, err = extra.Load(ExtraImagesPath); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -47,6 +67,19 @@ func validateImagesBundlePathArg(args []string) error {
 		return errors.New("invalid number of arguments")
 	}
 
+	if storage.IsRemote(args[0]) {
+		// Remote storage is checked when the bundle is written to it.
+		ImagesBundlePath = args[0]
+		bundleURL, err := url.Parse(ImagesBundlePath)
+		if err != nil {
+			return fmt.Errorf("Parse images-bundle-path URL: %w", err)
+		}
+		if path.Ext(bundleURL.Path) != ".tar" {
+			return errors.New("images-bundle-path argument should be a path to tar archive (.tar)")
+		}
+		return nil
+	}
+
 	ImagesBundlePath = filepath.Clean(args[0])
 	if filepath.Ext(ImagesBundlePath) != ".tar" {
 		return errors.New("images-bundle-path argument should be a path to tar archive (.tar)")
@@ -98,3 +131,11 @@ func validateChunkSizeFlag() error {
 
 	return nil
 }
+
+func validateCompressionFlag() error {
+	if !bundle.IsSupportedCompression(BundleCompression) {
+		return fmt.Errorf("Unknown bundle compression %q, expected one of: gzip, zstd", BundleCompression)
+	}
+
+	return nil
+}
@@ -20,6 +20,8 @@ import (
 	"os"
 
 	"github.com/spf13/pflag"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 )
 
 func addFlags(flagSet *pflag.FlagSet) {
@@ -37,6 +39,145 @@ func addFlags(flagSet *pflag.FlagSet) {
 		os.Getenv("D8_MIRROR_REGISTRY_PASSWORD"),
 		"Password to log into the target registry.",
 	)
+	flagSet.StringVar(
+		&TargetRepo,
+		"target-repo",
+		"",
+		"Repo the images pushed into the local target (oci:<path> or docker-registry-storage:<path>) would be served from, like registry.example.com/deckhouse/ee.",
+	)
+	flagSet.StringVar(
+		&RewriteRulesPath,
+		"rewrite-rules",
+		"",
+		"Path to the YAML file with rules to push images into other repositories than the ones under the registry path.",
+	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases, copied along with Deckhouse.",
+	)
+	flagSet.BoolVar(
+		&SkipAccessChecks,
+		"skip-access-checks",
+		os.Getenv("MIRROR_BYPASS_ACCESS_CHECKS") == "1",
+		"Push even if the registry type probe finds problems or write access to the registry could not be confirmed.",
+	)
+	flagSet.BoolVar(
+		&Provision,
+		"provision",
+		false,
+		"Create Harbor project or Nexus hosted Docker repository for Deckhouse if it does not exist. Registry credentials must allow to manage them.",
+	)
+	flagSet.BoolVar(
+		&ProvisionPublic,
+		"provision-public",
+		false,
+		"Allow pulling images from the provisioned project or repository without credentials.",
+	)
+	flagSet.StringVar(
+		&ProvisionQuota,
+		"provision-quota",
+		"",
+		"Storage quota of the provisioned Harbor project, like 200GiB. Not limited by default.",
+	)
+	flagSet.StringVar(
+		&ProvisionNexusBlobStore,
+		"provision-nexus-blob-store",
+		"default",
+		"Blob store of the provisioned Nexus repository.",
+	)
+	flagSet.IntVar(
+		&ProvisionNexusHTTPPort,
+		"provision-nexus-http-port",
+		0,
+		"Port of the HTTP connector of the provisioned Nexus repository. If not set, the connector has to be configured in Nexus by hand.",
+	)
+	flagSet.IntVar(
+		&Parallelism.Modules,
+		"parallel-modules",
+		contexts.DefaultParallelism.Modules,
+		"Number of modules pushed at once.",
+	)
+	flagSet.IntVar(
+		&Parallelism.Images,
+		"parallel-images",
+		contexts.DefaultParallelism.Images,
+		"Number of images of the repository pushed at once.",
+	)
+	flagSet.IntVar(
+		&Parallelism.Blobs,
+		"parallel-blobs",
+		contexts.DefaultParallelism.Blobs,
+		"Number of blobs of the image pushed at once.",
+	)
+	flagSet.StringVar(
+		&ExtraImagesRepo,
+		"extra-images-repo",
+		"",
+		"Repo to push extra images and charts of the bundle under, like registry.example.com/mirror. Defaults to <registry>/extra.",
+	)
+	flagSet.StringVar(
+		&RegistryManifestsPath,
+		"registry-manifests",
+		"",
+		"Write manifests that configure the cluster to use the registry into the file at this path after the push.",
+	)
+	flagSet.BoolVar(
+		&ApplyRegistryManifests,
+		"apply-registry-manifests",
+		false,
+		"Apply manifests that configure the cluster to use the registry to the cluster from --kubeconfig after the push.",
+	)
+	flagSet.BoolVar(
+		&ApplyReleases,
+		"apply-releases",
+		false,
+		"Create DeckhouseRelease objects for the releases of the bundle in the cluster from --kubeconfig after the push.",
+	)
+	flagSet.BoolVar(
+		&ReleasesDryRun,
+		"releases-dry-run",
+		false,
+		"With --apply-releases, only report which DeckhouseRelease objects would be created.",
+	)
+	flagSet.StringVarP(
+		&KubeconfigPath,
+		"kubeconfig",
+		"k",
+		defaultKubeconfigPath(),
+		"KubeConfig of the cluster to apply registry manifests and releases to. (default is $KUBECONFIG when it is set, $HOME/.kube/config otherwise)",
+	)
+	flagSet.StringVar(
+		&RegistryCAPath,
+		"registry-ca",
+		"",
+		"Path to the PEM encoded CA certificate of the registry to put into registry manifests.",
+	)
+	flagSet.StringVar(
+		&ClusterRegistryUsername,
+		"cluster-registry-login",
+		os.Getenv("D8_MIRROR_CLUSTER_REGISTRY_LOGIN"),
+		"Username the cluster pulls images with, put into registry manifests. Read-only access is enough.",
+	)
+	flagSet.StringVar(
+		&ClusterRegistryPassword,
+		"cluster-registry-password",
+		os.Getenv("D8_MIRROR_CLUSTER_REGISTRY_PASSWORD"),
+		"Password the cluster pulls images with, put into registry manifests.",
+	)
+	flagSet.StringVar(
+		&RegistryMode,
+		"registry-mode",
+		"",
+		"Registry mode of the deckhouse ModuleConfig in registry manifests, like Direct or Unmanaged. Taken from the cluster if not set.",
+	)
+	flagSet.IntVar(
+		&RegistrySettingsVersion,
+		"registry-settings-version",
+		0,
+		"Settings version of the deckhouse ModuleConfig in registry manifests. Taken from the cluster if not set.",
+	)
 	flagSet.BoolVar(
 		&TLSSkipVerify,
 		"tls-skip-verify",
@@ -50,3 +191,10 @@ func addFlags(flagSet *pflag.FlagSet) {
 		"Interact with registries over HTTP.",
 	)
 }
+
+func defaultKubeconfigPath() string {
+	if p := os.Getenv("KUBECONFIG"); p != "" {
+		return p
+	}
+	return os.ExpandEnv("$HOME/.kube/config")
+}
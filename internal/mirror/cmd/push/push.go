@@ -17,19 +17,32 @@ limitations under the License.
 package push
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/kubectl/pkg/util/templates"
 
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/manifests"
+	"github.com/deckhouse/deckhouse-cli/internal/utilk8s"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/operations"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/registryprofile"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/targets"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
 )
@@ -39,6 +52,54 @@ Upload Deckhouse Kubernetes Platform distribution bundle to the third-party regi
 
 This command pushes the Deckhouse Kubernetes Platform distribution into the specified container registry.
 
+Bundle may also be stored in S3-compatible object storage or on the SFTP server:
+  s3://<bucket>/<path>/d8.tar[?endpoint=http://minio:9000&region=<region>]
+  sftp://[<user>@]<host>[:<port>]/<path>/d8.tar
+S3 credentials are read from the standard AWS environment variables and configuration files.
+SFTP server host key is checked against ~/.ssh/known_hosts, password may be passed in
+the D8_MIRROR_SFTP_PASSWORD environment variable, private key in D8_MIRROR_SFTP_IDENTITY_FILE.
+Bundle is streamed from the remote storage while it is unpacked.
+
+Instead of the registry, images may be written into the local target without running registry:
+  oci:<path>                        OCI Image Layout directory, or OCI archive if path ends with .tar
+  docker-registry-storage:<path>    storage tree of the filesystem driver of registry:2
+Repositories and tags in the target are the same as they would be in the registry passed with --target-repo.
+
+Before push, the type of the registry is detected to check it for known limits of Harbor, Quay, Nexus and GitLab,
+like projects that have to be created in advance or nesting of repositories.
+With --provision, Harbor project or Nexus hosted Docker repository named after the first level of the registry path
+is created through the management API of the registry if it does not exist.
+Nexus serves Docker repositories only through HTTP connectors, set the port of the connector
+with --provision-nexus-http-port, otherwise configure the connector or the subdomain of the repository by hand.
+If the registry type or its settings could not be probed, the push goes on with a warning.
+Pass --skip-access-checks to push anyway if problems are found.
+
+Images may be pushed into other repositories than the ones under the registry path with --rewrite-rules, like:
+  rules:
+    - prefix: registry.example.com/deckhouse/ee/modules
+      replacement: registry.example.com/deckhouse-modules
+    - regex: ^registry\.example\.com/deckhouse/ee/security/(.+)$
+      replacement: registry.example.com/deckhouse/security-$1
+The first matching rule is applied. Registry settings the cluster needs are printed after the push.
+
+Extra images and charts of the bundle are pushed under <registry>/extra, keeping the paths of their source
+repositories. Set --extra-images-repo to push them under another repo. If it is in another registry, credentials
+for it are read from the docker config and it is accessed over HTTPS, --insecure and --tls-skip-verify do not apply to it.
+
+After the push, manifests that switch the cluster to the registry may be written with --registry-manifests
+or applied to the cluster from --kubeconfig with --apply-registry-manifests: the deckhouse ModuleSource
+and the registry settings of the deckhouse ModuleConfig. Deckhouse updates its registry Secret from the settings itself.
+Push credentials are never written into the cluster, read-only credentials for the cluster are passed with
+--cluster-registry-login and --cluster-registry-password. Registry mode and settings version are taken from
+the deckhouse ModuleConfig of the cluster unless set with --registry-mode and --registry-settings-version.
+Fields that are set in the cluster by others are not overridden, such conflicts are reported instead.
+CA certificate of the registry is set with --registry-ca.
+
+With --apply-releases, DeckhouseRelease objects for the releases of the bundle are created in the cluster
+from --kubeconfig, so there is no need to apply deckhousereleases.yaml by hand. Releases that are already
+in the cluster are left as they are, the ones that differ from the bundle are reported. Releases to be created
+are printed before they are applied. Add --releases-dry-run to only see what would be created.
+
 For more information on how to use it, consult the docs at 
 https://deckhouse.io/products/kubernetes-platform/documentation/v1/deckhouse-faq.html#manually-uploading-images-to-an-air-gapped-registry
 
@@ -50,7 +111,7 @@ valid license for any commercial version of the Deckhouse Kubernetes Platform.
 
 func NewCommand() *cobra.Command {
 	pushCmd := &cobra.Command{
-		Use:           "push <images-bundle-path> <registry>",
+		Use:           "push <images-bundle-path> <registry|oci:path|docker-registry-storage:path>",
 		Short:         "Copy Deckhouse Kubernetes Platform distribution to the third-party registry",
 		Long:          pushLong,
 		ValidArgs:     []string{"images-bundle-path", "registry"},
@@ -78,6 +139,41 @@ var (
 	Insecure         bool
 	TLSSkipVerify    bool
 	ImagesBundlePath string
+
+	PushTarget string // Local push target, images are pushed to the registry if empty
+	TargetRepo string
+
+	Parallelism = contexts.DefaultParallelism
+
+	RewriteRulesPath string
+	rewriteRules     *rewrite.Rules
+
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
+	ExtraImagesRepo string
+
+	RegistryManifestsPath  string
+	ApplyRegistryManifests bool
+	ApplyReleases          bool
+	ReleasesDryRun         bool
+	KubeconfigPath         string
+	RegistryCAPath         string
+	registryCA             string
+
+	ClusterRegistryUsername string
+	ClusterRegistryPassword string
+	RegistryMode            string
+	RegistrySettingsVersion int
+
+	SkipAccessChecks bool
+
+	Provision               bool
+	ProvisionPublic         bool
+	ProvisionQuota          string
+	ProvisionNexusBlobStore string
+	ProvisionNexusHTTPPort  int
+	provisionOptions        registryprofile.ProvisionOptions
 )
 
 func push(_ *cobra.Command, _ []string) error {
@@ -91,18 +187,44 @@ func push(_ *cobra.Command, _ []string) error {
 		})
 	}
 
-	if err := auth.ValidateWriteAccessForRepo(
-		mirrorCtx.RegistryHost+mirrorCtx.RegistryPath,
-		mirrorCtx.RegistryAuth,
-		mirrorCtx.Insecure,
-		mirrorCtx.SkipTLSVerification,
-	); err != nil {
-		if os.Getenv("MIRROR_BYPASS_ACCESS_CHECKS") != "1" {
-			return fmt.Errorf("registry credentials validation failure: %w", err)
+	// Local push targets are written directly, there is no registry to validate access to.
+	if PushTarget == "" {
+		// Registry type is probed first, as it gives clearer guidance than failed write access check.
+		profile, err := applyRegistryProfile(mirrorCtx)
+		if err != nil {
+			if !SkipAccessChecks {
+				return err
+			}
+			logger.WarnF("%v", err)
+		}
+
+		access, err := auth.CheckWriteAccessForRepo(
+			mirrorCtx.RegistryHost+mirrorCtx.RegistryPath,
+			mirrorCtx.RegistryAuth,
+			mirrorCtx.Insecure,
+			mirrorCtx.SkipTLSVerification,
+		)
+		if err == nil && access.Push != auth.PermissionAllowed {
+			err = fmt.Errorf("push is not allowed: %v", access.Notes)
+		}
+		if err != nil {
+			if !SkipAccessChecks {
+				return fmt.Errorf("registry credentials validation failure: %w", err)
+			}
+			logger.WarnF("Registry credentials validation failure: %v", err)
+		} else {
+			// Tag overwrite can not be checked through the distribution API, only the registry settings tell it.
+			if access.TagOverwrite == auth.PermissionUnknown && profile != nil && profile.TagOverwrite != "" {
+				access.TagOverwrite = profile.TagOverwrite
+			}
+			logger.InfoF("Registry permissions: %s", access)
+			for _, note := range access.Notes {
+				logger.DebugF("%s", note)
+			}
 		}
 	}
 
-	if filepath.Ext(mirrorCtx.BundlePath) == ".tar" || filepath.Ext(mirrorCtx.BundlePath) == ".chunk" {
+	if storage.IsRemote(mirrorCtx.BundlePath) || filepath.Ext(mirrorCtx.BundlePath) == ".tar" || filepath.Ext(mirrorCtx.BundlePath) == ".chunk" {
 		err := logger.Process("Unpacking Deckhouse bundle", func() error {
 			return bundle.Unpack(&mirrorCtx.BaseContext)
 		})
@@ -127,6 +249,20 @@ func push(_ *cobra.Command, _ []string) error {
 		}
 	}
 
+	if PushTarget != "" {
+		target, err := targets.Open(PushTarget)
+		if err != nil {
+			return fmt.Errorf("Open push target: %w", err)
+		}
+		err = logger.Process("Write Deckhouse images to "+PushTarget, func() error {
+			return operations.PushDeckhouseToTarget(mirrorCtx, target)
+		})
+		if err != nil {
+			return err
+		}
+		return configureCluster(mirrorCtx)
+	}
+
 	err := logger.Process("Push Deckhouse images to registry", func() error {
 		return operations.PushDeckhouseToRegistry(mirrorCtx)
 	})
@@ -134,9 +270,215 @@ func push(_ *cobra.Command, _ []string) error {
 		return err
 	}
 
+	if rewriteRules != nil {
+		printClusterSettings(mirrorCtx)
+	}
+	return configureCluster(mirrorCtx)
+}
+
+// configureCluster points the cluster to the pushed images and offers it the pushed releases if asked to.
+func configureCluster(mirrorCtx *contexts.PushContext) error {
+	if err := emitRegistryManifests(mirrorCtx); err != nil {
+		return err
+	}
+	if ApplyReleases {
+		return applyDeckhouseReleases(mirrorCtx)
+	}
 	return nil
 }
 
+// applyDeckhouseReleases creates DeckhouseRelease objects for the releases of the bundle that the cluster does not have yet.
+func applyDeckhouseReleases(mirrorCtx *contexts.PushContext) error {
+	logger := mirrorCtx.Logger
+	releaseChannelsLayout := layout.Path(filepath.Join(mirrorCtx.UnpackedImagesPath, "release-channel"))
+	versions, err := manifests.BundledDeckhouseReleaseVersions(releaseChannelsLayout)
+	if err != nil {
+		return fmt.Errorf("Find bundled releases: %w", err)
+	}
+	if len(versions) == 0 {
+		logger.WarnLn("Bundle has no release channels, DeckhouseRelease objects are not created for single release bundles")
+		return nil
+	}
+
+	deckhouseReleases, err := manifests.DeckhouseReleasesForVersions(versions, releaseChannelsLayout)
+	if err != nil {
+		return fmt.Errorf("Generate DeckhouseRelease manifests: %w", err)
+	}
+
+	client, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+	diff, err := manifests.DiffDeckhouseReleases(context.Background(), client, deckhouseReleases)
+	if err != nil {
+		return fmt.Errorf("Compare releases with the cluster: %w", err)
+	}
+	diff.Print(os.Stdout)
+	if len(diff.Missing) == 0 {
+		logger.InfoLn("All bundled releases are already in the cluster")
+		return nil
+	}
+	if ReleasesDryRun {
+		logger.InfoF("%d DeckhouseRelease objects would be created, nothing is changed in the dry run", len(diff.Missing))
+		return nil
+	}
+
+	if err = manifests.ApplyDeckhouseReleases(context.Background(), client, diff.Missing); err != nil {
+		return fmt.Errorf("Apply DeckhouseRelease manifests: %w", err)
+	}
+	logger.InfoF("%d DeckhouseRelease objects are created", len(diff.Missing))
+	return nil
+}
+
+func newDynamicClient() (dynamic.Interface, error) {
+	restConfig, _, err := utilk8s.SetupK8sClientSet(KubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to setup Kubernetes client: %w", err)
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to setup Kubernetes client: %w", err)
+	}
+	return client, nil
+}
+
+// emitRegistryManifests writes or applies the manifests that switch the cluster to the registry Deckhouse was pushed to.
+func emitRegistryManifests(mirrorCtx *contexts.PushContext) error {
+	if RegistryManifestsPath == "" && !ApplyRegistryManifests {
+		return nil
+	}
+
+	settings := makeClusterSettings(mirrorCtx)
+	registrySettings := manifests.RegistrySettings{
+		ImagesRepo:      settings.ImagesRepo,
+		ModulesRepo:     settings.ModulesRepo,
+		Scheme:          "HTTPS",
+		Username:        ClusterRegistryUsername,
+		Password:        ClusterRegistryPassword,
+		CA:              registryCA,
+		Mode:            RegistryMode,
+		SettingsVersion: RegistrySettingsVersion,
+	}
+	if mirrorCtx.Insecure {
+		registrySettings.Scheme = "HTTP"
+	}
+
+	var client dynamic.Interface
+	if ApplyRegistryManifests || RegistryMode == "" || RegistrySettingsVersion == 0 {
+		var err error
+		if client, err = newDynamicClient(); err != nil {
+			return err
+		}
+	}
+	if RegistryMode == "" || RegistrySettingsVersion == 0 {
+		mode, version, err := manifests.ReadRegistryModuleConfig(context.Background(), client)
+		if err != nil {
+			return err
+		}
+		if registrySettings.Mode == "" {
+			registrySettings.Mode = mode
+		}
+		if registrySettings.SettingsVersion == 0 {
+			registrySettings.SettingsVersion = version
+		}
+		if registrySettings.Mode == "" || registrySettings.SettingsVersion == 0 {
+			return errors.New("Registry mode or settings version is not set in the deckhouse ModuleConfig of the cluster, pass them with --registry-mode and --registry-settings-version")
+		}
+	}
+
+	objects, err := manifests.GenerateRegistryManifests(registrySettings)
+	if err != nil {
+		return fmt.Errorf("Generate registry manifests: %w", err)
+	}
+
+	logger := mirrorCtx.Logger
+	if RegistryManifestsPath != "" {
+		if err = manifests.WriteRegistryManifests(objects, RegistryManifestsPath); err != nil {
+			return err
+		}
+		logger.InfoF("Registry manifests are written to %s", RegistryManifestsPath)
+	}
+
+	if ApplyRegistryManifests {
+		if err = manifests.ApplyRegistryManifests(context.Background(), client, objects); err != nil {
+			return fmt.Errorf("Apply registry manifests: %w", err)
+		}
+		logger.InfoLn("Registry manifests are applied to the cluster")
+	}
+	return nil
+}
+
+// printClusterSettings tells how to configure the cluster to use repositories images were pushed to by the rewrite rules.
+func printClusterSettings(mirrorCtx *contexts.PushContext) {
+	settings := makeClusterSettings(mirrorCtx)
+	logger := mirrorCtx.Logger
+	logger.InfoLn("Registry settings for the cluster:")
+	logger.InfoF("  Deckhouse images repo: %s", settings.ImagesRepo)
+	logger.InfoF("  ModuleSource registry repo: %s", settings.ModulesRepo)
+	for _, warning := range settings.Warnings {
+		logger.WarnLn(warning)
+	}
+}
+
+func makeClusterSettings(mirrorCtx *contexts.PushContext) rewrite.ClusterSettings {
+	modules := make([]string, 0)
+	moduleDirs, _ := os.ReadDir(filepath.Join(mirrorCtx.UnpackedImagesPath, "modules"))
+	for _, dir := range moduleDirs {
+		if dir.IsDir() {
+			modules = append(modules, dir.Name())
+		}
+	}
+
+	return rewriteRules.MakeClusterSettings(path.Join(mirrorCtx.RegistryHost, mirrorCtx.RegistryPath), modules)
+}
+
+// applyRegistryProfile detects the registry type and fails early if Deckhouse can not be pushed to it as is.
+// Probe result is returned even if the registry is not ready for push.
+func applyRegistryProfile(mirrorCtx *contexts.PushContext) (*registryprofile.Result, error) {
+	logger := mirrorCtx.Logger
+	result, err := registryprofile.Probe(context.Background(), &mirrorCtx.BaseContext)
+	if err != nil {
+		// Probe only adds guidance for known registries, write access check that follows is what guards the push.
+		if Provision {
+			return nil, fmt.Errorf("Probe registry: %w", err)
+		}
+		logger.WarnF("Registry type could not be detected, its known limits are not checked: %v", err)
+		return nil, nil
+	}
+
+	logger.InfoF("Registry type: %s", result.Profile.Kind)
+	if Provision {
+		created, err := registryprofile.Provision(context.Background(), &mirrorCtx.BaseContext, result.Profile.Kind, provisionOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Provision registry: %w", err)
+		}
+		if created {
+			logger.InfoF("Created %q in the %s registry", strings.Split(strings.Trim(mirrorCtx.RegistryPath, "/"), "/")[0], result.Profile.Kind)
+			if result.Profile.Kind == registryprofile.Nexus && provisionOptions.NexusHTTPPort == 0 {
+				logger.WarnLn("Nexus repository is created without HTTP connector, configure the connector or the subdomain of the repository by hand")
+			}
+			if result, err = registryprofile.Probe(context.Background(), &mirrorCtx.BaseContext); err != nil {
+				return nil, fmt.Errorf("Probe registry: %w", err)
+			}
+		}
+	}
+	for _, finding := range result.Findings {
+		if !finding.Fatal {
+			logger.WarnLn(finding.Message)
+		}
+	}
+	mirrorCtx.OptionalSecurityDatabases = result.Profile.RestrictsArtifactMediaTypes
+
+	if fatal := result.Fatal(); len(fatal) > 0 {
+		messages := make([]string, 0, len(fatal))
+		for _, finding := range fatal {
+			messages = append(messages, finding.Message)
+		}
+		return result, fmt.Errorf("Registry is not ready for push:\n%s", strings.Join(messages, "\n"))
+	}
+	return result, nil
+}
+
 func buildPushContext() *contexts.PushContext {
 	logLevel := slog.LevelInfo
 	if log.DebugLogLevel() >= 3 {
@@ -153,12 +495,14 @@ func buildPushContext() *contexts.PushContext {
 			RegistryPath:        RegistryPath,
 			BundlePath:          ImagesBundlePath,
 			UnpackedImagesPath:  filepath.Join(TempDir, time.Now().Format("mirror_tmp_02-01-2006_15-04-05")),
+			SecurityArtifacts:   securityArtifacts,
 		},
 
-		Parallelism: contexts.ParallelismConfig{
-			Blobs:  4,
-			Images: 1,
-		},
+		Parallelism: Parallelism,
+
+		RewriteRules: rewriteRules,
+
+		ExtraImagesRepo: ExtraImagesRepo,
 	}
 	return mirrorCtx
 }
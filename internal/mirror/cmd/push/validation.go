@@ -21,10 +21,19 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/dustin/go-humanize"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/chunked"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/targets"
 )
 
 func parseAndValidateParameters(_ *cobra.Command, args []string) error {
@@ -42,11 +51,46 @@ func parseAndValidateParameters(_ *cobra.Command, args []string) error {
 	if err = validateImagesBundlePathArg(args); err != nil {
 		return err
 	}
+	if err = validateProvisionFlags(); err != nil {
+		return err
+	}
+	if err = Parallelism.Validate(); err != nil {
+		return err
+	}
+	if err = validateExtraImagesRepo(); err != nil {
+		return err
+	}
+	if err = validateRegistryManifestsFlags(); err != nil {
+		return err
+	}
+	if RewriteRulesPath != "" {
+		if rewriteRules, err = rewrite.Load(RewriteRulesPath); err != nil {
+			return err
+		}
+	}
+	if SecurityArtifactsPath != "" {
+		if securityArtifacts, err = security.Load(SecurityArtifactsPath); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 func validateImagesBundlePathArg(args []string) error {
+	if storage.IsRemote(args[0]) {
+		// Bundle in the remote storage is streamed from it and validated during unpacking.
+		ImagesBundlePath = args[0]
+		bundleURL, err := url.Parse(ImagesBundlePath)
+		if err != nil {
+			return fmt.Errorf("invalid images bundle path: %w", err)
+		}
+		if path.Ext(chunked.TrimChunkSuffix(bundleURL.Path)) != ".tar" {
+			return errors.New("images-bundle-path argument should be a path to tar archive (.tar)")
+		}
+		return nil
+	}
+
 	ImagesBundlePath = filepath.Clean(args[0])
 	bundleExtension := filepath.Ext(ImagesBundlePath)
 	stat, err := os.Stat(ImagesBundlePath)
@@ -71,6 +115,80 @@ func validateImagesBundlePathArg(args []string) error {
 	}
 }
 
+func validateProvisionFlags() error {
+	if !Provision {
+		if ProvisionPublic || ProvisionQuota != "" {
+			return errors.New("--provision-public and --provision-quota can only be used with --provision")
+		}
+		return nil
+	}
+	if PushTarget != "" {
+		return errors.New("--provision can not be used when pushing into the local target")
+	}
+	if ProvisionQuota != "" {
+		quota, err := humanize.ParseBytes(ProvisionQuota)
+		if err != nil {
+			return fmt.Errorf("invalid --provision-quota: %w", err)
+		}
+		provisionOptions.StorageLimit = int64(quota)
+	}
+	provisionOptions.Public = ProvisionPublic
+	provisionOptions.NexusBlobStore = ProvisionNexusBlobStore
+	if ProvisionNexusHTTPPort < 0 || ProvisionNexusHTTPPort > 65535 {
+		return fmt.Errorf("invalid --provision-nexus-http-port: %d", ProvisionNexusHTTPPort)
+	}
+	provisionOptions.NexusHTTPPort = ProvisionNexusHTTPPort
+	return nil
+}
+
+func validateExtraImagesRepo() error {
+	if ExtraImagesRepo == "" {
+		return nil
+	}
+
+	ExtraImagesRepo = strings.TrimSuffix(strings.NewReplacer("http://", "", "https://", "").Replace(ExtraImagesRepo), "/")
+	if _, err := name.NewRepository(ExtraImagesRepo); err != nil {
+		return fmt.Errorf("invalid --extra-images-repo: %w", err)
+	}
+	return nil
+}
+
+func validateRegistryManifestsFlags() error {
+	if RegistryCAPath != "" {
+		ca, err := os.ReadFile(RegistryCAPath)
+		if err != nil {
+			return fmt.Errorf("Invalid --registry-ca: %w", err)
+		}
+		registryCA = string(ca)
+	}
+
+	if ReleasesDryRun && !ApplyReleases {
+		return errors.New("--releases-dry-run is only used with --apply-releases")
+	}
+	if RegistryManifestsPath != "" || ApplyRegistryManifests {
+		if ClusterRegistryPassword != "" && ClusterRegistryUsername == "" {
+			return errors.New("cluster registry username not specified")
+		}
+		// Push credentials usually allow to write into the registry, they should not get into the cluster.
+		if RegistryUsername != "" && ClusterRegistryUsername == "" {
+			return errors.New("Registry manifests need read-only credentials for the cluster, pass them with --cluster-registry-login and --cluster-registry-password")
+		}
+	}
+
+	readsCluster := RegistryManifestsPath != "" && (RegistryMode == "" || RegistrySettingsVersion == 0)
+	if !ApplyRegistryManifests && !ApplyReleases && !readsCluster {
+		return nil
+	}
+	stats, err := os.Stat(KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("Invalid --kubeconfig: %w", err)
+	}
+	if !stats.Mode().IsRegular() {
+		return fmt.Errorf("Invalid --kubeconfig: %s is not a regular file", KubeconfigPath)
+	}
+	return nil
+}
+
 func validateRegistryCredentials() error {
 	if RegistryPassword != "" && RegistryUsername == "" {
 		return errors.New("registry username not specified")
@@ -79,7 +197,22 @@ func validateRegistryCredentials() error {
 }
 
 func parseAndValidateRegistryURLArg(args []string) error {
-	registry := strings.NewReplacer("http://", "", "https://", "").Replace(args[1])
+	if targets.IsLocal(args[1]) {
+		PushTarget = args[1]
+		if TargetRepo == "" {
+			return errors.New("--target-repo is required to push into the local target, it should point to the repo images would be served from")
+		}
+		return parseRegistryRepo(TargetRepo)
+	}
+	if TargetRepo != "" {
+		return errors.New("--target-repo can only be used when pushing into the local target")
+	}
+
+	return parseRegistryRepo(args[1])
+}
+
+func parseRegistryRepo(repo string) error {
+	registry := strings.NewReplacer("http://", "", "https://", "").Replace(repo)
 	if registry == "" {
 		return errors.New("<registry> argument is empty")
 	}
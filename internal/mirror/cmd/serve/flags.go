@@ -0,0 +1,65 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serve
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+func addFlags(flagSet *pflag.FlagSet) {
+	flagSet.StringVarP(
+		&ListenAddress,
+		"listen",
+		"l",
+		":5000",
+		"Address to listen on.",
+	)
+	flagSet.StringVar(
+		&RepoPath,
+		"repo-path",
+		"/deckhouse/ee",
+		"Path of the repo the bundle is served at.",
+	)
+	flagSet.StringVar(
+		&TLSCertFile,
+		"tls-cert",
+		"",
+		"Path to the TLS certificate file. Registry is served over plain HTTP if not set.",
+	)
+	flagSet.StringVar(
+		&TLSKeyFile,
+		"tls-key",
+		"",
+		"Path to the TLS private key file.",
+	)
+	flagSet.StringVarP(
+		&Username,
+		"username",
+		"u",
+		os.Getenv("D8_MIRROR_SERVE_USERNAME"),
+		"Username required to pull from the registry. Anonymous access is allowed if not set.",
+	)
+	flagSet.StringVarP(
+		&Password,
+		"password",
+		"p",
+		os.Getenv("D8_MIRROR_SERVE_PASSWORD"),
+		"Password required to pull from the registry.",
+	)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/registryserver"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var serveLong = templates.LongDesc(`
+Serve Deckhouse Kubernetes Platform distribution bundle as a read-only container registry.
+
+This command starts the OCI Distribution compatible registry backed directly by the bundle
+without unpacking it. Images are served at the same repository paths that d8 mirror push
+would push them to, relative to --repo-path. It is meant to bootstrap air-gapped clusters
+until the real registry is deployed.
+
+Bundle may be passed as a tar archive, chunked tar archive or unpacked directory.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	serveCmd := &cobra.Command{
+		Use:           "serve <images-bundle-path>",
+		Short:         "Serve Deckhouse Kubernetes Platform distribution bundle as a read-only registry",
+		Long:          serveLong,
+		ValidArgs:     []string{"images-bundle-path"},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          serve,
+	}
+
+	addFlags(serveCmd.Flags())
+	return serveCmd
+}
+
+var (
+	BundlePath string
+
+	ListenAddress string
+	RepoPath      string
+	TLSCertFile   string
+	TLSKeyFile    string
+	Username      string
+	Password      string
+)
+
+func serve(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+	logger := log.NewSLogger(logLevel)
+
+	bundleFS, err := bundle.OpenFS(BundlePath)
+	if err != nil {
+		return fmt.Errorf("Open %s: %w", BundlePath, err)
+	}
+	defer bundleFS.Close()
+
+	registryServer, err := registryserver.New(bundleFS, registryserver.Options{
+		RepoPath: RepoPath,
+		Username: Username,
+		Password: Password,
+		Logger:   logger,
+	})
+	if err != nil {
+		return fmt.Errorf("Load bundle: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:              ListenAddress,
+		Handler:           registryServer,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	scheme := "http"
+	if TLSCertFile != "" {
+		scheme = "https"
+	}
+	logger.InfoF("Serving %s at %s://%s%s", BundlePath, scheme, ListenAddress, RepoPath)
+
+	if TLSCertFile != "" {
+		err = server.ListenAndServeTLS(TLSCertFile, TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Serve registry: %w", err)
+	}
+	return nil
+}
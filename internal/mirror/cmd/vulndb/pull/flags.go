@@ -48,6 +48,12 @@ func addFlags(flagSet *pflag.FlagSet) {
 		os.Getenv("D8_MIRROR_LICENSE_TOKEN"),
 		"Deckhouse license key.",
 	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases.",
+	)
 	flagSet.BoolVar(
 		&TLSSkipVerify,
 		"tls-skip-verify",
@@ -17,17 +17,25 @@ limitations under the License.
 package pull
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
 	"k8s.io/kubectl/pkg/util/templates"
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/vulndb"
 )
 
 const (
@@ -40,6 +48,17 @@ const (
 var pullLong = templates.LongDesc(`
 Pull vulnerability databases to the local filesystem.
 
+Databases are updated daily. Pull into the directory with databases pulled earlier downloads only the databases that
+were changed since then. Build time and the time of the next update of the pulled databases are written to vulndb.json
+in the directory, "d8 mirror vuln-db status" shows how old the databases pushed to the registry are.
+
+Databases of other scanners may be pulled along with the Trivy ones with --security-artifacts, like:
+  artifacts:
+    - name: grype-db
+      tag: v6
+    - name: trivy-checks
+      disabled: true
+
 LICENSE NOTE:
 The d8 mirror functionality is exclusively available to users holding a 
 valid license for any commercial version of the Deckhouse Kubernetes Platform.
@@ -70,6 +89,9 @@ var (
 	VulnerabilityDBPath string
 	LicenseToken        string
 
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
 	TLSSkipVerify bool
 	Insecure      bool
 )
@@ -88,33 +110,72 @@ func pull(_ *cobra.Command, _ []string) error {
 			DeckhouseRegistryRepo: SourceRegistryRepo,
 			Insecure:              Insecure,
 			SkipTLSVerification:   TLSSkipVerify,
+			SecurityArtifacts:     securityArtifacts,
 		},
 	}
 
 	var err error
 	imageLayouts := &layouts.ImageLayouts{}
 
-	imageLayouts.TrivyDB, err = layouts.CreateEmptyImageLayoutAtPath(filepath.Join(VulnerabilityDBPath, "trivy-db"))
-	if err != nil {
-		return fmt.Errorf("creating trivy db layout: %w", err)
-	}
-	imageLayouts.TrivyBDU, err = layouts.CreateEmptyImageLayoutAtPath(filepath.Join(VulnerabilityDBPath, "trivy-bdu"))
+	imageLayouts.Security, err = layouts.CreateSecurityLayouts(VulnerabilityDBPath, pullContext.Security())
 	if err != nil {
-		return fmt.Errorf("creating bdu layout: %w", err)
+		return fmt.Errorf("create security artifacts layouts: %w", err)
 	}
-	imageLayouts.TrivyJavaDB, err = layouts.CreateEmptyImageLayoutAtPath(filepath.Join(VulnerabilityDBPath, "trivy-java-db"))
-	if err != nil {
-		return fmt.Errorf("creating java db layout: %w", err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := layouts.PullTrivyVulnerabilityDatabasesImagesContext(ctx, pullContext, imageLayouts); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("Pull interrupted, databases pulled so far are kept in %s", VulnerabilityDBPath)
+		}
+		return fmt.Errorf("pull vulnerability databases: %w", err)
 	}
-	imageLayouts.TrivyChecks, err = layouts.CreateEmptyImageLayoutAtPath(filepath.Join(VulnerabilityDBPath, "trivy-checks"))
-	if err != nil {
-		return fmt.Errorf("creating java db layout: %w", err)
+
+	return writeBundleMetadata(pullContext)
+}
+
+// writeBundleMetadata records what databases are in the bundle now and drops blobs of the databases replaced by the pull.
+func writeBundleMetadata(pullContext *contexts.PullContext) error {
+	logger := pullContext.Logger
+	previousDigests := map[string]string{}
+	if previous, err := vulndb.ReadBundleMetadata(VulnerabilityDBPath); err == nil {
+		for _, db := range previous.Databases {
+			previousDigests[db.Name] = db.Digest
+		}
 	}
 
-	if err := layouts.PullTrivyVulnerabilityDatabasesImages(pullContext, imageLayouts); err != nil {
-		return fmt.Errorf("pull vulnerability databases: %w", err)
+	now := time.Now()
+	metadata := &vulndb.BundleMetadata{PulledAt: now.UTC()}
+	for _, db := range pullContext.Security() {
+		dbLayout := layout.Path(filepath.Join(VulnerabilityDBPath, db.Name))
+		if err := layouts.DeleteUnreferencedBlobs(dbLayout); err != nil {
+			return fmt.Errorf("cleanup %s layout: %w", db.Name, err)
+		}
+
+		status, err := vulndb.StatusFromLayout(dbLayout, db)
+		if err != nil {
+			return fmt.Errorf("read %s metadata: %w", db.Name, err)
+		}
+		metadata.Databases = append(metadata.Databases, *status)
+
+		switch {
+		case status.Missing:
+			logger.WarnF("%s:%s is not found in the source registry", db.Name, db.Tag)
+			continue
+		case previousDigests[db.Name] == status.Digest:
+			logger.InfoF("%s:%s is unchanged since the previous pull", db.Name, db.Tag)
+		default:
+			logger.InfoF("%s:%s is updated", db.Name, db.Tag)
+		}
+		if status.UpdatedAt != nil {
+			logger.InfoF("  built at %s, next update at %s", status.UpdatedAt.Format(time.RFC3339), status.NextUpdate.Format(time.RFC3339))
+		}
 	}
 
+	if err := vulndb.WriteBundleMetadata(VulnerabilityDBPath, metadata); err != nil {
+		return fmt.Errorf("write %s: %w", vulndb.MetadataFileName, err)
+	}
 	return nil
 }
 
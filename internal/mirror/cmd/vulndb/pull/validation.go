@@ -24,6 +24,8 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 )
 
 func parseAndValidateParameters(_ *cobra.Command, args []string) error {
@@ -36,6 +38,12 @@ func parseAndValidateParameters(_ *cobra.Command, args []string) error {
 		return err
 	}
 
+	if SecurityArtifactsPath != "" {
+		if securityArtifacts, err = security.Load(SecurityArtifactsPath); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -35,6 +35,12 @@ func addFlags(flagSet *pflag.FlagSet) {
 		os.Getenv("D8_MIRROR_REGISTRY_PASSWORD"),
 		"Source registry password.",
 	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases.",
+	)
 	flagSet.BoolVar(
 		&TLSSkipVerify,
 		"tls-skip-verify",
@@ -21,6 +21,7 @@ import (
 	"log/slog"
 	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
@@ -29,7 +30,9 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/vulndb"
 )
 
 var pushLong = templates.LongDesc(`
@@ -66,6 +69,9 @@ var (
 
 	VulnerabilityDBPath string
 
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
 	TLSSkipVerify bool
 	Insecure      bool
 )
@@ -86,14 +92,15 @@ func push(_ *cobra.Command, _ []string) error {
 			DeckhouseRegistryRepo: RegistryRepo,
 			Insecure:              Insecure,
 			SkipTLSVerification:   TLSSkipVerify,
+			SecurityArtifacts:     securityArtifacts,
 		},
 	}
 
-	layoutsPathsAndRepos := map[string]string{
-		path.Join(RegistryRepo, "security", "trivy-db"):      filepath.Join(VulnerabilityDBPath, "trivy-db"),
-		path.Join(RegistryRepo, "security", "trivy-bdu"):     filepath.Join(VulnerabilityDBPath, "trivy-bdu"),
-		path.Join(RegistryRepo, "security", "trivy-java-db"): filepath.Join(VulnerabilityDBPath, "trivy-java-db"),
-		path.Join(RegistryRepo, "security", "trivy-checks"):  filepath.Join(VulnerabilityDBPath, "trivy-checks"),
+	warnAboutStaleDatabases(logger)
+
+	layoutsPathsAndRepos := make(map[string]string, len(pushContext.Security()))
+	for _, artifact := range pushContext.Security() {
+		layoutsPathsAndRepos[path.Join(RegistryRepo, "security", artifact.Name)] = filepath.Join(VulnerabilityDBPath, artifact.Name)
 	}
 
 	repoCount := 0
@@ -125,6 +132,23 @@ func push(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
+// warnAboutStaleDatabases tells if the bundle is already outdated, bundles pulled by older d8 versions have no metadata to check.
+func warnAboutStaleDatabases(logger contexts.Logger) {
+	metadata, err := vulndb.ReadBundleMetadata(VulnerabilityDBPath)
+	if err != nil {
+		logger.DebugF("Read %s: %v", vulndb.MetadataFileName, err)
+		return
+	}
+
+	now := time.Now()
+	for _, db := range metadata.Databases {
+		if db.Freshness(now) == vulndb.FreshnessStale {
+			logger.WarnF("%s:%s in the bundle is stale, it was built %s ago and was due for an update at %s",
+				db.Name, db.Tag, db.Age(now).Round(time.Hour), db.NextUpdate.Format(time.RFC3339))
+		}
+	}
+}
+
 func getRegistryAuthProvider() authn.Authenticator {
 	if RegistryLogin != "" {
 		return authn.FromConfig(authn.AuthConfig{
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+func addFlags(flagSet *pflag.FlagSet) {
+	flagSet.StringVar(
+		&RegistryRepo,
+		"registry",
+		"",
+		"Registry repo vulnerability databases were pushed to, like registry.example.com/deckhouse/ee.",
+	)
+	flagSet.StringVarP(
+		&RegistryLogin,
+		"registry-login",
+		"u",
+		os.Getenv("D8_MIRROR_REGISTRY_LOGIN"),
+		"Username to log into the registry.",
+	)
+	flagSet.StringVarP(
+		&RegistryPassword,
+		"registry-password",
+		"p",
+		os.Getenv("D8_MIRROR_REGISTRY_PASSWORD"),
+		"Password to log into the registry.",
+	)
+	flagSet.StringVarP(
+		&OutputFormat,
+		"output",
+		"o",
+		"table",
+		"Output format, one of: table, json.",
+	)
+	flagSet.StringVar(
+		&SecurityArtifactsPath,
+		"security-artifacts",
+		"",
+		"Path to the YAML file that changes the set of security artifacts, like vulnerability databases.",
+	)
+	flagSet.BoolVar(
+		&TLSSkipVerify,
+		"tls-skip-verify",
+		false,
+		"Disable TLS certificate validation.",
+	)
+	flagSet.BoolVar(
+		&Insecure,
+		"insecure",
+		false,
+		"Interact with registries over HTTP.",
+	)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/vulndb"
+)
+
+var statusLong = templates.LongDesc(`
+Show how old the vulnerability databases in the third-party registry are.
+
+Databases are looked up in the security repositories under the registry repo they were pushed to with
+"d8 mirror vuln-db push". Build time and the time of the next update are read from the metadata of each database,
+database is stale if its next update is already due. Databases without metadata, like trivy-checks,
+are of unknown freshness.
+
+LICENSE NOTE:
+The d8 mirror functionality is exclusively available to users holding a 
+valid license for any commercial version of the Deckhouse Kubernetes Platform.
+
+© Flant JSC 2024`)
+
+func NewCommand() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:           "status",
+		Short:         "Show how old the vulnerability databases in the third-party registry are",
+		Long:          statusLong,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRunE:       parseAndValidateParameters,
+		RunE:          status,
+	}
+
+	addFlags(statusCmd.Flags())
+	return statusCmd
+}
+
+var (
+	RegistryRepo     string
+	RegistryLogin    string
+	RegistryPassword string
+
+	OutputFormat string
+
+	SecurityArtifactsPath string
+	securityArtifacts     []security.Artifact
+
+	TLSSkipVerify bool
+	Insecure      bool
+)
+
+func status(_ *cobra.Command, _ []string) error {
+	logLevel := slog.LevelInfo
+	if log.DebugLogLevel() >= 3 {
+		logLevel = slog.LevelDebug
+	}
+
+	mirrorCtx := &contexts.BaseContext{
+		Logger:              log.NewSLogger(logLevel),
+		RegistryAuth:        getRegistryAuthProvider(),
+		Insecure:            Insecure,
+		SkipTLSVerification: TLSSkipVerify,
+		SecurityArtifacts:   securityArtifacts,
+	}
+
+	statuses := make([]vulndb.Status, 0, len(mirrorCtx.Security()))
+	for _, db := range mirrorCtx.Security() {
+		dbStatus, err := vulndb.StatusFromRegistry(context.Background(), mirrorCtx, RegistryRepo, db)
+		if err != nil {
+			return fmt.Errorf("Get %s status: %w", db.Name, err)
+		}
+		statuses = append(statuses, *dbStatus)
+	}
+
+	if OutputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+
+	printStatuses(os.Stdout, statuses, time.Now())
+	return nil
+}
+
+func printStatuses(w io.Writer, statuses []vulndb.Status, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATABASE\tBUILT\tNEXT UPDATE\tAGE\tSTATUS")
+	for _, dbStatus := range statuses {
+		built, nextUpdate, age := "-", "-", "-"
+		if dbStatus.UpdatedAt != nil {
+			built = dbStatus.UpdatedAt.Format(time.RFC3339)
+			nextUpdate = dbStatus.NextUpdate.Format(time.RFC3339)
+			age = dbStatus.Age(now).Round(time.Minute).String()
+		}
+		fmt.Fprintf(tw, "%s:%s\t%s\t%s\t%s\t%s\n", dbStatus.Name, dbStatus.Tag, built, nextUpdate, age, dbStatus.Freshness(now))
+	}
+	_ = tw.Flush()
+}
+
+func getRegistryAuthProvider() authn.Authenticator {
+	if RegistryLogin != "" {
+		return authn.FromConfig(authn.AuthConfig{
+			Username: RegistryLogin,
+			Password: RegistryPassword,
+		})
+	}
+
+	return authn.Anonymous
+}
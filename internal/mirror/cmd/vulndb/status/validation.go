@@ -0,0 +1,69 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+)
+
+func parseAndValidateParameters(_ *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("accepts no arguments, received %d", len(args))
+	}
+
+	var err error
+	if err = validateRegistryFlag(); err != nil {
+		return err
+	}
+	if RegistryPassword != "" && RegistryLogin == "" {
+		return errors.New("registry username not specified")
+	}
+	if OutputFormat != "table" && OutputFormat != "json" {
+		return fmt.Errorf("unknown output format %q", OutputFormat)
+	}
+	if SecurityArtifactsPath != "" {
+		if securityArtifacts, err = security.Load(SecurityArtifactsPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRegistryFlag() error {
+	RegistryRepo = strings.NewReplacer("http://", "", "https://", "").Replace(RegistryRepo)
+	if RegistryRepo == "" {
+		return errors.New("--registry is required")
+	}
+
+	registryUrl, err := url.ParseRequestURI("docker://" + RegistryRepo)
+	if err != nil {
+		return fmt.Errorf("Validate registry address: %w", err)
+	}
+	if registryUrl.Host == "" {
+		return errors.New("--registry you provided contains no registry host. Please specify registry address correctly.")
+	}
+
+	return nil
+}
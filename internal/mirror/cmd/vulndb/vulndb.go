@@ -22,6 +22,7 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/vulndb/pull"
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/vulndb/push"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/vulndb/status"
 )
 
 var trivyDBLong = templates.LongDesc(`
@@ -44,6 +45,7 @@ func NewCommand() *cobra.Command {
 	trivyDBCmd.AddCommand(
 		pull.NewCommand(),
 		push.NewCommand(),
+		status.NewCommand(),
 	)
 
 	return trivyDBCmd
@@ -18,19 +18,26 @@ package manifests
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
-	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/yaml"
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/api/v1alpha1"
-	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
 )
 
@@ -39,59 +46,86 @@ func GenerateDeckhouseReleaseManifestsForVersions(
 	pathToManifestYAML string,
 	releaseChannelsImagesLayout layout.Path,
 ) error {
+	deckhouseReleases, err := DeckhouseReleasesForVersions(versionsToMirror, releaseChannelsImagesLayout)
+	if err != nil {
+		return err
+	}
+
+	objects := make([]any, 0, len(deckhouseReleases))
+	for _, deckhouseRelease := range deckhouseReleases {
+		objects = append(objects, deckhouseRelease)
+	}
+	return writeManifestsFile(pathToManifestYAML, "DeckhouseReleases", objects)
+}
+
+// writeManifestsFile writes objects to the multi-document YAML file, kind is used in error messages.
+func writeManifestsFile(pathToManifestYAML, kind string, objects []any) error {
 	// It feels like most of the time manifests yaml length would not exceed the size of 4 KiB buffer,
 	// so let's preallocate that ahead of time to avoid reallocs.
 	// I have no scientific reasoning to back this up.
 	manifests := &bytes.Buffer{}
 	manifests.Grow(4 * 1024)
-	for _, version := range versionsToMirror {
-		versionReleaseImage, err := layouts.FindImageByTag(releaseChannelsImagesLayout, "v"+version.String())
-		releaseData, err := extractReleaseInfoForDeckhouseRelease(versionReleaseImage)
-		if err != nil {
-			return fmt.Errorf("Build manifest for version %q: %w", version, err)
-		}
-
-		releaseManifest, err := generateDeckhouseRelease(version, releaseData)
+	for _, object := range objects {
+		manifest, err := yaml.Marshal(object)
 		if err != nil {
-			return fmt.Errorf("Build manifest for version %q: %w", version, err)
+			return fmt.Errorf("Marshal %s manifest: %w", kind, err)
 		}
 
-		manifests.Write(releaseManifest)
+		manifests.WriteString("---\n")
+		manifests.Write(manifest)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(pathToManifestYAML), 0o775); err != nil {
-		return fmt.Errorf("Create DeckhouseReleases manifest file: %w", err)
+		return fmt.Errorf("Create %s manifest file: %w", kind, err)
 	}
 	manifestFile, err := os.Create(pathToManifestYAML)
 	if err != nil {
-		return fmt.Errorf("Create DeckhouseReleases manifest file: %w", err)
+		return fmt.Errorf("Create %s manifest file: %w", kind, err)
 	}
 
 	if _, err = io.Copy(manifestFile, manifests); err != nil {
-		return fmt.Errorf("Write DeckhouseReleases manifest file: %w", err)
+		return fmt.Errorf("Write %s manifest file: %w", kind, err)
 	}
 
 	if err = manifestFile.Sync(); err != nil {
-		return fmt.Errorf("Write DeckhouseReleases manifest file: %w", err)
+		return fmt.Errorf("Write %s manifest file: %w", kind, err)
 	}
 	if err = manifestFile.Close(); err != nil {
-		return fmt.Errorf("Write DeckhouseReleases manifest file: %w", err)
+		return fmt.Errorf("Write %s manifest file: %w", kind, err)
 	}
 
 	return nil
 }
 
-func generateDeckhouseRelease(version semver.Version, releaseInfo *releaseInfo) ([]byte, error) {
-	const githubReleaseChangelogLinkBase = "https://github.com/deckhouse/deckhouse/releases/tag"
-	versionTag := "v" + version.String()
+// DeckhouseReleasesForVersions builds DeckhouseRelease objects from the release information of the versions in the layout.
+func DeckhouseReleasesForVersions(
+	versions []semver.Version,
+	releaseChannelsImagesLayout layout.Path,
+) ([]*v1alpha1.DeckhouseRelease, error) {
+	result := make([]*v1alpha1.DeckhouseRelease, 0, len(versions))
+	for _, version := range versions {
+		versionReleaseImage, err := layouts.FindImageByTag(releaseChannelsImagesLayout, "v"+version.String())
+		if err != nil {
+			return nil, fmt.Errorf("Build manifest for version %q: %w", version, err)
+		}
+		if versionReleaseImage == nil {
+			return nil, fmt.Errorf("Build manifest for version %q: release image is not found", version)
+		}
+		releaseData, err := releases.ExtractReleaseInfo(versionReleaseImage)
+		if err != nil {
+			return nil, fmt.Errorf("Build manifest for version %q: %w", version, err)
+		}
 
-	var disruptions []string
-	if len(releaseInfo.Disruptions) > 0 {
-		disruptionsVersion := fmt.Sprintf("%d.%d", version.Major(), version.Minor())
-		disruptions = releaseInfo.Disruptions[disruptionsVersion]
+		result = append(result, makeDeckhouseRelease(version, releaseData))
 	}
+	return result, nil
+}
 
-	manifest, err := yaml.Marshal(&v1alpha1.DeckhouseRelease{
+func makeDeckhouseRelease(version semver.Version, releaseInfo *releases.ReleaseInfo) *v1alpha1.DeckhouseRelease {
+	const githubReleaseChangelogLinkBase = "https://github.com/deckhouse/deckhouse/releases/tag"
+	versionTag := "v" + version.String()
+
+	return &v1alpha1.DeckhouseRelease{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "DeckhouseRelease",
 			APIVersion: "deckhouse.io/v1alpha1",
@@ -101,44 +135,165 @@ func generateDeckhouseRelease(version semver.Version, releaseInfo *releaseInfo)
 		},
 		Spec: v1alpha1.DeckhouseReleaseSpec{
 			Version:       versionTag,
-			Requirements:  releaseInfo.Requirements,
-			Disruptions:   disruptions,
+			Requirements:  releaseInfo.Requirements.Flat(),
+			Disruptions:   releaseInfo.DisruptionsForVersion(&version),
 			Changelog:     releaseInfo.Changelog,
 			ChangelogLink: fmt.Sprintf("%s/%s", githubReleaseChangelogLinkBase, versionTag),
 		},
-	})
+	}
+}
+
+// BundledDeckhouseReleaseVersions returns versions of Deckhouse in the release channels layout of the bundle.
+// Bundles with the single release have no release channels, the cluster should not be offered their releases,
+// so no versions are returned for them.
+func BundledDeckhouseReleaseVersions(releaseChannelsImagesLayout layout.Path) ([]semver.Version, error) {
+	index, err := releaseChannelsImagesLayout.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("Read release channels index: %w", err)
+	}
+	indexManifest, err := index.IndexManifest()
 	if err != nil {
-		return nil, fmt.Errorf("Marshal DeckhouseRelease: %w", err)
+		return nil, fmt.Errorf("Read release channels index: %w", err)
 	}
 
-	return append([]byte("---\n"), manifest...), nil
+	versions := make([]semver.Version, 0)
+	hasChannels := false
+	for _, imageManifest := range indexManifest.Manifests {
+		imageRef := imageManifest.Annotations["org.opencontainers.image.ref.name"]
+		tag := imageRef[strings.LastIndex(imageRef, ":")+1:]
+		if !strings.HasPrefix(tag, "v") {
+			hasChannels = hasChannels || tag != ""
+			continue
+		}
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, *version)
+	}
+	if !hasChannels {
+		return nil, nil
+	}
+
+	slices.SortFunc(versions, func(a, b semver.Version) int { return a.Compare(&b) })
+	return versions, nil
 }
 
-type releaseInfo struct {
-	Changelog    map[string]any      `yaml:"-"`
-	Disruptions  map[string][]string `yaml:"disruptions"`
-	Requirements map[string]string   `yaml:"requirements"`
+// DeckhouseReleasesDiff tells which of the bundled releases are missing from the cluster.
+type DeckhouseReleasesDiff struct {
+	Missing []*v1alpha1.DeckhouseRelease
+	// Phases of the releases that are already in the cluster by release names.
+	Existing map[string]string
+	// Spec fields of the releases in the cluster that differ from the bundled releases, by release names.
+	Changed map[string][]string
 }
 
-func extractReleaseInfoForDeckhouseRelease(versionReleaseImage v1.Image) (*releaseInfo, error) {
-	rawChangelog, err := images.ExtractFileFromImage(versionReleaseImage, "changelog.yaml")
+// deckhouseReleaseSpecFields are the spec fields of the bundled releases, applyAfter is set by Deckhouse itself.
+var deckhouseReleaseSpecFields = []string{"version", "requirements", "disruptions", "changelog", "changelogLink"}
+
+// DiffDeckhouseReleases looks up the releases in the cluster and compares their specs with the bundled ones.
+func DiffDeckhouseReleases(
+	ctx context.Context,
+	client dynamic.Interface,
+	deckhouseReleases []*v1alpha1.DeckhouseRelease,
+) (*DeckhouseReleasesDiff, error) {
+	diff := &DeckhouseReleasesDiff{Existing: map[string]string{}, Changed: map[string][]string{}}
+	for _, deckhouseRelease := range deckhouseReleases {
+		obj, err := client.Resource(v1alpha1.DeckhouseReleaseGVR).Get(ctx, deckhouseRelease.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			diff.Missing = append(diff.Missing, deckhouseRelease)
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("Get DeckhouseRelease %s: %w", deckhouseRelease.Name, err)
+		}
+
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		diff.Existing[deckhouseRelease.Name] = phase
+		changedFields, err := diffDeckhouseReleaseSpec(deckhouseRelease, obj)
+		if err != nil {
+			return nil, fmt.Errorf("Compare DeckhouseRelease %s: %w", deckhouseRelease.Name, err)
+		}
+		if len(changedFields) > 0 {
+			diff.Changed[deckhouseRelease.Name] = changedFields
+		}
+	}
+	return diff, nil
+}
+
+func diffDeckhouseReleaseSpec(bundled *v1alpha1.DeckhouseRelease, inCluster *unstructured.Unstructured) ([]string, error) {
+	bundledSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&bundled.Spec)
 	if err != nil {
-		return nil, fmt.Errorf("Extract changelog from release image: %w", err)
+		return nil, err
 	}
-	rawReleaseData, err := images.ExtractFileFromImage(versionReleaseImage, "version.json")
+	clusterSpec, _, err := unstructured.NestedMap(inCluster.Object, "spec")
 	if err != nil {
-		return nil, fmt.Errorf("Extract release data from release image: %w", err)
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for _, field := range deckhouseReleaseSpecFields {
+		// Values are compared as JSON, as numbers and nested objects are typed differently in both specs.
+		bundledValue, err := json.Marshal(bundledSpec[field])
+		if err != nil {
+			return nil, err
+		}
+		clusterValue, err := json.Marshal(clusterSpec[field])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(bundledValue, clusterValue) {
+			changed = append(changed, field)
+		}
 	}
+	return changed, nil
+}
 
-	release := &releaseInfo{
-		Changelog: make(map[string]any),
+// Print writes releases to be created with + and releases that are skipped as they are already in the cluster,
+// along with the fields in which they differ from the bundled releases.
+func (d *DeckhouseReleasesDiff) Print(w io.Writer) {
+	for _, deckhouseRelease := range d.Missing {
+		fmt.Fprintf(w, "+ DeckhouseRelease %s\n", deckhouseRelease.Name)
 	}
-	if err = yaml.Unmarshal(rawReleaseData.Bytes(), release); err != nil {
-		return nil, fmt.Errorf("Extract release data from release image: %w", err)
+	names := make([]string, 0, len(d.Existing))
+	for name := range d.Existing {
+		names = append(names, name)
 	}
-	if err = yaml.Unmarshal(rawChangelog.Bytes(), &release.Changelog); err != nil {
-		return nil, fmt.Errorf("Extract release data from release image: %w", err)
+	slices.Sort(names)
+	for _, name := range names {
+		phase := d.Existing[name]
+		if phase == "" {
+			phase = "no phase"
+		}
+		if changedFields := d.Changed[name]; len(changedFields) > 0 {
+			fmt.Fprintf(w, "~ DeckhouseRelease %s is already in the cluster (%s) and differs from the bundle in %s, skipped\n",
+				name, phase, strings.Join(changedFields, ", "))
+			continue
+		}
+		fmt.Fprintf(w, "  DeckhouseRelease %s is already in the cluster (%s), skipped\n", name, phase)
 	}
+}
 
-	return release, nil
+// ApplyDeckhouseReleases creates the releases in the cluster with server-side apply.
+// Only the spec is applied, status of the release is managed by Deckhouse.
+func ApplyDeckhouseReleases(ctx context.Context, client dynamic.Interface, deckhouseReleases []*v1alpha1.DeckhouseRelease) error {
+	for _, deckhouseRelease := range deckhouseReleases {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deckhouseRelease)
+		if err != nil {
+			return fmt.Errorf("Convert DeckhouseRelease %s: %w", deckhouseRelease.Name, err)
+		}
+		unstructured.RemoveNestedField(content, "status")
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+
+		_, err = client.Resource(v1alpha1.DeckhouseReleaseGVR).Apply(
+			ctx,
+			deckhouseRelease.Name,
+			&unstructured.Unstructured{Object: content},
+			metav1.ApplyOptions{FieldManager: FieldManager},
+		)
+		if err != nil {
+			return fmt.Errorf("Apply DeckhouseRelease %s: %w", deckhouseRelease.Name, err)
+		}
+	}
+	return nil
 }
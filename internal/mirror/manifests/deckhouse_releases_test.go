@@ -17,6 +17,8 @@ limitations under the License.
 package manifests
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,8 +31,16 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/yaml"
 
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/api/v1alpha1"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
 )
 
@@ -248,3 +258,113 @@ func createDeckhouseReleaseChannelImage(t *testing.T, version string) v1.Image {
 	require.NoError(t, err)
 	return img
 }
+
+func TestGenerateDeckhouseReleaseManifestsRequiresChangelog(t *testing.T) {
+	releaseChannelsLayout, err := layouts.CreateEmptyImageLayoutAtPath(filepath.Join(t.TempDir(), "layout"))
+	require.NoError(t, err)
+
+	versionInfo, err := crane.Layer(map[string][]byte{"version.json": []byte(`{"version":"v1.57.3"}`)})
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, versionInfo)
+	require.NoError(t, err)
+	require.NoError(t, releaseChannelsLayout.AppendImage(img, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "release-channel:v1.57.3",
+	})))
+
+	err = GenerateDeckhouseReleaseManifestsForVersions(
+		[]semver.Version{*semver.MustParse("v1.57.3")},
+		filepath.Join(t.TempDir(), "releases.yaml"),
+		releaseChannelsLayout,
+	)
+	require.ErrorContains(t, err, "changelog.yaml")
+}
+
+func TestBundledDeckhouseReleaseVersions(t *testing.T) {
+	releaseChannelsLayout, err := layouts.CreateEmptyImageLayoutAtPath(t.TempDir())
+	require.NoError(t, err)
+	for _, tag := range []string{"v1.57.5", "v1.56.12", "v1.58.1"} {
+		require.NoError(t, releaseChannelsLayout.AppendImage(
+			createDeckhouseReleaseChannelImage(t, tag[1:]),
+			layout.WithAnnotations(map[string]string{"org.opencontainers.image.ref.name": "registry.example.com/release-channel:" + tag}),
+		))
+	}
+
+	versions, err := BundledDeckhouseReleaseVersions(releaseChannelsLayout)
+	require.NoError(t, err)
+	require.Nil(t, versions, "Single release bundles should not offer releases")
+
+	require.NoError(t, releaseChannelsLayout.AppendImage(
+		createDeckhouseReleaseChannelImage(t, "1.58.1"),
+		layout.WithAnnotations(map[string]string{"org.opencontainers.image.ref.name": "registry.example.com/release-channel:stable"}),
+	))
+	versions, err = BundledDeckhouseReleaseVersions(releaseChannelsLayout)
+	require.NoError(t, err)
+	require.Equal(t, []semver.Version{
+		*semver.MustParse("v1.56.12"),
+		*semver.MustParse("v1.57.5"),
+		*semver.MustParse("v1.58.1"),
+	}, versions)
+}
+
+func TestDiffAndApplyDeckhouseReleases(t *testing.T) {
+	deckhouseReleases := []*v1alpha1.DeckhouseRelease{
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1.56.12"}, Spec: v1alpha1.DeckhouseReleaseSpec{
+			Version:   "v1.56.12",
+			Changelog: map[string]interface{}{"candi": map[string]interface{}{"fixes": []interface{}{"Fix A"}}},
+		}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1.57.5"}, Spec: v1alpha1.DeckhouseReleaseSpec{
+			Version:      "v1.57.5",
+			Requirements: map[string]string{"k8s": "1.26"},
+		}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1.58.1"}, Spec: v1alpha1.DeckhouseReleaseSpec{Version: "v1.58.1"}},
+	}
+	deployed := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "deckhouse.io/v1alpha1",
+		"kind":       "DeckhouseRelease",
+		"metadata":   map[string]interface{}{"name": "v1.57.5"},
+		"spec": map[string]interface{}{
+			"version":      "v1.57.5",
+			"applyAfter":   "2024-06-01T00:00:00Z",
+			"requirements": map[string]interface{}{"k8s": "1.26"},
+		},
+		"status": map[string]interface{}{"phase": "Deployed"},
+	}}
+	superseded := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "deckhouse.io/v1alpha1",
+		"kind":       "DeckhouseRelease",
+		"metadata":   map[string]interface{}{"name": "v1.56.12"},
+		"spec": map[string]interface{}{
+			"version":   "v1.56.12",
+			"changelog": map[string]interface{}{"candi": map[string]interface{}{"fixes": []interface{}{"Fix B"}}},
+		},
+		"status": map[string]interface{}{"phase": "Superseded"},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{v1alpha1.DeckhouseReleaseGVR: "DeckhouseReleaseList"},
+		deployed, superseded,
+	)
+	applied := make([]string, 0)
+	client.PrependReactor("patch", "deckhousereleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		require.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+		require.NotContains(t, string(patch.GetPatch()), "status", "Status should be left to Deckhouse")
+		applied = append(applied, patch.GetName())
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{}}, nil
+	})
+
+	diff, err := DiffDeckhouseReleases(context.Background(), client, deckhouseReleases)
+	require.NoError(t, err)
+	require.Equal(t, []*v1alpha1.DeckhouseRelease{deckhouseReleases[2]}, diff.Missing)
+	require.Equal(t, map[string]string{"v1.56.12": "Superseded", "v1.57.5": "Deployed"}, diff.Existing)
+	require.Equal(t, map[string][]string{"v1.56.12": {"changelog"}}, diff.Changed, "applyAfter is set by Deckhouse and should not be compared")
+
+	out := &bytes.Buffer{}
+	diff.Print(out)
+	require.Equal(t, "+ DeckhouseRelease v1.58.1\n"+
+		"~ DeckhouseRelease v1.56.12 is already in the cluster (Superseded) and differs from the bundle in changelog, skipped\n"+
+		"  DeckhouseRelease v1.57.5 is already in the cluster (Deployed), skipped\n", out.String())
+
+	require.NoError(t, ApplyDeckhouseReleases(context.Background(), client, diff.Missing))
+	require.Equal(t, []string{"v1.58.1"}, applied)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifests
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/api/v1alpha1"
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
+)
+
+// GenerateModuleReleaseManifests writes ModuleRelease manifests for every version of the modules
+// in their release layouts, keyed by module names. Releases are attributed to the sourceName ModuleSource.
+func GenerateModuleReleaseManifests(
+	modulesReleasesLayouts map[string]layout.Path,
+	sourceName string,
+	pathToManifestYAML string,
+) error {
+	moduleNames := make([]string, 0, len(modulesReleasesLayouts))
+	for moduleName := range modulesReleasesLayouts {
+		moduleNames = append(moduleNames, moduleName)
+	}
+	sort.Strings(moduleNames)
+
+	objects := make([]any, 0)
+	for _, moduleName := range moduleNames {
+		moduleReleases, err := ModuleReleasesFromLayout(moduleName, sourceName, modulesReleasesLayouts[moduleName])
+		if err != nil {
+			return fmt.Errorf("Module %s: %w", moduleName, err)
+		}
+		for _, moduleRelease := range moduleReleases {
+			objects = append(objects, moduleRelease)
+		}
+	}
+
+	return writeManifestsFile(pathToManifestYAML, "ModuleReleases", objects)
+}
+
+// ModuleReleasesFromLayout builds ModuleRelease objects from the release information of the module versions
+// in the releases layout. Release channel images carry one of these versions, so they are skipped.
+// Modules may be released without changelog, such releases get an empty one.
+func ModuleReleasesFromLayout(
+	moduleName, sourceName string,
+	releasesLayout layout.Path,
+) ([]*v1alpha1.ModuleRelease, error) {
+	index, err := releasesLayout.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("Read releases index: %w", err)
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("Read releases index: %w", err)
+	}
+
+	type versionImage struct {
+		version *semver.Version
+		index   int
+	}
+	versionImages := make([]versionImage, 0, len(indexManifest.Manifests))
+	for i, imageManifest := range indexManifest.Manifests {
+		imageRef := imageManifest.Annotations["org.opencontainers.image.ref.name"]
+		tag := imageRef[strings.LastIndex(imageRef, ":")+1:]
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		versionImages = append(versionImages, versionImage{version: version, index: i})
+	}
+	slices.SortFunc(versionImages, func(a, b versionImage) int { return a.version.Compare(b.version) })
+	versionImages = slices.CompactFunc(versionImages, func(a, b versionImage) bool { return a.version.Equal(b.version) })
+
+	result := make([]*v1alpha1.ModuleRelease, 0, len(versionImages))
+	for _, versionImage := range versionImages {
+		releaseImage, err := index.Image(indexManifest.Manifests[versionImage.index].Digest)
+		if err != nil {
+			return nil, fmt.Errorf("Read release image of version %q: %w", versionImage.version, err)
+		}
+		releaseInfo, err := releases.ExtractReleaseInfoWithOptionalChangelog(releaseImage)
+		if err != nil {
+			return nil, fmt.Errorf("Read release information of version %q: %w", versionImage.version, err)
+		}
+
+		result = append(result, makeModuleRelease(moduleName, sourceName, versionImage.version, releaseInfo))
+	}
+	return result, nil
+}
+
+func makeModuleRelease(
+	moduleName, sourceName string,
+	version *semver.Version,
+	releaseInfo *releases.ReleaseInfo,
+) *v1alpha1.ModuleRelease {
+	versionTag := "v" + version.String()
+
+	return &v1alpha1.ModuleRelease{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ModuleRelease",
+			APIVersion: "deckhouse.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			// Deckhouse names releases of the modules it downloads the same way,
+			// so releases from the bundle are not downloaded again if sources are turned on later.
+			Name: moduleName + "-" + versionTag,
+			Labels: map[string]string{
+				"module": moduleName,
+				"source": sourceName,
+			},
+		},
+		Spec: v1alpha1.ModuleReleaseSpec{
+			ModuleName:   moduleName,
+			Version:      versionTag,
+			Requirements: moduleReleaseRequirements(releaseInfo.Requirements),
+			Disruptions:  releaseInfo.DisruptionsForVersion(version),
+			Changelog:    releaseInfo.Changelog,
+		},
+	}
+}
+
+func moduleReleaseRequirements(requirements releases.Requirements) *v1alpha1.ModuleReleaseRequirements {
+	if requirements.Deckhouse == "" && requirements.Kubernetes == "" && len(requirements.Modules) == 0 {
+		return nil
+	}
+	return &v1alpha1.ModuleReleaseRequirements{
+		Deckhouse:  requirements.Deckhouse,
+		Kubernetes: requirements.Kubernetes,
+		Modules:    requirements.Modules,
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+)
+
+func TestGenerateModuleReleaseManifests(t *testing.T) {
+	testDir := t.TempDir()
+	modulesReleasesLayouts := map[string]layout.Path{}
+	for moduleName, tags := range map[string][]string{
+		"console":         {"v1.3.0", "stable", "v1.2.1"},
+		"commander-agent": {"alpha"},
+	} {
+		releasesLayout, err := layouts.CreateEmptyImageLayoutAtPath(filepath.Join(testDir, moduleName, "release"))
+		require.NoError(t, err)
+		for _, tag := range tags {
+			version := tag
+			if tag == "stable" {
+				version = "v1.3.0"
+			}
+			releaseImage := createModuleReleaseImage(t, map[string][]byte{
+				"version.json": []byte(fmt.Sprintf(
+					`{"version":%q,"requirements":{"deckhouse":">= 1.60","kubernetes":">= 1.28","modules":{"cert-manager":">= 1.2"}},"disruptions":{"1.3":["console"]}}`,
+					version,
+				)),
+				"changelog.yaml": []byte(fmt.Sprintf("features:\n- Release %s\n", version)),
+			})
+			appendModuleReleaseImage(t, releasesLayout, moduleName, tag, releaseImage)
+		}
+		modulesReleasesLayouts[moduleName] = releasesLayout
+	}
+
+	// Modules may be released without changelog and requirements.
+	appendModuleReleaseImage(t, modulesReleasesLayouts["console"], "console", "v1.1.0", createModuleReleaseImage(t, map[string][]byte{
+		"version.json": []byte(`{"version":"v1.1.0"}`),
+	}))
+
+	pathToManifestFile := filepath.Join(testDir, "modulereleases.yaml")
+	require.NoError(t, GenerateModuleReleaseManifests(modulesReleasesLayouts, ModuleSourceName, pathToManifestFile))
+
+	fileContents, err := os.ReadFile(pathToManifestFile)
+	require.NoError(t, err)
+	require.Equal(t, `---
+apiVersion: deckhouse.io/v1alpha1
+kind: ModuleRelease
+metadata:
+  creationTimestamp: null
+  labels:
+    module: console
+    source: deckhouse
+  name: console-v1.1.0
+spec:
+  moduleName: console
+  version: v1.1.0
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ModuleRelease
+metadata:
+  creationTimestamp: null
+  labels:
+    module: console
+    source: deckhouse
+  name: console-v1.2.1
+spec:
+  changelog:
+    features:
+    - Release v1.2.1
+  moduleName: console
+  requirements:
+    deckhouse: '>= 1.60'
+    kubernetes: '>= 1.28'
+    modules:
+      cert-manager: '>= 1.2'
+  version: v1.2.1
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ModuleRelease
+metadata:
+  creationTimestamp: null
+  labels:
+    module: console
+    source: deckhouse
+  name: console-v1.3.0
+spec:
+  changelog:
+    features:
+    - Release v1.3.0
+  disruptions:
+  - console
+  moduleName: console
+  requirements:
+    deckhouse: '>= 1.60'
+    kubernetes: '>= 1.28'
+    modules:
+      cert-manager: '>= 1.2'
+  version: v1.3.0
+`, string(fileContents))
+}
+
+func TestGenerateModuleReleaseManifestsFailsOnUnreadableRelease(t *testing.T) {
+	testDir := t.TempDir()
+	releasesLayout, err := layouts.CreateEmptyImageLayoutAtPath(filepath.Join(testDir, "console", "release"))
+	require.NoError(t, err)
+	appendModuleReleaseImage(t, releasesLayout, "console", "v1.2.1", createModuleReleaseImage(t, map[string][]byte{
+		"version.json": []byte(`{"version":"v1.2.1","requirements":{"modules":["cert-manager"]}}`),
+	}))
+
+	err = GenerateModuleReleaseManifests(
+		map[string]layout.Path{"console": releasesLayout},
+		ModuleSourceName,
+		filepath.Join(testDir, "modulereleases.yaml"),
+	)
+	require.ErrorContains(t, err, `Module console: Read release information of version "1.2.1"`)
+	require.NoFileExists(t, filepath.Join(testDir, "modulereleases.yaml"))
+}
+
+func createModuleReleaseImage(t *testing.T, files map[string][]byte) v1.Image {
+	t.Helper()
+
+	l, err := crane.Layer(files)
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
+
+func appendModuleReleaseImage(t *testing.T, releasesLayout layout.Path, moduleName, tag string, img v1.Image) {
+	t.Helper()
+
+	require.NoError(t, releasesLayout.AppendImage(
+		img,
+		layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": "registry.example.com/modules/" + moduleName + "/release:" + tag,
+		}),
+	))
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifests
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/api/v1alpha1"
+)
+
+// RegistrySettings describe the registry Deckhouse was pushed to, as the cluster should use it.
+type RegistrySettings struct {
+	ImagesRepo  string // Deckhouse images repo without the scheme, like registry.example.com/deckhouse/ee
+	ModulesRepo string // Repo of the ModuleSource, like registry.example.com/deckhouse/ee/modules
+	Scheme      string // HTTP or HTTPS
+	Username    string // Read-only credentials of the cluster, empty for anonymous access
+	Password    string
+	CA          string // PEM encoded CA certificate of the registry, empty if nodes trust the registry certificate
+
+	Mode            string // Registry mode of the deckhouse ModuleConfig, like Direct or Unmanaged
+	SettingsVersion int    // Version of the deckhouse ModuleConfig settings
+}
+
+// FieldManager owns the fields of the objects applied to the cluster.
+const FieldManager = "d8-mirror"
+
+// ModuleSourceName is the name of the ModuleSource that installs modules of the mirrored Deckhouse.
+const ModuleSourceName = "deckhouse"
+
+// GenerateRegistryManifests makes the ModuleSource and the registry settings of the deckhouse ModuleConfig
+// that switch the cluster to the registry. Deckhouse updates its d8-system/deckhouse-registry Secret from the settings itself.
+func GenerateRegistryManifests(settings RegistrySettings) ([]*unstructured.Unstructured, error) {
+	if settings.Mode == "" || settings.SettingsVersion == 0 {
+		return nil, errors.New("registry mode and settings version of the deckhouse ModuleConfig are required")
+	}
+
+	registryHost, _, _ := strings.Cut(settings.ImagesRepo, "/")
+	dockerCfg, err := makeDockerConfig(registryHost, settings.Username, settings.Password)
+	if err != nil {
+		return nil, fmt.Errorf("Build docker config: %w", err)
+	}
+
+	moduleSource := &v1alpha1.ModuleSource{
+		TypeMeta:   metav1.TypeMeta{Kind: "ModuleSource", APIVersion: "deckhouse.io/v1alpha1"},
+		ObjectMeta: metav1.ObjectMeta{Name: ModuleSourceName},
+		Spec: v1alpha1.ModuleSourceSpec{
+			Registry: v1alpha1.ModuleSourceSpecRegistry{
+				Scheme:    settings.Scheme,
+				Repo:      settings.ModulesRepo,
+				DockerCFG: base64.StdEncoding.EncodeToString(dockerCfg),
+				CA:        settings.CA,
+			},
+		},
+	}
+
+	registry := map[string]interface{}{
+		"imagesRepo": settings.ImagesRepo,
+		"scheme":     settings.Scheme,
+	}
+	if settings.Username != "" {
+		registry["username"] = settings.Username
+		registry["password"] = settings.Password
+	}
+	if settings.CA != "" {
+		registry["ca"] = settings.CA
+	}
+	// Settings of the mode are under its name in lower camel case, like direct or unmanaged.
+	modeSettingsKey := strings.ToLower(settings.Mode[:1]) + settings.Mode[1:]
+	moduleConfig := &v1alpha1.ModuleConfig{
+		TypeMeta:   metav1.TypeMeta{Kind: "ModuleConfig", APIVersion: "deckhouse.io/v1alpha1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "deckhouse"},
+		Spec: v1alpha1.ModuleConfigSpec{
+			Version: settings.SettingsVersion,
+			Settings: map[string]interface{}{
+				"registry": map[string]interface{}{
+					"mode":          settings.Mode,
+					modeSettingsKey: registry,
+				},
+			},
+		},
+	}
+
+	objects := make([]*unstructured.Unstructured, 0, 2)
+	for _, obj := range []interface{}{moduleSource, moduleConfig} {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("Convert %T: %w", obj, err)
+		}
+		// Objects are new, there is no point in the empty creation timestamp
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+		objects = append(objects, &unstructured.Unstructured{Object: content})
+	}
+	return objects, nil
+}
+
+// ReadRegistryModuleConfig returns the registry mode and the settings version of the deckhouse ModuleConfig in the cluster.
+// Empty mode and zero version are returned if they are not set.
+func ReadRegistryModuleConfig(ctx context.Context, client dynamic.Interface) (string, int, error) {
+	moduleConfig, err := client.Resource(v1alpha1.ModuleConfigGVR).Get(ctx, "deckhouse", metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", 0, nil
+	case err != nil:
+		return "", 0, fmt.Errorf("Get deckhouse ModuleConfig: %w", err)
+	}
+
+	mode, _, err := unstructured.NestedString(moduleConfig.Object, "spec", "settings", "registry", "mode")
+	if err != nil {
+		return "", 0, fmt.Errorf("Read registry mode of the deckhouse ModuleConfig: %w", err)
+	}
+	version, _, err := unstructured.NestedInt64(moduleConfig.Object, "spec", "version")
+	if err != nil {
+		return "", 0, fmt.Errorf("Read settings version of the deckhouse ModuleConfig: %w", err)
+	}
+	return mode, int(version), nil
+}
+
+func makeDockerConfig(registryHost, username, password string) ([]byte, error) {
+	type authConfig struct {
+		Auth string `json:"auth,omitempty"`
+	}
+	auth := authConfig{}
+	if username != "" {
+		auth.Auth = base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	}
+	return json.Marshal(map[string]map[string]authConfig{"auths": {registryHost: auth}})
+}
+
+// WriteRegistryManifests writes the objects into the YAML file at pathToManifestYAML.
+func WriteRegistryManifests(objects []*unstructured.Unstructured, pathToManifestYAML string) error {
+	manifests := &bytes.Buffer{}
+	for _, obj := range objects {
+		manifest, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return fmt.Errorf("Marshal %s: %w", obj.GetKind(), err)
+		}
+		manifests.WriteString("---\n")
+		manifests.Write(manifest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pathToManifestYAML), 0o775); err != nil {
+		return fmt.Errorf("Create registry manifests file: %w", err)
+	}
+	// Manifests hold registry credentials
+	if err := os.WriteFile(pathToManifestYAML, manifests.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("Write registry manifests file: %w", err)
+	}
+	return nil
+}
+
+// ApplyRegistryManifests applies the objects to the cluster with server-side apply. Fields of the objects
+// that are managed by others are not overridden, objects with such conflicts are reported in the error.
+func ApplyRegistryManifests(ctx context.Context, client dynamic.Interface, objects []*unstructured.Unstructured) error {
+	resources := map[string]schema.GroupVersionResource{
+		"ModuleSource": v1alpha1.ModuleSourceGVR,
+		"ModuleConfig": v1alpha1.ModuleConfigGVR,
+	}
+
+	conflicts := make([]string, 0)
+	for _, obj := range objects {
+		gvr, found := resources[obj.GetKind()]
+		if !found {
+			return fmt.Errorf("Apply %s/%s: unknown kind", obj.GetKind(), obj.GetName())
+		}
+
+		_, err := client.Resource(gvr).Namespace(obj.GetNamespace()).Apply(
+			ctx,
+			obj.GetName(),
+			obj,
+			metav1.ApplyOptions{FieldManager: FieldManager},
+		)
+		switch {
+		case apierrors.IsConflict(err):
+			conflicts = append(conflicts, fmt.Sprintf("%s/%s: %v", obj.GetKind(), obj.GetName(), err))
+		case err != nil:
+			return fmt.Errorf("Apply %s/%s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("Objects with fields set by others are not changed, update them by hand:\n%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
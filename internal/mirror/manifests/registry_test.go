@@ -0,0 +1,214 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGenerateRegistryManifests(t *testing.T) {
+	objects, err := GenerateRegistryManifests(RegistrySettings{
+		ImagesRepo:      "registry.example.com/deckhouse/ee",
+		ModulesRepo:     "registry.example.com/deckhouse/ee/modules",
+		Scheme:          "HTTPS",
+		Username:        "user",
+		Password:        "pass",
+		Mode:            "Unmanaged",
+		SettingsVersion: 1,
+	})
+	require.NoError(t, err)
+
+	manifestsPath := filepath.Join(t.TempDir(), "registry.yaml")
+	require.NoError(t, WriteRegistryManifests(objects, manifestsPath))
+	manifests, err := os.ReadFile(manifestsPath)
+	require.NoError(t, err)
+	require.Len(t, splitManifests(t, manifests), 2, "deckhouse-registry Secret is managed by Deckhouse itself")
+	// eyJhdXRocyI6... is {"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}
+	require.YAMLEq(t, `
+apiVersion: deckhouse.io/v1alpha1
+kind: ModuleSource
+metadata:
+  name: deckhouse
+spec:
+  registry:
+    scheme: HTTPS
+    repo: registry.example.com/deckhouse/ee/modules
+    dockerCfg: eyJhdXRocyI6eyJyZWdpc3RyeS5leGFtcGxlLmNvbSI6eyJhdXRoIjoiZFhObGNqcHdZWE56In19fQ==
+`, splitManifests(t, manifests)[0])
+	require.YAMLEq(t, `
+apiVersion: deckhouse.io/v1alpha1
+kind: ModuleConfig
+metadata:
+  name: deckhouse
+spec:
+  version: 1
+  settings:
+    registry:
+      mode: Unmanaged
+      unmanaged:
+        imagesRepo: registry.example.com/deckhouse/ee
+        scheme: HTTPS
+        username: user
+        password: pass
+`, splitManifests(t, manifests)[1])
+}
+
+func TestGenerateRegistryManifestsAnonymousWithCA(t *testing.T) {
+	objects, err := GenerateRegistryManifests(RegistrySettings{
+		ImagesRepo:      "registry.example.com:5000/deckhouse",
+		ModulesRepo:     "registry.example.com:5000/deckhouse-modules",
+		Scheme:          "HTTP",
+		CA:              "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n",
+		Mode:            "Direct",
+		SettingsVersion: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	dockerCfg, _, err := unstructured.NestedString(objects[0].Object, "spec", "registry", "dockerCfg")
+	require.NoError(t, err)
+	// {"auths":{"registry.example.com:5000":{}}}
+	require.Equal(t, "eyJhdXRocyI6eyJyZWdpc3RyeS5leGFtcGxlLmNvbTo1MDAwIjp7fX19", dockerCfg)
+
+	ca, _, err := unstructured.NestedString(objects[0].Object, "spec", "registry", "ca")
+	require.NoError(t, err)
+	require.Equal(t, "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n", ca)
+
+	version, _, err := unstructured.NestedInt64(objects[1].Object, "spec", "version")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version)
+	registry, _, err := unstructured.NestedMap(objects[1].Object, "spec", "settings", "registry", "direct")
+	require.NoError(t, err)
+	require.NotContains(t, registry, "username")
+	require.Equal(t, "HTTP", registry["scheme"])
+	require.Contains(t, registry, "ca")
+}
+
+func TestGenerateRegistryManifestsRequiresModeAndVersion(t *testing.T) {
+	_, err := GenerateRegistryManifests(RegistrySettings{
+		ImagesRepo:  "registry.example.com/deckhouse/ee",
+		ModulesRepo: "registry.example.com/deckhouse/ee/modules",
+		Scheme:      "HTTPS",
+	})
+	require.Error(t, err)
+}
+
+func TestReadRegistryModuleConfig(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	mode, version, err := ReadRegistryModuleConfig(context.Background(), client)
+	require.NoError(t, err)
+	require.Empty(t, mode)
+	require.Zero(t, version)
+
+	client.PrependReactor("get", "moduleconfigs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "deckhouse.io/v1alpha1",
+			"kind":       "ModuleConfig",
+			"metadata":   map[string]interface{}{"name": "deckhouse"},
+			"spec": map[string]interface{}{
+				"version":  int64(2),
+				"settings": map[string]interface{}{"registry": map[string]interface{}{"mode": "Direct"}},
+			},
+		}}, nil
+	})
+	mode, version, err = ReadRegistryModuleConfig(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, "Direct", mode)
+	require.Equal(t, 2, version)
+}
+
+func TestApplyRegistryManifests(t *testing.T) {
+	objects, err := GenerateRegistryManifests(RegistrySettings{
+		ImagesRepo:      "registry.example.com/deckhouse/ee",
+		ModulesRepo:     "registry.example.com/deckhouse/ee/modules",
+		Scheme:          "HTTPS",
+		Mode:            "Unmanaged",
+		SettingsVersion: 1,
+	})
+	require.NoError(t, err)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	applied := make([]string, 0)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		require.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+		applied = append(applied, patch.GetResource().Resource+" "+patch.GetNamespace()+"/"+patch.GetName())
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{}}, nil
+	})
+
+	require.NoError(t, ApplyRegistryManifests(context.Background(), client, objects))
+	require.Equal(t, []string{
+		"modulesources /deckhouse",
+		"moduleconfigs /deckhouse",
+	}, applied)
+}
+
+func TestApplyRegistryManifestsReportsConflicts(t *testing.T) {
+	objects, err := GenerateRegistryManifests(RegistrySettings{
+		ImagesRepo:      "registry.example.com/deckhouse/ee",
+		ModulesRepo:     "registry.example.com/deckhouse/ee/modules",
+		Scheme:          "HTTPS",
+		Mode:            "Unmanaged",
+		SettingsVersion: 1,
+	})
+	require.NoError(t, err)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	applied := make([]string, 0)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetResource().Resource == "moduleconfigs" {
+			return true, nil, apierrors.NewConflict(
+				schema.GroupResource{Group: "deckhouse.io", Resource: "moduleconfigs"}, patch.GetName(),
+				errors.New(`conflict with "kubectl": .spec.settings.registry.unmanaged.imagesRepo`),
+			)
+		}
+		applied = append(applied, patch.GetResource().Resource+" "+patch.GetNamespace()+"/"+patch.GetName())
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{}}, nil
+	})
+
+	err = ApplyRegistryManifests(context.Background(), client, objects)
+	require.ErrorContains(t, err, "ModuleConfig/deckhouse")
+	require.ErrorContains(t, err, "imagesRepo")
+	require.Equal(t, []string{"modulesources /deckhouse"}, applied, "Objects without conflicts should be applied")
+}
+
+func splitManifests(t *testing.T, manifests []byte) []string {
+	t.Helper()
+
+	docs := make([]string, 0)
+	for _, doc := range bytes.Split(manifests, []byte("---\n")) {
+		if len(bytes.TrimSpace(doc)) > 0 {
+			docs = append(docs, string(doc))
+		}
+	}
+	return docs
+}
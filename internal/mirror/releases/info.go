@@ -0,0 +1,177 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package releases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+
+	"github.com/Masterminds/semver/v3"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
+)
+
+// ReleaseInfo is the release metadata stored in version.json and changelog.yaml files of release images.
+type ReleaseInfo struct {
+	Version      string              `json:"version"`
+	Suspended    bool                `json:"suspend,omitempty"`
+	Disruptions  map[string][]string `json:"disruptions,omitempty"`
+	Requirements Requirements        `json:"requirements,omitempty"`
+	Changelog    map[string]any      `json:"-"`
+}
+
+// Requirements are the constraints the cluster must satisfy to deploy the release.
+// Module releases constrain Deckhouse and Kubernetes versions and versions of other modules,
+// Deckhouse releases have flat requirements like "k8s: 1.26", which are kept in Other.
+type Requirements struct {
+	Deckhouse  string
+	Kubernetes string
+	Modules    map[string]string
+	Other      map[string]string
+}
+
+// IsEmpty reports whether the release has no requirements.
+func (r Requirements) IsEmpty() bool {
+	return r.Deckhouse == "" && r.Kubernetes == "" && len(r.Modules) == 0 && len(r.Other) == 0
+}
+
+// Flat returns top-level requirements as they were written in version.json.
+// Requirements on modules are not included.
+func (r Requirements) Flat() map[string]string {
+	if r.Deckhouse == "" && r.Kubernetes == "" && len(r.Other) == 0 {
+		return nil
+	}
+	result := maps.Clone(r.Other)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	if r.Deckhouse != "" {
+		result["deckhouse"] = r.Deckhouse
+	}
+	if r.Kubernetes != "" {
+		result["kubernetes"] = r.Kubernetes
+	}
+	return result
+}
+
+func (r Requirements) MarshalJSON() ([]byte, error) {
+	result := make(map[string]any, len(r.Other)+3)
+	for key, value := range r.Flat() {
+		result[key] = value
+	}
+	if len(r.Modules) > 0 {
+		result["modules"] = r.Modules
+	}
+	return json.Marshal(result)
+}
+
+func (r *Requirements) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("requirements: %w", err)
+	}
+
+	*r = Requirements{}
+	for key, value := range raw {
+		if key == "modules" {
+			if err := json.Unmarshal(value, &r.Modules); err != nil {
+				return fmt.Errorf("requirement %q: %w", key, err)
+			}
+			continue
+		}
+
+		var constraint any
+		if err := json.Unmarshal(value, &constraint); err != nil {
+			return fmt.Errorf("requirement %q: %w", key, err)
+		}
+		var constraintString string
+		switch constraint := constraint.(type) {
+		case string:
+			constraintString = constraint
+		case bool, float64:
+			// Flags and numbers are kept as written, e.g. "containerdOnAllNodes: true".
+			constraintString = string(value)
+		default:
+			return fmt.Errorf("requirement %q: unsupported value %s", key, value)
+		}
+
+		switch key {
+		case "deckhouse":
+			r.Deckhouse = constraintString
+		case "kubernetes":
+			r.Kubernetes = constraintString
+		default:
+			if r.Other == nil {
+				r.Other = make(map[string]string)
+			}
+			r.Other[key] = constraintString
+		}
+	}
+	return nil
+}
+
+// DisruptionsForVersion returns the disruptions that apply to the minor release of version.
+func (r *ReleaseInfo) DisruptionsForVersion(version *semver.Version) []string {
+	if len(r.Disruptions) == 0 {
+		return nil
+	}
+	return r.Disruptions[fmt.Sprintf("%d.%d", version.Major(), version.Minor())]
+}
+
+// ExtractReleaseInfo reads version.json and changelog.yaml from the release image, both files are required.
+func ExtractReleaseInfo(releaseImage v1.Image) (*ReleaseInfo, error) {
+	return extractReleaseInfo(releaseImage, false)
+}
+
+// ExtractReleaseInfoWithOptionalChangelog is like ExtractReleaseInfo, but reads release image without changelog.yaml
+// as release with empty changelog. It is meant for showing bundle contents, where missing changelog should not
+// hide the rest of the release.
+func ExtractReleaseInfoWithOptionalChangelog(releaseImage v1.Image) (*ReleaseInfo, error) {
+	return extractReleaseInfo(releaseImage, true)
+}
+
+func extractReleaseInfo(releaseImage v1.Image, changelogOptional bool) (*ReleaseInfo, error) {
+	rawReleaseData, err := images.ExtractFileFromImage(releaseImage, "version.json")
+	if err != nil {
+		return nil, fmt.Errorf("Extract release data from release image: %w", err)
+	}
+
+	release := &ReleaseInfo{
+		Changelog: make(map[string]any),
+	}
+	if err = yaml.Unmarshal(rawReleaseData.Bytes(), release); err != nil {
+		return nil, fmt.Errorf("Extract release data from release image: %w", err)
+	}
+
+	rawChangelog, err := images.ExtractFileFromImage(releaseImage, "changelog.yaml")
+	switch {
+	case changelogOptional && errors.Is(err, fs.ErrNotExist):
+		return release, nil
+	case err != nil:
+		return nil, fmt.Errorf("Extract changelog from release image: %w", err)
+	}
+	if err = yaml.Unmarshal(rawChangelog.Bytes(), &release.Changelog); err != nil {
+		return nil, fmt.Errorf("Extract changelog from release image: %w", err)
+	}
+
+	return release, nil
+}
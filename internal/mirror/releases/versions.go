@@ -17,6 +17,7 @@ limitations under the License.
 package releases
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -33,10 +34,14 @@ import (
 )
 
 func VersionsToMirror(mirrorCtx *contexts.PullContext) ([]semver.Version, error) {
+	return VersionsToMirrorContext(context.Background(), mirrorCtx)
+}
+
+func VersionsToMirrorContext(ctx context.Context, mirrorCtx *contexts.PullContext) ([]semver.Version, error) {
 	releaseChannelsToCopy := []string{"alpha", "beta", "early-access", "stable", "rock-solid"}
 	releaseChannelsVersions := make([]*semver.Version, len(releaseChannelsToCopy))
 	for i, channel := range releaseChannelsToCopy {
-		v, err := getReleaseChannelVersionFromRegistry(mirrorCtx, channel)
+		v, err := getReleaseChannelVersionFromRegistry(ctx, mirrorCtx, channel)
 		if err != nil {
 			return nil, fmt.Errorf("get %s release version from registry: %w", channel, err)
 		}
@@ -52,7 +57,7 @@ func VersionsToMirror(mirrorCtx *contexts.PullContext) ([]semver.Version, error)
 		}
 	}
 
-	tags, err := getReleasedTagsFromRegistry(mirrorCtx)
+	tags, err := getReleasedTagsFromRegistry(ctx, mirrorCtx)
 	if err != nil {
 		return nil, fmt.Errorf("get releases from github: %w", err)
 	}
@@ -70,13 +75,13 @@ func VersionsToMirror(mirrorCtx *contexts.PullContext) ([]semver.Version, error)
 	return deduplicateVersions(append(releaseChannelsVersions, versionsAboveMinimal...)), nil
 }
 
-func getReleasedTagsFromRegistry(mirrorCtx *contexts.PullContext) ([]string, error) {
+func getReleasedTagsFromRegistry(ctx context.Context, mirrorCtx *contexts.PullContext) ([]string, error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(&mirrorCtx.BaseContext)
 	repo, err := name.NewRepository(mirrorCtx.DeckhouseRegistryRepo+"/release-channel", nameOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("parsing repo: %v", err)
 	}
-	tags, err := remote.List(repo, remoteOpts...)
+	tags, err := remote.List(repo, append(remoteOpts, remote.WithContext(ctx))...)
 	if err != nil {
 		return nil, fmt.Errorf("get tags from Deckhouse registry: %w", err)
 	}
@@ -117,7 +122,7 @@ func filterOnlyLatestPatches(versions []*semver.Version) []*semver.Version {
 	return topPatches
 }
 
-func getReleaseChannelVersionFromRegistry(mirrorCtx *contexts.PullContext, releaseChannel string) (*semver.Version, error) {
+func getReleaseChannelVersionFromRegistry(ctx context.Context, mirrorCtx *contexts.PullContext, releaseChannel string) (*semver.Version, error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(&mirrorCtx.BaseContext)
 	nameOpts = append(nameOpts, name.StrictValidation)
 
@@ -126,7 +131,7 @@ func getReleaseChannelVersionFromRegistry(mirrorCtx *contexts.PullContext, relea
 		return nil, fmt.Errorf("parse rock solid release ref: %w", err)
 	}
 
-	rockSolidReleaseImage, err := remote.Image(ref, remoteOpts...)
+	rockSolidReleaseImage, err := remote.Image(ref, append(remoteOpts, remote.WithContext(ctx))...)
 	if err != nil {
 		return nil, fmt.Errorf("get %s release channel data: %w", releaseChannel, err)
 	}
@@ -168,6 +173,15 @@ func FetchVersionsFromModuleReleaseChannels(
 	releaseChannelImages map[string]struct{},
 	authProvider authn.Authenticator,
 	insecure, skipVerifyTLS bool,
+) (map[string]string, error) {
+	return FetchVersionsFromModuleReleaseChannelsContext(context.Background(), releaseChannelImages, authProvider, insecure, skipVerifyTLS)
+}
+
+func FetchVersionsFromModuleReleaseChannelsContext(
+	ctx context.Context,
+	releaseChannelImages map[string]struct{},
+	authProvider authn.Authenticator,
+	insecure, skipVerifyTLS bool,
 ) (map[string]string, error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
 	channelVersions := map[string]string{}
@@ -178,7 +192,7 @@ func FetchVersionsFromModuleReleaseChannels(
 			return nil, fmt.Errorf("pull %q release channel: %w", imageTag, err)
 		}
 
-		img, err := remote.Image(ref, remoteOpts...)
+		img, err := remote.Image(ref, append(remoteOpts, remote.WithContext(ctx))...)
 		if err != nil {
 			if errorutil.IsImageNotFoundError(err) {
 				continue
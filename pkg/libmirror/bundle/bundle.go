@@ -30,6 +30,7 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/chunked"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/storage"
 )
 
 func Unpack(mirrorCtx *contexts.BaseContext) error {
@@ -41,38 +42,21 @@ func UnpackContext(ctx context.Context, mirrorCtx *contexts.BaseContext) error {
 		return err
 	}
 
-	bundleDir := filepath.Dir(mirrorCtx.BundlePath)
-	catalog, err := os.ReadDir(bundleDir)
+	bundleStream, err := OpenBundleStream(mirrorCtx.BundlePath)
 	if err != nil {
-		return fmt.Errorf("read tar bundle directory: %w", err)
-	}
-	streams := make([]io.Reader, 0)
-	for _, entry := range catalog {
-		if err = ctx.Err(); err != nil {
-			return err
-		}
-
-		fileName := entry.Name()
-		if !entry.Type().IsRegular() || filepath.Ext(fileName) != ".chunk" {
-			continue
-		}
-		chunkStream, err := os.Open(filepath.Join(bundleDir, fileName))
-		if err != nil {
-			return fmt.Errorf("open bundle chunk for reading: %w", err)
-		}
-		defer chunkStream.Close() // nolint // defer in a loop is valid here as we need those streams to survive until everything is unpacked at the end of this function
-		streams = append(streams, chunkStream)
+		return err
 	}
+	defer bundleStream.Close()
 
-	bundleStream := io.NopCloser(io.MultiReader(streams...))
-	if len(streams) == 0 {
-		bundleStream, err = os.Open(mirrorCtx.BundlePath)
-		if err != nil {
-			return fmt.Errorf("read tar bundle: %w", err)
-		}
+	tarStream, err := newDecompressingReader(bundleStream)
+	if err != nil {
+		return fmt.Errorf("read tar bundle: %w", err)
 	}
+	defer tarStream.Close()
 
-	tarReader := tar.NewReader(bundleStream)
+	tarReader := tar.NewReader(tarStream)
+	// Blobs extracted from this archive by their "<algorithm>/<hex>" keys, see packFunc.
+	unpackedBlobs := map[string]string{}
 	for {
 		if err = ctx.Err(); err != nil {
 			return err
@@ -82,14 +66,46 @@ func UnpackContext(ctx context.Context, mirrorCtx *contexts.BaseContext) error {
 		if errors.Is(err, io.EOF) {
 			break
 		}
-		writePath := filepath.Join(
-			mirrorCtx.UnpackedImagesPath,
-			filepath.Clean(tarHdr.Name),
-		)
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+		writePath, err := unpackPath(mirrorCtx.UnpackedImagesPath, tarHdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch tarHdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(writePath, 0o755); err != nil {
+				return fmt.Errorf("setup dir tree: %w", err)
+			}
+			continue
+		case tar.TypeReg, tar.TypeLink:
+		default:
+			return fmt.Errorf("%q: unsupported tar entry type %q", tarHdr.Name, tarHdr.Typeflag)
+		}
+
 		if err = os.MkdirAll(filepath.Dir(writePath), 0o755); err != nil {
 			return fmt.Errorf("setup dir tree: %w", err)
 		}
-		bundleFile, err := os.OpenFile(writePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+		// File may be already unpacked as a link, it is replaced so the link target is left intact.
+		if err = os.Remove(writePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("write %q: %w", writePath, err)
+		}
+
+		blobKey, isBlob := blobKeyFromPath(filepath.ToSlash(filepath.Clean(tarHdr.Name)))
+		if tarHdr.Typeflag == tar.TypeLink {
+			linkTarget, err := unpackedLinkTarget(mirrorCtx.UnpackedImagesPath, tarHdr, unpackedBlobs)
+			if err != nil {
+				return err
+			}
+			if err = linkOrCopyFile(linkTarget, writePath); err != nil {
+				return fmt.Errorf("write %q: %w", writePath, err)
+			}
+			continue
+		}
+
+		bundleFile, err := os.OpenFile(writePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
 		if err != nil {
 			return fmt.Errorf("create file: %w", err)
 		}
@@ -102,40 +118,127 @@ func UnpackContext(ctx context.Context, mirrorCtx *contexts.BaseContext) error {
 		if err = bundleFile.Close(); err != nil {
 			return fmt.Errorf("write %q: %w", writePath, err)
 		}
+		if isBlob {
+			unpackedBlobs[blobKey] = writePath
+		}
 	}
 
 	return nil
 }
 
+// unpackPath returns the path the tar entry is unpacked to, entries pointing outside the root are rejected.
+func unpackPath(root, name string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("%q: tar entry points outside the bundle", name)
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+// unpackedLinkTarget returns the path of the file the link entry points to.
+// Bundles only link copies of the blob to the same blob written earlier in the archive, other links are rejected.
+func unpackedLinkTarget(root string, tarHdr *tar.Header, unpackedBlobs map[string]string) (string, error) {
+	if _, err := unpackPath(root, tarHdr.Linkname); err != nil {
+		return "", err
+	}
+
+	blobKey, isBlob := blobKeyFromPath(filepath.ToSlash(filepath.Clean(tarHdr.Name)))
+	targetKey, targetIsBlob := blobKeyFromPath(filepath.ToSlash(filepath.Clean(tarHdr.Linkname)))
+	if !isBlob || !targetIsBlob || blobKey != targetKey {
+		return "", fmt.Errorf("%q: link to %q is not a link to the copy of the same blob", tarHdr.Name, tarHdr.Linkname)
+	}
+
+	linkTarget, unpacked := unpackedBlobs[targetKey]
+	if !unpacked || linkTarget != filepath.Join(root, filepath.FromSlash(tarHdr.Linkname)) {
+		return "", fmt.Errorf("%q: link target %q was not unpacked from the bundle", tarHdr.Name, tarHdr.Linkname)
+	}
+	return linkTarget, nil
+}
+
+// OpenBundleStream opens bundle tar file or its chunks for reading as a single stream.
+// Bundle path may point to the local file system or to the remote storage, see storage.Open.
+// Chunks are checked against the chunks index and errors point at the exact missing or damaged chunk.
+func OpenBundleStream(bundlePath string) (io.ReadCloser, error) {
+	bundleStorage, bundleFileName, err := storage.Open(chunked.TrimChunkSuffix(bundlePath))
+	if err != nil {
+		return nil, fmt.Errorf("open bundle storage: %w", err)
+	}
+
+	bundleFile, err := bundleStorage.Open(bundleFileName)
+	switch {
+	case err == nil:
+		return &storageReadCloser{ReadCloser: bundleFile, storage: bundleStorage}, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		_ = bundleStorage.Close()
+		return nil, fmt.Errorf("read tar bundle: %w", err)
+	}
+
+	chunksReader, err := chunked.NewStorageReader(bundleStorage, bundleFileName)
+	if err != nil {
+		_ = bundleStorage.Close()
+		return nil, fmt.Errorf("read bundle chunks: %w", err)
+	}
+	return &storageReadCloser{ReadCloser: chunksReader, storage: bundleStorage}, nil
+}
+
+// storageReadCloser closes the storage after the file read from it is closed.
+type storageReadCloser struct {
+	io.ReadCloser
+	storage storage.Storage
+}
+
+func (r *storageReadCloser) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.storage.Close())
+}
+
 func Pack(mirrorCtx *contexts.PullContext) error {
-	var tarStream io.WriteCloser
+	bundleStorage, bundleFileName, err := storage.Open(mirrorCtx.BundlePath)
+	if err != nil {
+		return fmt.Errorf("open bundle storage: %w", err)
+	}
+	defer bundleStorage.Close()
+
+	var bundleStream io.WriteCloser
 	if mirrorCtx.BundleChunkSize != 0 {
-		chunkWriter := chunked.NewChunkedFileWriter(mirrorCtx.BundleChunkSize, filepath.Dir(mirrorCtx.BundlePath), filepath.Base(mirrorCtx.BundlePath))
-		tarStream = chunkWriter
+		bundleStream = chunked.NewStorageWriter(mirrorCtx.BundleChunkSize, bundleStorage, bundleFileName)
 	} else {
-		tarFile, err := os.Create(mirrorCtx.BundlePath)
+		bundleStream, err = bundleStorage.Create(bundleFileName)
 		if err != nil {
-			return fmt.Errorf("read tar bundle: %w", err)
+			return fmt.Errorf("create tar bundle: %w", err)
 		}
-		tarStream = tarFile
+	}
+
+	tarStream, err := newCompressingWriter(bundleStream, mirrorCtx.BundleCompression)
+	if err != nil {
+		return err
 	}
 
 	tarWriter := tar.NewWriter(tarStream)
-	if err := filepath.Walk(mirrorCtx.UnpackedImagesPath, packFunc(&mirrorCtx.BaseContext, tarWriter)); err != nil {
+	if err = filepath.Walk(mirrorCtx.UnpackedImagesPath, packFunc(&mirrorCtx.BaseContext, tarWriter, map[string]packedBlob{})); err != nil {
 		return fmt.Errorf("pack mirrored images into tar: %w", err)
 	}
 
-	if err := tarWriter.Close(); err != nil {
+	if err = tarWriter.Close(); err != nil {
 		return fmt.Errorf("write tar trailer: %w", err)
 	}
-	if err := tarStream.Close(); err != nil {
+	if err = tarStream.Close(); err != nil {
+		return fmt.Errorf("flush compressed tar: %w", err)
+	}
+	if err = bundleStream.Close(); err != nil {
 		return fmt.Errorf("close tar: %w", err)
 	}
 
 	return nil
 }
 
-func packFunc(mirrorCtx *contexts.BaseContext, out *tar.Writer) filepath.WalkFunc {
+// packedBlob is the blob that was already written to the tar bundle.
+type packedBlob struct {
+	pathInTar string
+	size      int64
+}
+
+// packFunc writes files into the tar bundle.
+// Blobs shared between several layouts are written only once, other copies are stored as hard links to the first one.
+func packFunc(mirrorCtx *contexts.BaseContext, out *tar.Writer, packedBlobs map[string]packedBlob) filepath.WalkFunc {
 	return func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -144,14 +247,33 @@ func packFunc(mirrorCtx *contexts.BaseContext, out *tar.Writer) filepath.WalkFun
 			return nil
 		}
 
+		pathInTar := filepath.ToSlash(strings.TrimPrefix(path, mirrorCtx.UnpackedImagesPath+string(os.PathSeparator)))
+		blobKey, isBlob := blobKeyFromPath(pathInTar)
+		if blob, packed := packedBlobs[blobKey]; isBlob && packed && blob.size == info.Size() {
+			err = out.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeLink,
+				Name:     pathInTar,
+				Linkname: blob.pathInTar,
+				Mode:     int64(info.Mode()),
+				ModTime:  info.ModTime(),
+			})
+			if err != nil {
+				return fmt.Errorf("write tar header: %w", err)
+			}
+			_ = os.Remove(path)
+			return nil
+		}
+		if isBlob {
+			packedBlobs[blobKey] = packedBlob{pathInTar: pathInTar, size: info.Size()}
+		}
+
 		blobFile, err := os.Open(path)
 		if err != nil {
 			return fmt.Errorf("read file: %w", err)
 		}
 
-		pathInTar := strings.TrimPrefix(path, mirrorCtx.UnpackedImagesPath+string(os.PathSeparator))
 		err = out.WriteHeader(&tar.Header{
-			Name:    filepath.ToSlash(pathInTar),
+			Name:    pathInTar,
 			Size:    info.Size(),
 			Mode:    int64(info.Mode()),
 			ModTime: info.ModTime(),
@@ -178,3 +300,36 @@ func packFunc(mirrorCtx *contexts.BaseContext, out *tar.Writer) filepath.WalkFun
 		return nil
 	}
 }
+
+// blobKeyFromPath returns "<algorithm>/<hex>" part of the path if it points to a blob of OCI Image Layout.
+func blobKeyFromPath(pathInTar string) (string, bool) {
+	parts := strings.Split(pathInTar, "/")
+	if len(parts) < 3 || parts[len(parts)-3] != "blobs" {
+		return "", false
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1], true
+}
+
+// linkOrCopyFile creates a hard link to the src file at dst, copying the file if hard links are not supported.
+func linkOrCopyFile(src, dst string) error {
+	_ = os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package bundle
 
 import (
+	"archive/tar"
 	"crypto/rand"
 	"io"
 	"io/fs"
@@ -114,6 +115,172 @@ func TestChunkedBundlePackingAndUnpacking(t *testing.T) {
 	require.Equal(t, expectedFiles, resultingFiles, "Expected to find same file trees under source and target dirs")
 }
 
+func TestCompressedBundlePackingAndUnpacking(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		chunkSize   int64
+	}{
+		{name: "gzip", compression: CompressionGzip},
+		{name: "zstd", compression: CompressionZstd},
+		{name: "chunked zstd", compression: CompressionZstd, chunkSize: 3 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			bundlePath := filepath.Join(workDir, "pack_test.tar")
+			packFromDir := filepath.Join(workDir, "pack")
+			unpackToDir := filepath.Join(workDir, "unpack")
+			require.NoError(t, os.MkdirAll(packFromDir, 0o755))
+
+			fillTestFileTree(t, packFromDir)
+			expectedFiles := readAllFiles(t, os.DirFS(packFromDir))
+
+			err := Pack(&contexts.PullContext{
+				BaseContext: contexts.BaseContext{
+					BundlePath:         bundlePath,
+					UnpackedImagesPath: packFromDir,
+				},
+				BundleChunkSize:   tt.chunkSize,
+				BundleCompression: tt.compression,
+			})
+			require.NoError(t, err, "Packing should finish without errors")
+
+			bundleFS, err := OpenFS(bundlePath)
+			require.NoError(t, err)
+			require.Equal(t, expectedFiles, readAllFiles(t, bundleFS), "Compressed bundle should be readable without unpacking")
+			require.NoError(t, bundleFS.Close())
+
+			err = Unpack(&contexts.BaseContext{
+				BundlePath:         bundlePath,
+				UnpackedImagesPath: unpackToDir,
+			})
+			require.NoError(t, err, "Unpacking should finish without errors")
+			require.Equal(t, expectedFiles, readAllFiles(t, os.DirFS(unpackToDir)))
+		})
+	}
+}
+
+func TestPackDeduplicatesBlobsAcrossLayouts(t *testing.T) {
+	workDir := t.TempDir()
+	bundlePath := filepath.Join(workDir, "pack_test.tar")
+	packFromDir := filepath.Join(workDir, "pack")
+	unpackToDir := filepath.Join(workDir, "unpack")
+
+	blob := make([]byte, 5*1024*1024)
+	_, err := rand.Read(blob)
+	require.NoError(t, err)
+	blobPaths := []string{
+		filepath.Join("blobs", "sha256", "0123abcd"),
+		filepath.Join("install", "blobs", "sha256", "0123abcd"),
+		filepath.Join("modules", "console", "blobs", "sha256", "0123abcd"),
+	}
+	for _, blobPath := range blobPaths {
+		require.NoError(t, os.MkdirAll(filepath.Join(packFromDir, filepath.Dir(blobPath)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(packFromDir, blobPath), blob, 0o644))
+	}
+	expectedFiles := readAllFiles(t, os.DirFS(packFromDir))
+
+	err = Pack(&contexts.PullContext{
+		BaseContext: contexts.BaseContext{
+			BundlePath:         bundlePath,
+			UnpackedImagesPath: packFromDir,
+		},
+	})
+	require.NoError(t, err, "Packing should finish without errors")
+
+	stat, err := os.Stat(bundlePath)
+	require.NoError(t, err)
+	require.Less(t, stat.Size(), int64(2*len(blob)), "Shared blob should be stored in bundle only once")
+
+	bundleFS, err := OpenFS(bundlePath)
+	require.NoError(t, err)
+	require.Equal(t, expectedFiles, readAllFiles(t, bundleFS))
+	require.NoError(t, bundleFS.Close())
+
+	err = Unpack(&contexts.BaseContext{
+		BundlePath:         bundlePath,
+		UnpackedImagesPath: unpackToDir,
+	})
+	require.NoError(t, err, "Unpacking should finish without errors")
+	require.Equal(t, expectedFiles, readAllFiles(t, os.DirFS(unpackToDir)))
+}
+
+func TestUnpackRejectsEntriesOutsideBundle(t *testing.T) {
+	blob := []byte("blob")
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+	}{
+		{
+			name:    "path_traversal",
+			entries: []*tar.Header{{Typeflag: tar.TypeReg, Name: "../outside/secret", Size: int64(len(blob))}},
+		},
+		{
+			name:    "absolute_path",
+			entries: []*tar.Header{{Typeflag: tar.TypeReg, Name: "/outside/secret", Size: int64(len(blob))}},
+		},
+		{
+			name: "link_outside_overwritten_by_later_entry",
+			entries: []*tar.Header{
+				{Typeflag: tar.TypeLink, Name: "blobs/sha256/secret", Linkname: "../outside/secret"},
+				{Typeflag: tar.TypeReg, Name: "blobs/sha256/secret", Size: int64(len(blob))},
+			},
+		},
+		{
+			name: "link_to_not_unpacked_blob",
+			entries: []*tar.Header{
+				{Typeflag: tar.TypeLink, Name: "install/blobs/sha256/0123abcd", Linkname: "blobs/sha256/0123abcd"},
+			},
+		},
+		{
+			name: "link_to_other_blob",
+			entries: []*tar.Header{
+				{Typeflag: tar.TypeReg, Name: "blobs/sha256/0123abcd", Size: int64(len(blob))},
+				{Typeflag: tar.TypeLink, Name: "install/blobs/sha256/4567ef01", Linkname: "blobs/sha256/0123abcd"},
+			},
+		},
+		{
+			name:    "symlink",
+			entries: []*tar.Header{{Typeflag: tar.TypeSymlink, Name: "index.json", Linkname: "../outside/secret"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			outsideFile := filepath.Join(workDir, "outside", "secret")
+			require.NoError(t, os.MkdirAll(filepath.Dir(outsideFile), 0o755))
+			require.NoError(t, os.WriteFile(outsideFile, []byte("secret"), 0o644))
+
+			bundlePath := filepath.Join(workDir, "bundle.tar")
+			bundleFile, err := os.Create(bundlePath)
+			require.NoError(t, err)
+			tarWriter := tar.NewWriter(bundleFile)
+			for _, hdr := range tt.entries {
+				hdr.Mode = 0o644
+				require.NoError(t, tarWriter.WriteHeader(hdr))
+				if hdr.Typeflag == tar.TypeReg {
+					_, err = tarWriter.Write(blob)
+					require.NoError(t, err)
+				}
+			}
+			require.NoError(t, tarWriter.Close())
+			require.NoError(t, bundleFile.Close())
+
+			err = Unpack(&contexts.BaseContext{
+				BundlePath:         bundlePath,
+				UnpackedImagesPath: filepath.Join(workDir, "unpack"),
+			})
+			require.Error(t, err)
+
+			contents, err := os.ReadFile(outsideFile)
+			require.NoError(t, err)
+			require.Equal(t, "secret", string(contents), "File outside of the bundle should be left intact")
+		})
+	}
+}
+
 func fillTestFileTree(t *testing.T, packFromDir string) {
 	t.Helper()
 
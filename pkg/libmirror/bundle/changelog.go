@@ -0,0 +1,251 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
+)
+
+// Changelog combines release notes of Deckhouse and modules releases stored in the bundle.
+type Changelog struct {
+	Releases []ReleaseNotes    `json:"releases"`
+	Modules  []ModuleChangelog `json:"modules,omitempty"`
+}
+
+type ModuleChangelog struct {
+	Name     string         `json:"name"`
+	Releases []ReleaseNotes `json:"releases"`
+}
+
+// ReleaseNotes are read from version.json and changelog.yaml of the release image.
+type ReleaseNotes struct {
+	Version      string                 `json:"version"`
+	Suspended    bool                   `json:"suspended,omitempty"`
+	Requirements *releases.Requirements `json:"requirements,omitempty"`
+	Disruptions  []string               `json:"disruptions,omitempty"`
+	Changelog    map[string]any         `json:"changelog,omitempty"`
+}
+
+// ReadChangelog reads release notes of the Deckhouse versions matching the constraint from the release-channel images
+// and release notes of all module versions from the modules release images. Nil constraint matches every version.
+func ReadChangelog(bundleFS *FS, deckhouseVersions *semver.Constraints) (*Changelog, error) {
+	layoutPaths, err := FindLayouts(bundleFS)
+	if err != nil {
+		return nil, err
+	}
+
+	changelog := &Changelog{Releases: make([]ReleaseNotes, 0)}
+	for _, layoutPath := range layoutPaths {
+		if layoutPath == "release-channel" {
+			changelog.Releases, err = readReleaseNotes(NewLayout(bundleFS, layoutPath), deckhouseVersions)
+			if err != nil {
+				return nil, fmt.Errorf("read Deckhouse releases: %w", err)
+			}
+			continue
+		}
+
+		if moduleName, isModuleReleases := moduleNameFromReleasesLayoutPath(layoutPath); isModuleReleases {
+			moduleReleases, err := readReleaseNotes(NewLayout(bundleFS, layoutPath), nil)
+			if err != nil {
+				return nil, fmt.Errorf("read %s module releases: %w", moduleName, err)
+			}
+			if len(moduleReleases) > 0 {
+				changelog.Modules = append(changelog.Modules, ModuleChangelog{Name: moduleName, Releases: moduleReleases})
+			}
+		}
+	}
+
+	slices.SortFunc(changelog.Modules, func(a, b ModuleChangelog) int { return strings.Compare(a.Name, b.Name) })
+	return changelog, nil
+}
+
+func moduleNameFromReleasesLayoutPath(layoutPath string) (string, bool) {
+	parts := strings.Split(path.Clean(layoutPath), "/")
+	if len(parts) != 3 || parts[0] != "modules" || parts[2] != "release" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func readReleaseNotes(l Layout, versions *semver.Constraints) ([]ReleaseNotes, error) {
+	indexManifest, err := l.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(indexManifest.Manifests))
+	for _, desc := range indexManifest.Manifests {
+		if tag := ImageTag(desc); IsVersionTag(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	tags = slices.Compact(sortTags(tags))
+
+	result := make([]ReleaseNotes, 0, len(tags))
+	for _, tag := range tags {
+		version := semver.MustParse(tag)
+		if versions != nil && !versions.Check(version) {
+			continue
+		}
+
+		img, err := l.FindImageByTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("read %s:%s: %w", l.Path, tag, err)
+		}
+		releaseInfo, err := releases.ExtractReleaseInfoWithOptionalChangelog(img)
+		if err != nil {
+			return nil, fmt.Errorf("read %s:%s: %w", l.Path, tag, err)
+		}
+
+		releaseNotes := ReleaseNotes{
+			Version:     tag,
+			Suspended:   releaseInfo.Suspended,
+			Disruptions: releaseInfo.DisruptionsForVersion(version),
+			Changelog:   releaseInfo.Changelog,
+		}
+		if !releaseInfo.Requirements.IsEmpty() {
+			releaseNotes.Requirements = &releaseInfo.Requirements
+		}
+		result = append(result, releaseNotes)
+	}
+	return result, nil
+}
+
+// WriteMarkdown renders the changelog as a Markdown document.
+// Disruptions and requirements are put before the changes of each release, so they are not overlooked.
+func (c *Changelog) WriteMarkdown(w io.Writer) error {
+	md := &markdownWriter{w: w}
+	md.printf("# Deckhouse releases\n")
+	if len(c.Releases) == 0 {
+		md.printf("\nNo releases.\n\n")
+	}
+	for _, release := range c.Releases {
+		md.writeRelease(release, 2)
+	}
+
+	if len(c.Modules) > 0 {
+		md.printf("# Modules releases\n")
+	}
+	for _, module := range c.Modules {
+		md.printf("\n## %s\n", module.Name)
+		for _, release := range module.Releases {
+			md.writeRelease(release, 3)
+		}
+	}
+	return md.err
+}
+
+type markdownWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (m *markdownWriter) printf(format string, args ...any) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, format, args...)
+}
+
+func (m *markdownWriter) writeRelease(release ReleaseNotes, level int) {
+	m.printf("\n%s %s\n\n", strings.Repeat("#", level), release.Version)
+	if release.Suspended {
+		m.printf("**Suspended:** the release is suspended and will not be deployed.\n\n")
+	}
+	if len(release.Disruptions) > 0 {
+		m.printf("**Disruptions:** %s. Review the disruptive changes before approving the update.\n\n", strings.Join(release.Disruptions, ", "))
+	}
+	if release.Requirements != nil {
+		m.printf("**Requirements:**\n")
+		m.writeRequirements(release.Requirements.Flat(), 0)
+		if len(release.Requirements.Modules) > 0 {
+			m.printf("- modules:\n")
+			m.writeRequirements(release.Requirements.Modules, 1)
+		}
+		m.printf("\n")
+	}
+
+	if len(release.Changelog) == 0 {
+		m.printf("No changelog.\n\n")
+		return
+	}
+	m.writeSection(release.Changelog, level+1)
+}
+
+// writeRequirements renders requirements as a Markdown list sorted by name, nested lists are indented by level.
+func (m *markdownWriter) writeRequirements(requirements map[string]string, level int) {
+	keys := make([]string, 0, len(requirements))
+	for key := range requirements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.printf("%s- %s: %s\n", strings.Repeat("  ", level), key, requirements[key])
+	}
+}
+
+// writeSection renders nested maps of the changelog as headings and lists of changes as Markdown lists.
+func (m *markdownWriter) writeSection(section map[string]any, level int) {
+	keys := make([]string, 0, len(section))
+	for key := range section {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		m.printf("%s %s\n\n", strings.Repeat("#", min(level, 6)), key)
+		switch value := section[key].(type) {
+		case map[string]any:
+			m.writeSection(value, level+1)
+		case []any:
+			for _, entry := range value {
+				m.writeEntry(entry)
+			}
+			m.printf("\n")
+		default:
+			m.printf("%v\n\n", value)
+		}
+	}
+}
+
+// writeEntry renders the change, changes of Deckhouse are like {summary, pull_request, impact}.
+func (m *markdownWriter) writeEntry(entry any) {
+	change, ok := entry.(map[string]any)
+	if !ok {
+		m.printf("- %v\n", entry)
+		return
+	}
+
+	summary, _ := change["summary"].(string)
+	m.printf("- %s", strings.TrimSpace(summary))
+	if pullRequest, _ := change["pull_request"].(string); pullRequest != "" {
+		m.printf(" (%s)", pullRequest)
+	}
+	m.printf("\n")
+	if impact, _ := change["impact"].(string); impact != "" {
+		m.printf("  - **Impact:** %s\n", strings.TrimSpace(impact))
+	}
+}
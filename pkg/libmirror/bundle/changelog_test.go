@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChangelog(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	bundlePath := t.TempDir()
+	appendImages(t, filepath.Join(bundlePath, "release-channel"), map[string]v1.Image{
+		repo + "/release-channel:v1.60.3": releaseChannelImage(t, "v1.60.3"),
+		repo + "/release-channel:v1.61.2": releaseChannelImage(t, "v1.61.2"),
+		repo + "/release-channel:v1.62.0": releaseChannelImage(t, "v1.62.0"),
+		repo + "/release-channel:v1.63.0": releaseImageWithoutChangelog(t, "v1.63.0"),
+		repo + "/release-channel:stable":  releaseChannelImage(t, "v1.61.2"),
+	})
+	appendImages(t, filepath.Join(bundlePath, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.1.0": randomImage(t),
+	})
+	appendImages(t, filepath.Join(bundlePath, "modules", "console", "release"), map[string]v1.Image{
+		repo + "/modules/console/release:v1.1.0": moduleReleaseImage(t, "v1.1.0"),
+		repo + "/modules/console/release:stable": moduleReleaseImage(t, "v1.1.0"),
+	})
+
+	bundleFS, err := OpenFS(bundlePath)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	constraint, err := semver.NewConstraint(">= v1.61, <= v1.61")
+	require.NoError(t, err)
+	changelog, err := ReadChangelog(bundleFS, constraint)
+	require.NoError(t, err)
+
+	require.Len(t, changelog.Releases, 1)
+	require.Equal(t, "v1.61.2", changelog.Releases[0].Version)
+	require.Equal(t, []string{"ingressNginx"}, changelog.Releases[0].Disruptions)
+	require.Len(t, changelog.Modules, 1)
+	require.Equal(t, "console", changelog.Modules[0].Name)
+	require.Len(t, changelog.Modules[0].Releases, 1)
+	require.Empty(t, changelog.Modules[0].Releases[0].Disruptions)
+	require.Equal(t, map[string]string{"cert-manager": ">= 1.2", "prometheus": ">= 0.5"}, changelog.Modules[0].Releases[0].Requirements.Modules)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, changelog.WriteMarkdown(out))
+	require.Equal(t, `# Deckhouse releases
+
+## v1.61.2
+
+**Disruptions:** ingressNginx. Review the disruptive changes before approving the update.
+
+### candi
+
+#### fixes
+
+- Fix containerd start.
+
+# Modules releases
+
+## console
+
+### v1.1.0
+
+**Requirements:**
+- deckhouse: >= 1.60
+- kubernetes: >= 1.28
+- modules:
+  - cert-manager: >= 1.2
+  - prometheus: >= 0.5
+
+#### features
+
+- Console login page.
+
+`, out.String())
+
+	changelog, err = ReadChangelog(bundleFS, nil)
+	require.NoError(t, err)
+	require.Len(t, changelog.Releases, 4)
+	require.Equal(t, "v1.63.0", changelog.Releases[3].Version)
+	require.Empty(t, changelog.Releases[3].Changelog, "Release without changelog should be read with empty changelog")
+}
+
+func releaseImageWithoutChangelog(t *testing.T, version string) v1.Image {
+	t.Helper()
+
+	l, err := crane.Layer(map[string][]byte{
+		"version.json": []byte(fmt.Sprintf(`{"version":%q}`, version)),
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
+
+func moduleReleaseImage(t *testing.T, version string) v1.Image {
+	t.Helper()
+
+	l, err := crane.Layer(map[string][]byte{
+		"version.json": []byte(fmt.Sprintf(
+			`{"version":%q,"requirements":{"deckhouse":">= 1.60","kubernetes":">= 1.28","modules":{"prometheus":">= 0.5","cert-manager":">= 1.2"}}}`,
+			version,
+		)),
+		"changelog.yaml": []byte("features:\n- Console login page.\n"),
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
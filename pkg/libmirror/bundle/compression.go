@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compression algorithms of the bundle tar stream.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// IsSupportedCompression reports whether bundle can be compressed with the specified algorithm.
+func IsSupportedCompression(compression string) bool {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+func newCompressingWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported bundle compression %q", compression)
+	}
+}
+
+// newDecompressingReader detects compression of the bundle stream by its magic bytes
+// and returns the reader of the plain tar stream.
+func newDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	bufferedReader := bufio.NewReaderSize(r, 512*1024)
+	header, err := bufferedReader.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read bundle header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return gzip.NewReader(bufferedReader)
+	case bytes.HasPrefix(header, zstdMagic):
+		decoder, err := zstd.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(bufferedReader), nil
+	}
+}
+
+// isCompressed reports whether bundle data starts with a header of one of the supported compression formats.
+func isCompressed(data io.ReaderAt) bool {
+	header := make([]byte, len(zstdMagic))
+	n, _ := data.ReadAt(header, 0)
+	header = header[:n]
+	return bytes.HasPrefix(header, gzipMagic) || bytes.HasPrefix(header, zstdMagic)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,262 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/exp/maps"
+)
+
+// Diff describes what has changed between two bundles.
+type Diff struct {
+	OldSize int64 `json:"oldSize"`
+	NewSize int64 `json:"newSize"`
+
+	DeckhouseVersions Changes            `json:"deckhouseVersions"`
+	ModuleVersions    map[string]Changes `json:"moduleVersions,omitempty"`
+	Layouts           []LayoutDiff       `json:"layouts,omitempty"`
+}
+
+type Changes struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+type LayoutDiff struct {
+	Path    string `json:"path"`
+	Added   bool   `json:"added,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+
+	AddedTags     []string    `json:"addedTags,omitempty"`
+	RemovedTags   []string    `json:"removedTags,omitempty"`
+	ChangedTags   []TagChange `json:"changedTags,omitempty"`
+	AddedImages   []string    `json:"addedImages,omitempty"`
+	RemovedImages []string    `json:"removedImages,omitempty"`
+}
+
+type TagChange struct {
+	Tag       string `json:"tag"`
+	OldDigest string `json:"oldDigest"`
+	NewDigest string `json:"newDigest"`
+}
+
+func (c Changes) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+func (d *LayoutDiff) IsEmpty() bool {
+	return !d.Added && !d.Removed &&
+		len(d.AddedTags) == 0 && len(d.RemovedTags) == 0 && len(d.ChangedTags) == 0 &&
+		len(d.AddedImages) == 0 && len(d.RemovedImages) == 0
+}
+
+// SizeDelta returns the difference in bytes between the sizes of new and old bundles.
+func (d *Diff) SizeDelta() int64 {
+	return d.NewSize - d.OldSize
+}
+
+// Compare reads OCI Image Layouts indexes of both bundles and finds what was changed between them.
+func Compare(oldBundle, newBundle *FS) (*Diff, error) {
+	oldLayouts, err := snapshotLayouts(oldBundle)
+	if err != nil {
+		return nil, fmt.Errorf("read old bundle: %w", err)
+	}
+	newLayouts, err := snapshotLayouts(newBundle)
+	if err != nil {
+		return nil, fmt.Errorf("read new bundle: %w", err)
+	}
+
+	diff := &Diff{
+		OldSize:        oldBundle.Size(),
+		NewSize:        newBundle.Size(),
+		ModuleVersions: map[string]Changes{},
+	}
+
+	diff.DeckhouseVersions = compareSets(oldLayouts["."].versions(), newLayouts["."].versions())
+	for _, modulePath := range mergedKeys(oldLayouts, newLayouts) {
+		moduleName, isModule := ModuleNameFromLayoutPath(modulePath)
+		if !isModule {
+			continue
+		}
+		if changes := compareSets(oldLayouts[modulePath].versions(), newLayouts[modulePath].versions()); !changes.IsEmpty() {
+			diff.ModuleVersions[moduleName] = changes
+		}
+	}
+
+	for _, layoutPath := range mergedKeys(oldLayouts, newLayouts) {
+		oldLayout, inOld := oldLayouts[layoutPath]
+		newLayout, inNew := newLayouts[layoutPath]
+		layoutDiff := compareLayouts(oldLayout, newLayout)
+		layoutDiff.Path = layoutPath
+		layoutDiff.Added = !inOld
+		layoutDiff.Removed = !inNew
+		if !layoutDiff.IsEmpty() {
+			diff.Layouts = append(diff.Layouts, layoutDiff)
+		}
+	}
+
+	return diff, nil
+}
+
+// ModuleNameFromLayoutPath returns the name of the module if layoutPath points to a module images layout.
+func ModuleNameFromLayoutPath(layoutPath string) (string, bool) {
+	parts := strings.Split(path.Clean(layoutPath), "/")
+	if len(parts) != 2 || parts[0] != "modules" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+type layoutSnapshot struct {
+	tags   map[string]v1.Hash
+	images map[string]struct{}
+}
+
+func (s *layoutSnapshot) versions() []string {
+	if s == nil {
+		return nil
+	}
+
+	result := make([]string, 0)
+	for tag := range s.tags {
+		if IsVersionTag(tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// IsVersionTag reports whether tag is a strict semantic version with an optional "v" prefix, like v1.62.3.
+func IsVersionTag(tag string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(tag, "v"))
+	return err == nil
+}
+
+func snapshotLayouts(fsys fs.FS) (map[string]*layoutSnapshot, error) {
+	layoutPaths, err := FindLayouts(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*layoutSnapshot, len(layoutPaths))
+	for _, layoutPath := range layoutPaths {
+		indexManifest, err := NewLayout(fsys, layoutPath).IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot := &layoutSnapshot{
+			tags:   map[string]v1.Hash{},
+			images: map[string]struct{}{},
+		}
+		for _, desc := range indexManifest.Manifests {
+			snapshot.images[desc.Digest.String()] = struct{}{}
+			if tag := ImageTag(desc); tag != "" {
+				snapshot.tags[tag] = desc.Digest
+			}
+		}
+		result[layoutPath] = snapshot
+	}
+
+	return result, nil
+}
+
+func compareLayouts(oldLayout, newLayout *layoutSnapshot) LayoutDiff {
+	if oldLayout == nil {
+		oldLayout = &layoutSnapshot{}
+	}
+	if newLayout == nil {
+		newLayout = &layoutSnapshot{}
+	}
+
+	tags := compareSets(maps.Keys(oldLayout.tags), maps.Keys(newLayout.tags))
+	images := compareSets(maps.Keys(oldLayout.images), maps.Keys(newLayout.images))
+	result := LayoutDiff{
+		AddedTags:     tags.Added,
+		RemovedTags:   tags.Removed,
+		AddedImages:   images.Added,
+		RemovedImages: images.Removed,
+	}
+
+	for _, tag := range sortTags(maps.Keys(oldLayout.tags)) {
+		oldDigest := oldLayout.tags[tag]
+		newDigest, found := newLayout.tags[tag]
+		if found && oldDigest != newDigest {
+			result.ChangedTags = append(result.ChangedTags, TagChange{
+				Tag:       tag,
+				OldDigest: oldDigest.String(),
+				NewDigest: newDigest.String(),
+			})
+		}
+	}
+
+	return result
+}
+
+func compareSets(oldSet, newSet []string) Changes {
+	result := Changes{}
+	for _, item := range newSet {
+		if !slices.Contains(oldSet, item) {
+			result.Added = append(result.Added, item)
+		}
+	}
+	for _, item := range oldSet {
+		if !slices.Contains(newSet, item) {
+			result.Removed = append(result.Removed, item)
+		}
+	}
+
+	result.Added = sortTags(result.Added)
+	result.Removed = sortTags(result.Removed)
+	return result
+}
+
+// sortTags sorts tags so that versions come in semver order after all other tags.
+func sortTags(tags []string) []string {
+	slices.SortFunc(tags, func(a, b string) int {
+		aIsVersion, bIsVersion := IsVersionTag(a), IsVersionTag(b)
+		switch {
+		case aIsVersion && bIsVersion:
+			return semver.MustParse(a).Compare(semver.MustParse(b))
+		case aIsVersion:
+			return 1
+		case bIsVersion:
+			return -1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+	return tags
+}
+
+func mergedKeys[V any](a, b map[string]V) []string {
+	keys := maps.Keys(a)
+	for key := range b {
+		if _, found := a[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+)
+
+func TestCompareBundles(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	stableImage, alphaImage := randomImage(t), randomImage(t)
+	oldBundlePath := t.TempDir()
+	appendImages(t, filepath.Join(oldBundlePath), map[string]v1.Image{
+		repo + ":v1.60.1": stableImage,
+		repo + ":v1.61.2": randomImage(t),
+		repo + ":stable":  stableImage,
+	})
+	appendImages(t, filepath.Join(oldBundlePath, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.0.0": randomImage(t),
+	})
+
+	newBundlePath := t.TempDir()
+	appendImages(t, filepath.Join(newBundlePath), map[string]v1.Image{
+		repo + ":v1.61.2": alphaImage,
+		repo + ":v1.62.0": randomImage(t),
+		repo + ":stable":  alphaImage,
+	})
+	appendImages(t, filepath.Join(newBundlePath, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.0.0": randomImage(t),
+		repo + "/modules/console:v1.1.0": randomImage(t),
+	})
+	appendImages(t, filepath.Join(newBundlePath, "modules", "stronghold"), map[string]v1.Image{
+		repo + "/modules/stronghold:v0.5.0": randomImage(t),
+	})
+
+	oldBundle, err := OpenFS(oldBundlePath)
+	require.NoError(t, err)
+	newBundle, err := OpenFS(newBundlePath)
+	require.NoError(t, err)
+
+	diff, err := Compare(oldBundle, newBundle)
+	require.NoError(t, err)
+
+	require.Equal(t, Changes{Added: []string{"v1.62.0"}, Removed: []string{"v1.60.1"}}, diff.DeckhouseVersions)
+	require.Equal(t, map[string]Changes{
+		"console":    {Added: []string{"v1.1.0"}},
+		"stronghold": {Added: []string{"v0.5.0"}},
+	}, diff.ModuleVersions)
+
+	require.Len(t, diff.Layouts, 3)
+	rootDiff := diff.Layouts[0]
+	require.Equal(t, ".", rootDiff.Path)
+	require.Equal(t, []string{"v1.62.0"}, rootDiff.AddedTags)
+	require.Equal(t, []string{"v1.60.1"}, rootDiff.RemovedTags)
+	require.Len(t, rootDiff.ChangedTags, 2, "Both stable and v1.61.2 tags should point to the new digest")
+	require.Equal(t, "stable", rootDiff.ChangedTags[0].Tag)
+	require.Len(t, rootDiff.AddedImages, 2)
+	require.Len(t, rootDiff.RemovedImages, 2)
+
+	require.Equal(t, "modules/stronghold", diff.Layouts[2].Path)
+	require.True(t, diff.Layouts[2].Added)
+	require.Equal(t, newBundle.Size()-oldBundle.Size(), diff.SizeDelta())
+}
+
+func randomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	return img
+}
+
+func appendImages(t *testing.T, layoutPath string, images map[string]v1.Image) {
+	t.Helper()
+
+	l, err := layouts.CreateEmptyImageLayoutAtPath(layoutPath)
+	require.NoError(t, err)
+
+	for ref, img := range images {
+		_, tag := splitRefByRepoAndTag(ref)
+		err = l.AppendImage(img,
+			layout.WithPlatform(v1.Platform{Architecture: "amd64", OS: "linux"}),
+			layout.WithAnnotations(map[string]string{
+				"org.opencontainers.image.ref.name": ref,
+				"io.deckhouse.image.short_tag":      tag,
+			}))
+		require.NoError(t, err)
+	}
+}
+
+func splitRefByRepoAndTag(ref string) (string, string) {
+	for i := len(ref) - 1; i >= 0; i-- {
+		if ref[i] == ':' {
+			return ref[:i], ref[i+1:]
+		}
+	}
+	return ref, ""
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/chunked"
+)
+
+// FS provides read-only access to the files of a bundle without unpacking it.
+// Bundle may be stored as a tar archive, as a set of tar chunks or as an unpacked directory.
+type FS struct {
+	dir     string // Set only for unpacked bundles
+	size    int64
+	chunks  []ChunkInfo
+	entries map[string]*fsEntry
+	data    io.ReaderAt
+	closers []io.Closer
+}
+
+// ChunkInfo describes a single chunk of the bundle that was split into chunks during pull.
+type ChunkInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type fsEntry struct {
+	name     string
+	size     int64
+	offset   int64
+	mode     fs.FileMode
+	modTime  time.Time
+	isDir    bool
+	children []string
+}
+
+var (
+	_ fs.FS        = &FS{}
+	_ fs.StatFS    = &FS{}
+	_ fs.ReadDirFS = &FS{}
+)
+
+// OpenFS opens bundle at bundlePath for reading.
+// bundlePath may point to a tar file, a directory or to the tar file that was split into chunks during pull.
+func OpenFS(bundlePath string) (*FS, error) {
+	bundlePath = chunked.TrimChunkSuffix(filepath.Clean(bundlePath))
+
+	stat, err := os.Stat(bundlePath)
+	switch {
+	case err == nil && stat.IsDir():
+		return openDirFS(bundlePath)
+	case err == nil:
+		tarFile, err := os.Open(bundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("open bundle: %w", err)
+		}
+		return openArchiveFS(tarFile, stat.Size(), []io.Closer{tarFile})
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("open bundle: %w", err)
+	}
+
+	chunksDir := filepath.Dir(bundlePath)
+	chunks, err := chunked.ListChunks(chunksDir, filepath.Base(bundlePath))
+	if err != nil {
+		return nil, fmt.Errorf("open bundle: %w", err)
+	}
+
+	readers := make([]sizedReaderAt, 0, len(chunks))
+	closers := make([]io.Closer, 0, len(chunks))
+	chunksInfo := make([]ChunkInfo, 0, len(chunks))
+	totalSize := int64(0)
+	for _, chunk := range chunks {
+		chunkFile, err := os.Open(filepath.Join(chunksDir, chunk.Name))
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("open bundle chunk: %w", err)
+		}
+		closers = append(closers, chunkFile)
+		readers = append(readers, sizedReaderAt{ReaderAt: chunkFile, size: chunk.Size})
+		chunksInfo = append(chunksInfo, ChunkInfo{Name: chunk.Name, Size: chunk.Size})
+		totalSize += chunk.Size
+	}
+
+	bundleFS, err := openArchiveFS(newMultiReaderAt(readers), totalSize, closers)
+	if err != nil {
+		return nil, err
+	}
+	bundleFS.chunks = chunksInfo
+	return bundleFS, nil
+}
+
+func openDirFS(dir string) (*FS, error) {
+	bundleFS := &FS{dir: dir}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		bundleFS.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read bundle directory: %w", err)
+	}
+	return bundleFS, nil
+}
+
+// openArchiveFS opens plain tar bundle in place.
+// Compressed bundles do not support random access, so they are decompressed into a temporary file first.
+func openArchiveFS(data io.ReaderAt, size int64, closers []io.Closer) (*FS, error) {
+	if !isCompressed(data) {
+		return openTarFS(data, size, closers)
+	}
+
+	tarStream, err := newDecompressingReader(io.NewSectionReader(data, 0, size))
+	if err != nil {
+		closeAll(closers)
+		return nil, fmt.Errorf("decompress bundle: %w", err)
+	}
+	defer tarStream.Close()
+
+	tmpFile, err := os.CreateTemp("", "d8-bundle-*.tar")
+	if err != nil {
+		closeAll(closers)
+		return nil, fmt.Errorf("decompress bundle: %w", err)
+	}
+	closers = append(closers, &tempFile{File: tmpFile})
+
+	tarSize, err := io.Copy(tmpFile, tarStream)
+	if err != nil {
+		closeAll(closers)
+		return nil, fmt.Errorf("decompress bundle: %w", err)
+	}
+
+	bundleFS, err := openTarFS(tmpFile, tarSize, closers)
+	if err != nil {
+		return nil, err
+	}
+	bundleFS.size = size
+	return bundleFS, nil
+}
+
+func openTarFS(data io.ReaderAt, size int64, closers []io.Closer) (*FS, error) {
+	bundleFS := &FS{
+		size:    size,
+		data:    data,
+		closers: closers,
+		entries: map[string]*fsEntry{
+			".": {name: ".", isDir: true, mode: fs.ModeDir | 0o755},
+		},
+	}
+
+	// SectionReader implements io.Seeker, so tar reader will skip over file contents instead of reading them.
+	// Its current position right after reading the header is where the contents of that file begin.
+	stream := io.NewSectionReader(data, 0, size)
+	tarReader := tar.NewReader(stream)
+	for {
+		hdr, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = bundleFS.Close()
+			return nil, fmt.Errorf("read bundle tar headers: %w", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if hdr.Typeflag == tar.TypeDir {
+			bundleFS.addDir(name)
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			// Blobs shared between layouts are packed once, every other copy is a hard link to the first one.
+			target, found := bundleFS.entries[path.Clean(strings.TrimPrefix(hdr.Linkname, "./"))]
+			if !found || target.isDir {
+				_ = bundleFS.Close()
+				return nil, fmt.Errorf("read bundle tar headers: %s links to unknown file %s", hdr.Name, hdr.Linkname)
+			}
+			link := *target
+			link.name = path.Base(name)
+			bundleFS.entries[name] = &link
+			bundleFS.addDir(path.Dir(name))
+			bundleFS.linkChild(name)
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		offset, err := stream.Seek(0, io.SeekCurrent)
+		if err != nil {
+			_ = bundleFS.Close()
+			return nil, fmt.Errorf("read bundle tar headers: %w", err)
+		}
+		bundleFS.entries[name] = &fsEntry{
+			name:    path.Base(name),
+			size:    hdr.Size,
+			offset:  offset,
+			mode:    fs.FileMode(hdr.Mode).Perm(),
+			modTime: hdr.ModTime,
+		}
+		bundleFS.addDir(path.Dir(name))
+		bundleFS.linkChild(name)
+	}
+
+	for _, entry := range bundleFS.entries {
+		slices.Sort(entry.children)
+	}
+
+	return bundleFS, nil
+}
+
+func (b *FS) addDir(name string) {
+	if _, exists := b.entries[name]; exists {
+		return
+	}
+	b.entries[name] = &fsEntry{name: path.Base(name), isDir: true, mode: fs.ModeDir | 0o755}
+	b.addDir(path.Dir(name))
+	b.linkChild(name)
+}
+
+func (b *FS) linkChild(name string) {
+	if name == "." {
+		return
+	}
+	parent := b.entries[path.Dir(name)]
+	parent.children = append(parent.children, path.Base(name))
+}
+
+// Size returns the amount of bytes bundle occupies on disk.
+func (b *FS) Size() int64 {
+	return b.size
+}
+
+// Chunks returns the list of chunks bundle is stored in, in the order they are joined together.
+// Bundles that are not split into chunks have none.
+func (b *FS) Chunks() []ChunkInfo {
+	return b.chunks
+}
+
+// Open implements fs.FS.
+func (b *FS) Open(name string) (fs.File, error) {
+	if b.dir != "" {
+		return os.DirFS(b.dir).Open(name)
+	}
+
+	entry, err := b.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fsFile{entry: entry}
+	if !entry.isDir {
+		f.SectionReader = io.NewSectionReader(b.data, entry.offset, entry.size)
+	}
+	return f, nil
+}
+
+// Stat implements fs.StatFS.
+func (b *FS) Stat(name string) (fs.FileInfo, error) {
+	if b.dir != "" {
+		return fs.Stat(os.DirFS(b.dir), name)
+	}
+
+	entry, err := b.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (b *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if b.dir != "" {
+		return fs.ReadDir(os.DirFS(b.dir), name)
+	}
+
+	entry, err := b.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entry.children))
+	for _, child := range entry.children {
+		result = append(result, fs.FileInfoToDirEntry(b.entries[path.Join(name, child)]))
+	}
+	return result, nil
+}
+
+// Close releases all underlying files.
+func (b *FS) Close() error {
+	return closeAll(b.closers)
+}
+
+func (b *FS) lookup(op, name string) (*fsEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, found := b.entries[name]
+	if !found {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *fsEntry) Name() string       { return e.name }
+func (e *fsEntry) Size() int64        { return e.size }
+func (e *fsEntry) Mode() fs.FileMode  { return e.mode }
+func (e *fsEntry) ModTime() time.Time { return e.modTime }
+func (e *fsEntry) IsDir() bool        { return e.isDir }
+func (e *fsEntry) Sys() any           { return nil }
+
+type fsFile struct {
+	*io.SectionReader
+	entry *fsEntry
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *fsFile) Close() error               { return nil }
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.entry.isDir {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: errors.New("is a directory")}
+	}
+	return f.SectionReader.Read(p)
+}
+
+// tempFile is removed as soon as it is closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	return errors.Join(f.File.Close(), os.Remove(f.File.Name()))
+}
+
+type sizedReaderAt struct {
+	io.ReaderAt
+	size int64
+}
+
+// multiReaderAt is a logical concatenation of several io.ReaderAt's, just like io.MultiReader is for io.Reader's.
+type multiReaderAt struct {
+	parts   []sizedReaderAt
+	offsets []int64
+}
+
+func newMultiReaderAt(parts []sizedReaderAt) *multiReaderAt {
+	offsets := make([]int64, len(parts))
+	total := int64(0)
+	for i, part := range parts {
+		offsets[i] = total
+		total += part.size
+	}
+	return &multiReaderAt{parts: parts, offsets: offsets}
+}
+
+func (m *multiReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	partIdx, found := slices.BinarySearch(m.offsets, off)
+	if !found {
+		partIdx--
+	}
+
+	bytesRead := 0
+	for partIdx < len(m.parts) && bytesRead < len(p) {
+		if partIdx < 0 {
+			return 0, fmt.Errorf("negative offset %d", off)
+		}
+		part := m.parts[partIdx]
+		partOffset := off + int64(bytesRead) - m.offsets[partIdx]
+		if partOffset >= part.size {
+			partIdx++
+			continue
+		}
+
+		toRead := p[bytesRead:]
+		if remaining := part.size - partOffset; int64(len(toRead)) > remaining {
+			toRead = toRead[:remaining]
+		}
+		n, err := part.ReadAt(toRead, partOffset)
+		bytesRead += n
+		if err != nil && !errors.Is(err, io.EOF) {
+			return bytesRead, err
+		}
+		if n < len(toRead) {
+			return bytesRead, io.ErrUnexpectedEOF
+		}
+		partIdx++
+	}
+
+	if bytesRead < len(p) {
+		return bytesRead, io.EOF
+	}
+	return bytesRead, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+)
+
+func TestOpenFSReadsSameFilesFromAllBundleFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int64
+	}{
+		{name: "directory"},
+		{name: "tar"},
+		{name: "chunked tar", chunkSize: 3 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			packFromDir := filepath.Join(workDir, "bundle")
+			require.NoError(t, os.MkdirAll(packFromDir, 0o755))
+			fillTestFileTree(t, packFromDir)
+			expectedFiles := readAllFiles(t, os.DirFS(packFromDir))
+
+			bundlePath := packFromDir
+			if tt.name != "directory" {
+				bundlePath = filepath.Join(workDir, "d8.tar")
+				err := Pack(&contexts.PullContext{
+					BaseContext: contexts.BaseContext{
+						BundlePath:         bundlePath,
+						UnpackedImagesPath: packFromDir,
+					},
+					BundleChunkSize: tt.chunkSize,
+				})
+				require.NoError(t, err)
+			}
+
+			bundleFS, err := OpenFS(bundlePath)
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, bundleFS.Close()) })
+
+			require.Equal(t, expectedFiles, readAllFiles(t, bundleFS))
+			require.Equal(t, int64(30*1024*1024), bundleFS.Size()-tarOverhead(tt.name))
+			if tt.chunkSize > 0 {
+				require.Greater(t, len(bundleFS.Chunks()), 1)
+				require.Equal(t, "d8.tar.0000.chunk", bundleFS.Chunks()[0].Name)
+				chunksSize := int64(0)
+				for _, chunk := range bundleFS.Chunks() {
+					chunksSize += chunk.Size
+				}
+				require.Equal(t, bundleFS.Size(), chunksSize)
+			} else {
+				require.Empty(t, bundleFS.Chunks())
+			}
+		})
+	}
+}
+
+func TestMultiReaderAtReadsAcrossParts(t *testing.T) {
+	parts := [][]byte{[]byte("hello"), []byte(", "), []byte("world"), []byte("!")}
+	readers := make([]sizedReaderAt, 0, len(parts))
+	for _, part := range parts {
+		readers = append(readers, sizedReaderAt{ReaderAt: bytes.NewReader(part), size: int64(len(part))})
+	}
+	r := newMultiReaderAt(readers)
+
+	buf := make([]byte, 9)
+	n, err := r.ReadAt(buf, 3)
+	require.NoError(t, err)
+	require.Equal(t, 9, n)
+	require.Equal(t, "lo, world", string(buf))
+
+	buf = make([]byte, 4)
+	n, err = r.ReadAt(buf, 11)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 2, n)
+	require.Equal(t, "d!", string(buf[:n]))
+}
+
+func readAllFiles(t *testing.T, fsys fs.FS) map[string][]byte {
+	t.Helper()
+
+	files := map[string][]byte{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files[path], err = fs.ReadFile(fsys, path)
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+// tarOverhead returns the amount of bytes used by tar headers and trailer of the test file tree.
+func tarOverhead(bundleFormat string) int64 {
+	if bundleFormat == "directory" {
+		return 0
+	}
+	const headersSize, trailerSize = 3 * 512, 1024
+	return headersSize + trailerSize
+}
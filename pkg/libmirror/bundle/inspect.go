@@ -0,0 +1,156 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
+)
+
+// Contents describes everything that is stored in the bundle.
+type Contents struct {
+	Size     int64         `json:"size"`
+	Chunks   []ChunkInfo   `json:"chunks,omitempty"`
+	Layouts  []LayoutInfo  `json:"layouts"`
+	Modules  []ModuleInfo  `json:"modules,omitempty"`
+	Releases []ReleaseInfo `json:"releases,omitempty"`
+}
+
+type LayoutInfo struct {
+	Path   string      `json:"path"`
+	Images []ImageInfo `json:"images"`
+}
+
+type ImageInfo struct {
+	Reference string `json:"reference"`
+	Tag       string `json:"tag,omitempty"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ModuleInfo struct {
+	Name     string   `json:"name"`
+	Versions []string `json:"versions"`
+}
+
+type ReleaseInfo struct {
+	Tag string `json:"tag"`
+	*releases.ReleaseInfo
+	Changelog map[string]any `json:"changelog,omitempty"`
+}
+
+// Inspect reads OCI Image Layouts of the bundle and release metadata from the release-channel images.
+func Inspect(bundleFS *FS) (*Contents, error) {
+	layoutPaths, err := FindLayouts(bundleFS)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &Contents{
+		Size:    bundleFS.Size(),
+		Chunks:  bundleFS.Chunks(),
+		Layouts: make([]LayoutInfo, 0, len(layoutPaths)),
+	}
+
+	for _, layoutPath := range layoutPaths {
+		l := NewLayout(bundleFS, layoutPath)
+		layoutInfo, tags, err := inspectLayout(l)
+		if err != nil {
+			return nil, fmt.Errorf("inspect %s: %w", layoutPath, err)
+		}
+		contents.Layouts = append(contents.Layouts, layoutInfo)
+
+		if moduleName, isModule := ModuleNameFromLayoutPath(layoutPath); isModule {
+			versions := make([]string, 0)
+			for _, tag := range tags {
+				if IsVersionTag(tag) {
+					versions = append(versions, tag)
+				}
+			}
+			contents.Modules = append(contents.Modules, ModuleInfo{Name: moduleName, Versions: sortTags(versions)})
+		}
+
+		if layoutPath == "release-channel" {
+			contents.Releases, err = inspectReleases(l, tags)
+			if err != nil {
+				return nil, fmt.Errorf("inspect releases: %w", err)
+			}
+		}
+	}
+
+	return contents, nil
+}
+
+func inspectLayout(l Layout) (LayoutInfo, []string, error) {
+	indexManifest, err := l.IndexManifest()
+	if err != nil {
+		return LayoutInfo{}, nil, err
+	}
+
+	result := LayoutInfo{Path: l.Path, Images: make([]ImageInfo, 0, len(indexManifest.Manifests))}
+	tags := make([]string, 0, len(indexManifest.Manifests))
+	for _, desc := range indexManifest.Manifests {
+		imageSize, err := l.imageSize(desc.Digest)
+		if err != nil {
+			return LayoutInfo{}, nil, fmt.Errorf("read image %s: %w", desc.Digest, err)
+		}
+
+		imageInfo := ImageInfo{
+			Reference: ImageReference(desc),
+			Tag:       ImageTag(desc),
+			Digest:    desc.Digest.String(),
+			Size:      imageSize,
+		}
+		if imageInfo.Tag != "" {
+			tags = append(tags, imageInfo.Tag)
+		}
+		result.Images = append(result.Images, imageInfo)
+	}
+
+	slices.SortFunc(result.Images, func(a, b ImageInfo) int {
+		return strings.Compare(a.Reference, b.Reference)
+	})
+	return result, tags, nil
+}
+
+func inspectReleases(l Layout, tags []string) ([]ReleaseInfo, error) {
+	result := make([]ReleaseInfo, 0)
+	for _, tag := range sortTags(tags) {
+		if !IsVersionTag(tag) {
+			continue
+		}
+
+		img, err := l.FindImageByTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("read release-channel:%s: %w", tag, err)
+		}
+		releaseInfo, err := releases.ExtractReleaseInfoWithOptionalChangelog(img)
+		if err != nil {
+			return nil, fmt.Errorf("read release-channel:%s: %w", tag, err)
+		}
+
+		result = append(result, ReleaseInfo{
+			Tag:         tag,
+			ReleaseInfo: releaseInfo,
+			Changelog:   releaseInfo.Changelog,
+		})
+	}
+	return result, nil
+}
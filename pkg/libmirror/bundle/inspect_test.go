@@ -0,0 +1,88 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	bundlePath := t.TempDir()
+	stableImage := randomImage(t)
+	appendImages(t, bundlePath, map[string]v1.Image{
+		repo + ":v1.61.2": stableImage,
+		repo + ":stable":  stableImage,
+	})
+	appendImages(t, filepath.Join(bundlePath, "release-channel"), map[string]v1.Image{
+		repo + "/release-channel:v1.61.2": releaseChannelImage(t, "v1.61.2"),
+		repo + "/release-channel:stable":  releaseChannelImage(t, "v1.61.2"),
+	})
+	appendImages(t, filepath.Join(bundlePath, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.1.0": randomImage(t),
+		repo + "/modules/console:v1.0.0": randomImage(t),
+	})
+
+	bundleFS, err := OpenFS(bundlePath)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	contents, err := Inspect(bundleFS)
+	require.NoError(t, err)
+
+	require.Equal(t, bundleFS.Size(), contents.Size)
+	require.Empty(t, contents.Chunks)
+
+	require.Len(t, contents.Layouts, 3)
+	require.Equal(t, ".", contents.Layouts[0].Path)
+	require.Len(t, contents.Layouts[0].Images, 2)
+	require.Equal(t, repo+":stable", contents.Layouts[0].Images[0].Reference)
+	require.Equal(t, "stable", contents.Layouts[0].Images[0].Tag)
+	require.Equal(t, contents.Layouts[0].Images[0].Digest, contents.Layouts[0].Images[1].Digest)
+	require.Positive(t, contents.Layouts[0].Images[0].Size)
+
+	require.Equal(t, []ModuleInfo{{Name: "console", Versions: []string{"v1.0.0", "v1.1.0"}}}, contents.Modules)
+
+	require.Len(t, contents.Releases, 1)
+	require.Equal(t, "v1.61.2", contents.Releases[0].Tag)
+	require.Equal(t, "v1.61.2", contents.Releases[0].Version)
+	require.Equal(t, []string{"ingressNginx"}, contents.Releases[0].Disruptions["1.61"])
+	require.Contains(t, contents.Releases[0].Changelog, "candi")
+}
+
+func releaseChannelImage(t *testing.T, version string) v1.Image {
+	t.Helper()
+
+	l, err := crane.Layer(map[string][]byte{
+		"version.json":   []byte(fmt.Sprintf(`{"version":%q,"disruptions":{"1.61":["ingressNginx"]}}`, version)),
+		"changelog.yaml": []byte("candi:\n  fixes:\n  - summary: Fix containerd start.\n"),
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
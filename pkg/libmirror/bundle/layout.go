@@ -0,0 +1,210 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Layout is a read-only OCI Image Layout stored in the bundle file system.
+type Layout struct {
+	fsys fs.FS
+	Path string // Path to the layout relative to the bundle root, "." for the root layout.
+}
+
+func NewLayout(fsys fs.FS, layoutPath string) Layout {
+	return Layout{fsys: fsys, Path: path.Clean(layoutPath)}
+}
+
+// FindLayouts returns paths of all OCI Image Layouts in the bundle, sorted lexicographically.
+func FindLayouts(fsys fs.FS) ([]string, error) {
+	layoutPaths := make([]string, 0)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == "blobs" {
+			return fs.SkipDir
+		}
+		if _, err = fs.Stat(fsys, path.Join(p, "oci-layout")); err == nil {
+			layoutPaths = append(layoutPaths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk bundle: %w", err)
+	}
+
+	slices.Sort(layoutPaths)
+	return layoutPaths, nil
+}
+
+// IndexManifest reads and parses index.json of the layout.
+func (l Layout) IndexManifest() (*v1.IndexManifest, error) {
+	indexFile, err := l.fsys.Open(path.Join(l.Path, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("open index.json: %w", err)
+	}
+	defer indexFile.Close()
+
+	indexManifest, err := v1.ParseIndexManifest(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s/index.json: %w", l.Path, err)
+	}
+	return indexManifest, nil
+}
+
+// Blob opens the blob with the specified digest for reading.
+func (l Layout) Blob(digest v1.Hash) (io.ReadCloser, error) {
+	return l.fsys.Open(l.blobPath(digest))
+}
+
+// BlobSize returns the size of the blob with the specified digest.
+func (l Layout) BlobSize(digest v1.Hash) (int64, error) {
+	stat, err := fs.Stat(l.fsys, l.blobPath(digest))
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func (l Layout) blobPath(digest v1.Hash) string {
+	return path.Join(l.Path, "blobs", digest.Algorithm, digest.Hex)
+}
+
+// Image returns the image with the specified manifest digest from the layout.
+func (l Layout) Image(digest v1.Hash) (v1.Image, error) {
+	rawManifest, err := fs.ReadFile(l.fsys, l.blobPath(digest))
+	if err != nil {
+		return nil, fmt.Errorf("read image manifest: %w", err)
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("parse image manifest: %w", err)
+	}
+
+	return partial.CompressedToImage(&layoutImage{
+		layout:      l,
+		rawManifest: rawManifest,
+		manifest:    manifest,
+	})
+}
+
+// imageSize returns the amount of bytes taken by the image manifest, config and layers.
+func (l Layout) imageSize(digest v1.Hash) (int64, error) {
+	rawManifest, err := fs.ReadFile(l.fsys, l.blobPath(digest))
+	if err != nil {
+		return 0, fmt.Errorf("read image manifest: %w", err)
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return 0, fmt.Errorf("parse image manifest: %w", err)
+	}
+
+	size := int64(len(rawManifest)) + manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return size, nil
+}
+
+// FindImageByTag looks for the image tagged with tag and returns it, nil is returned if there is no such image.
+func (l Layout) FindImageByTag(tag string) (v1.Image, error) {
+	indexManifest, err := l.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range indexManifest.Manifests {
+		if ImageTag(desc) == tag {
+			return l.Image(desc.Digest)
+		}
+	}
+	return nil, nil
+}
+
+// ImageReference returns full image reference the image was pulled by.
+func ImageReference(desc v1.Descriptor) string {
+	return desc.Annotations["org.opencontainers.image.ref.name"]
+}
+
+// ImageTag returns tag of the image in the layout.
+// Images that were pulled by their digests have no tag, empty string is returned for them.
+func ImageTag(desc v1.Descriptor) string {
+	if strings.Contains(ImageReference(desc), "@") {
+		return ""
+	}
+	return desc.Annotations["io.deckhouse.image.short_tag"]
+}
+
+type layoutImage struct {
+	layout      Layout
+	rawManifest []byte
+	manifest    *v1.Manifest
+}
+
+var _ partial.CompressedImageCore = &layoutImage{}
+
+func (i *layoutImage) RawConfigFile() ([]byte, error) {
+	return fs.ReadFile(i.layout.fsys, i.layout.blobPath(i.manifest.Config.Digest))
+}
+
+func (i *layoutImage) MediaType() (types.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *layoutImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *layoutImage) LayerByDigest(digest v1.Hash) (partial.CompressedLayer, error) {
+	if digest == i.manifest.Config.Digest {
+		return &layoutBlob{layout: i.layout, desc: i.manifest.Config}, nil
+	}
+	for _, desc := range i.manifest.Layers {
+		if desc.Digest == digest {
+			return &layoutBlob{layout: i.layout, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in image manifest", digest)
+}
+
+type layoutBlob struct {
+	layout Layout
+	desc   v1.Descriptor
+}
+
+func (b *layoutBlob) Digest() (v1.Hash, error)            { return b.desc.Digest, nil }
+func (b *layoutBlob) Size() (int64, error)                { return b.desc.Size, nil }
+func (b *layoutBlob) MediaType() (types.MediaType, error) { return b.desc.MediaType, nil }
+func (b *layoutBlob) Compressed() (io.ReadCloser, error)  { return b.layout.Blob(b.desc.Digest) }
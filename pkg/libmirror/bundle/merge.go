@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+)
+
+// Merge combines layouts of several sources into a single bundle layouts tree at targetDir.
+// Every source may be a platform bundle, a directory of modules pulled with "d8 mirror modules pull"
+// or a directory of vulnerability databases pulled with "d8 mirror vulndb pull".
+// If the same image reference is found in several sources, the one from the latest source wins.
+func Merge(logger contexts.Logger, targetDir string, sources ...string) error {
+	writer := newLayoutsWriter(targetDir)
+	for _, source := range sources {
+		if err := mergeSource(logger, writer, source); err != nil {
+			return fmt.Errorf("merge %s: %w", source, err)
+		}
+	}
+
+	return writer.Close()
+}
+
+func mergeSource(logger contexts.Logger, writer *layoutsWriter, source string) error {
+	sourceFS, err := OpenFS(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFS.Close()
+
+	layoutPaths, err := FindLayouts(sourceFS)
+	if err != nil {
+		return err
+	}
+	if len(layoutPaths) == 0 {
+		return fmt.Errorf("no OCI Image Layouts found")
+	}
+
+	mountPath := DetectMountPath(layoutPaths)
+	logger.InfoF("Merging %s into %s", source, path.Join("<root>", mountPath))
+	for _, layoutPath := range layoutPaths {
+		srcLayout := NewLayout(sourceFS, layoutPath)
+		indexManifest, err := srcLayout.IndexManifest()
+		if err != nil {
+			return err
+		}
+
+		dstPath := path.Join(mountPath, layoutPath)
+		for _, desc := range indexManifest.Manifests {
+			replaced, err := writer.CopyImage(srcLayout, dstPath, desc)
+			if err != nil {
+				return fmt.Errorf("copy images of %s: %w", layoutPath, err)
+			}
+			if replaced {
+				logger.WarnF("%s is replaced with the image from %s", ImageReference(desc), source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DetectMountPath tells where the layouts of the merged source should be placed in the bundle
+// judging by the paths of these layouts.
+// Directory of vulnerability databases may hold extra security artifacts, so it is recognized by the default ones.
+func DetectMountPath(layoutPaths []string) string {
+	defaultArtifacts := security.Names(security.DefaultArtifacts)
+	allTopLevel, hasDefaultArtifact, isModules := true, false, true
+	for _, layoutPath := range layoutPaths {
+		parts := strings.Split(layoutPath, "/")
+		isTopLevel := layoutPath != "." && len(parts) == 1
+		if !isTopLevel {
+			allTopLevel = false
+		}
+		if isTopLevel && slices.Contains(defaultArtifacts, parts[0]) {
+			hasDefaultArtifact = true
+		}
+		isModuleLayout := layoutPath != "." && (len(parts) == 1 || (len(parts) == 2 && parts[1] == "release"))
+		if !isModuleLayout {
+			isModules = false
+		}
+	}
+
+	switch {
+	case allTopLevel && hasDefaultArtifact:
+		return "security"
+	case isModules:
+		return "modules"
+	default:
+		return "."
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+func TestMergeBundleWithModulesAndVulnerabilityDBs(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	sharedImage := randomImage(t)
+	platformBundle := t.TempDir()
+	appendImages(t, platformBundle, map[string]v1.Image{
+		repo + ":v1.61.2": sharedImage,
+	})
+	appendImages(t, filepath.Join(platformBundle, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.0.0": randomImage(t),
+	})
+
+	modulesDir := t.TempDir()
+	appendImages(t, filepath.Join(modulesDir, "stronghold"), map[string]v1.Image{
+		repo + "/modules/stronghold:v0.5.0": sharedImage,
+	})
+	appendImages(t, filepath.Join(modulesDir, "stronghold", "release"), map[string]v1.Image{
+		repo + "/modules/stronghold/release:v0.5.0": randomImage(t),
+	})
+
+	vulnDBDir := t.TempDir()
+	appendImages(t, filepath.Join(vulnDBDir, "trivy-db"), map[string]v1.Image{
+		repo + "/security/trivy-db:2": randomImage(t),
+	})
+
+	targetDir := t.TempDir()
+	err := Merge(log.NewSLogger(slog.LevelWarn), targetDir, platformBundle, modulesDir, vulnDBDir)
+	require.NoError(t, err)
+
+	targetFS, err := OpenFS(targetDir)
+	require.NoError(t, err)
+	defer targetFS.Close()
+
+	layoutPaths, err := FindLayouts(targetFS)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		".",
+		"modules/console",
+		"modules/stronghold",
+		"modules/stronghold/release",
+		"security/trivy-db",
+	}, layoutPaths)
+
+	img, err := NewLayout(targetFS, "modules/stronghold").FindImageByTag("v0.5.0")
+	require.NoError(t, err)
+	require.NotNil(t, img)
+
+	layers, err := sharedImage.Layers()
+	require.NoError(t, err)
+	layerDigest, err := layers[0].Digest()
+	require.NoError(t, err)
+	rootBlob, err := os.Stat(filepath.Join(targetDir, "blobs", "sha256", layerDigest.Hex))
+	require.NoError(t, err)
+	moduleBlob, err := os.Stat(filepath.Join(targetDir, "modules", "stronghold", "blobs", "sha256", layerDigest.Hex))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(rootBlob, moduleBlob), "Blobs shared between layouts should be stored only once")
+}
+
+func TestMergeReplacesImagesWithSameReference(t *testing.T) {
+	const ref = "registry.example.com/deckhouse/ee:v1.61.2"
+
+	oldBundle, newBundle := t.TempDir(), t.TempDir()
+	oldImage, newImage := randomImage(t), randomImage(t)
+	appendImages(t, oldBundle, map[string]v1.Image{ref: oldImage})
+	appendImages(t, newBundle, map[string]v1.Image{ref: newImage})
+
+	targetDir := t.TempDir()
+	require.NoError(t, Merge(log.NewSLogger(slog.LevelWarn), targetDir, oldBundle, newBundle))
+
+	targetFS, err := OpenFS(targetDir)
+	require.NoError(t, err)
+	defer targetFS.Close()
+
+	indexManifest, err := NewLayout(targetFS, ".").IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 1)
+	newDigest, err := newImage.Digest()
+	require.NoError(t, err)
+	require.Equal(t, newDigest, indexManifest.Manifests[0].Digest)
+
+	oldDigest, err := oldImage.Digest()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(targetDir, "blobs", oldDigest.Algorithm, oldDigest.Hex))
+	require.ErrorIs(t, err, fs.ErrNotExist, "Blobs of the replaced image should be deleted")
+	_, err = os.Stat(filepath.Join(targetDir, "blobs", newDigest.Algorithm, newDigest.Hex))
+	require.NoError(t, err)
+}
+
+func TestDetectMountPath(t *testing.T) {
+	require.Equal(t, ".", DetectMountPath([]string{".", "install", "modules/console", "security/trivy-db"}))
+	require.Equal(t, "modules", DetectMountPath([]string{"console", "console/release"}))
+	require.Equal(t, "security", DetectMountPath([]string{"trivy-bdu", "trivy-db"}))
+	require.Equal(t, "security", DetectMountPath([]string{"grype-db", "trivy-db"}))
+	require.Equal(t, "modules", DetectMountPath([]string{"grype-db"}))
+}
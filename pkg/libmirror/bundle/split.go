@@ -0,0 +1,174 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
+)
+
+// platformLayouts are the layouts that hold images of Deckhouse releases, tagged by release versions and channels.
+var platformLayouts = []string{".", "install", "install-standalone", "release-channel"}
+
+// SplitOptions selects what should be extracted from the bundle.
+type SplitOptions struct {
+	// Deckhouse releases to extract. Platform layouts and vulnerability databases are skipped if empty.
+	Versions []*semver.Version
+	// Names of modules to extract with all their versions.
+	Modules []string
+}
+
+// Split copies the subset of the bundle at sourcePath selected by opts into the bundle layouts tree at targetDir.
+func Split(sourcePath, targetDir string, opts SplitOptions) error {
+	sourceFS, err := OpenFS(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer sourceFS.Close()
+
+	layoutPaths, err := FindLayouts(sourceFS)
+	if err != nil {
+		return err
+	}
+
+	writer := newLayoutsWriter(targetDir)
+	if len(opts.Versions) > 0 {
+		if err = splitPlatform(sourceFS, writer, layoutPaths, opts.Versions); err != nil {
+			return err
+		}
+	}
+
+	for _, moduleName := range opts.Modules {
+		found := false
+		for _, layoutPath := range layoutPaths {
+			if layoutPath != path.Join("modules", moduleName) && layoutPath != path.Join("modules", moduleName, "release") {
+				continue
+			}
+			found = true
+			if err = copyLayout(writer, NewLayout(sourceFS, layoutPath), func(v1.Descriptor) bool { return true }); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("module %q not found in bundle", moduleName)
+		}
+	}
+
+	return writer.Close()
+}
+
+func splitPlatform(sourceFS *FS, writer *layoutsWriter, layoutPaths []string, versions []*semver.Version) error {
+	versionTags := make(map[string]struct{}, len(versions))
+	for _, version := range versions {
+		versionTags["v"+version.String()] = struct{}{}
+	}
+
+	// Images of Deckhouse components are pulled by digests that are listed in the installer image of the release.
+	// Older releases list tags of the images instead.
+	componentImages := map[string]struct{}{}
+	installLayout := NewLayout(sourceFS, "install")
+	for tag := range versionTags {
+		installer, err := installLayout.FindImageByTag(tag)
+		if err != nil {
+			return fmt.Errorf("read installer image %s: %w", tag, err)
+		}
+		if installer == nil {
+			return fmt.Errorf("release %s not found in bundle", tag)
+		}
+		imagesFile, err := images.ExtractFileFromImage(installer, "deckhouse/candi/images_digests.json")
+		if errors.Is(err, fs.ErrNotExist) {
+			imagesFile, err = images.ExtractFileFromImage(installer, "deckhouse/candi/images_tags.json")
+		}
+		if err != nil {
+			return fmt.Errorf("read images of release %s: %w", tag, err)
+		}
+		imageIDs, err := images.ImageIDsFromJSON(imagesFile)
+		if err != nil {
+			return fmt.Errorf("read images of release %s: %w", tag, err)
+		}
+		for _, imageID := range imageIDs {
+			componentImages[imageID] = struct{}{}
+		}
+	}
+
+	for _, layoutPath := range layoutPaths {
+		l := NewLayout(sourceFS, layoutPath)
+		switch {
+		case strings.HasPrefix(layoutPath, "security/"):
+			if err := copyLayout(writer, l, func(v1.Descriptor) bool { return true }); err != nil {
+				return err
+			}
+		case slices.Contains(platformLayouts, layoutPath):
+			indexManifest, err := l.IndexManifest()
+			if err != nil {
+				return err
+			}
+
+			// Release channel tags are kept only if they point to one of the selected releases.
+			selectedDigests := map[v1.Hash]struct{}{}
+			for _, desc := range indexManifest.Manifests {
+				if _, selected := versionTags[ImageTag(desc)]; selected {
+					selectedDigests[desc.Digest] = struct{}{}
+				}
+			}
+
+			err = copyLayout(writer, l, func(desc v1.Descriptor) bool {
+				tag := ImageTag(desc)
+				if tag == "" {
+					_, isComponent := componentImages[desc.Digest.String()]
+					return isComponent
+				}
+				if _, isComponent := componentImages[tag]; isComponent {
+					return true
+				}
+				_, selected := selectedDigests[desc.Digest]
+				return selected
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func copyLayout(writer *layoutsWriter, src Layout, filter func(desc v1.Descriptor) bool) error {
+	indexManifest, err := src.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range indexManifest.Manifests {
+		if !filter(desc) {
+			continue
+		}
+		if _, err = writer.CopyImage(src, src.Path, desc); err != nil {
+			return fmt.Errorf("copy images of %s: %w", src.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSelectedReleasesAndModules(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	bundlePath := t.TempDir()
+	componentA, componentB := randomImage(t), randomImage(t)
+	componentADigest, err := componentA.Digest()
+	require.NoError(t, err)
+	componentBDigest, err := componentB.Digest()
+	require.NoError(t, err)
+
+	oldRelease, newRelease := randomImage(t), randomImage(t)
+	appendImages(t, bundlePath, map[string]v1.Image{
+		repo + ":v1.61.2":                      oldRelease,
+		repo + ":v1.62.0":                      newRelease,
+		repo + ":stable":                       oldRelease,
+		repo + ":alpha":                        newRelease,
+		repo + "@" + componentADigest.String(): componentA,
+		repo + "@" + componentBDigest.String(): componentB,
+	})
+	appendImages(t, filepath.Join(bundlePath, "install"), map[string]v1.Image{
+		repo + "/install:v1.61.2": installerImage(t, componentADigest),
+		repo + "/install:v1.62.0": installerImage(t, componentBDigest),
+	})
+	appendImages(t, filepath.Join(bundlePath, "security", "trivy-db"), map[string]v1.Image{
+		repo + "/security/trivy-db:2": randomImage(t),
+	})
+	appendImages(t, filepath.Join(bundlePath, "modules", "console"), map[string]v1.Image{
+		repo + "/modules/console:v1.0.0": randomImage(t),
+	})
+	appendImages(t, filepath.Join(bundlePath, "modules", "stronghold"), map[string]v1.Image{
+		repo + "/modules/stronghold:v0.5.0": randomImage(t),
+	})
+
+	targetDir := t.TempDir()
+	err = Split(bundlePath, targetDir, SplitOptions{
+		Versions: []*semver.Version{semver.MustParse("1.61.2")},
+		Modules:  []string{"console"},
+	})
+	require.NoError(t, err)
+
+	targetFS, err := OpenFS(targetDir)
+	require.NoError(t, err)
+	defer targetFS.Close()
+
+	layoutPaths, err := FindLayouts(targetFS)
+	require.NoError(t, err)
+	require.Equal(t, []string{".", "install", "modules/console", "security/trivy-db"}, layoutPaths)
+
+	rootIndex, err := NewLayout(targetFS, ".").IndexManifest()
+	require.NoError(t, err)
+	refs := make([]string, 0)
+	for _, desc := range rootIndex.Manifests {
+		refs = append(refs, ImageReference(desc))
+	}
+	require.ElementsMatch(t, []string{
+		repo + ":v1.61.2",
+		repo + ":stable",
+		repo + "@" + componentADigest.String(),
+	}, refs)
+
+	err = Split(bundlePath, t.TempDir(), SplitOptions{Modules: []string{"unknown"}})
+	require.ErrorContains(t, err, `module "unknown" not found`)
+}
+
+func TestSplitReleaseWithImagesTags(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	bundlePath := t.TempDir()
+	release, component := randomImage(t), randomImage(t)
+	appendImages(t, bundlePath, map[string]v1.Image{
+		repo + ":v1.50.1":                     release,
+		repo + ":0a1b2c3d4e5f-controlPlane":   component,
+		repo + ":ffffffffffff-unused-release": randomImage(t),
+	})
+	imagesTags, err := json.Marshal(map[string]map[string]string{
+		"controlPlaneManager": {"kubeApiserver": "0a1b2c3d4e5f-controlPlane"},
+	})
+	require.NoError(t, err)
+	appendImages(t, filepath.Join(bundlePath, "install"), map[string]v1.Image{
+		repo + "/install:v1.50.1": imageWithFiles(t, map[string][]byte{"deckhouse/candi/images_tags.json": imagesTags}),
+	})
+
+	targetDir := t.TempDir()
+	require.NoError(t, Split(bundlePath, targetDir, SplitOptions{Versions: []*semver.Version{semver.MustParse("1.50.1")}}))
+
+	targetFS, err := OpenFS(targetDir)
+	require.NoError(t, err)
+	defer targetFS.Close()
+	rootIndex, err := NewLayout(targetFS, ".").IndexManifest()
+	require.NoError(t, err)
+	refs := make([]string, 0)
+	for _, desc := range rootIndex.Manifests {
+		refs = append(refs, ImageReference(desc))
+	}
+	require.ElementsMatch(t, []string{repo + ":v1.50.1", repo + ":0a1b2c3d4e5f-controlPlane"}, refs)
+}
+
+// installerImage creates the installer image listing component digests the same way Deckhouse does,
+// grouped by the modules the components belong to.
+func installerImage(t *testing.T, componentDigests ...v1.Hash) v1.Image {
+	t.Helper()
+
+	digestsByModule := map[string]map[string]string{}
+	for i, digest := range componentDigests {
+		moduleName := fmt.Sprintf("module%d", i%2)
+		if digestsByModule[moduleName] == nil {
+			digestsByModule[moduleName] = map[string]string{}
+		}
+		digestsByModule[moduleName][fmt.Sprintf("component%d", i)] = digest.String()
+	}
+	digestsJSON, err := json.Marshal(digestsByModule)
+	require.NoError(t, err)
+
+	return imageWithFiles(t, map[string][]byte{"deckhouse/candi/images_digests.json": digestsJSON})
+}
+
+func imageWithFiles(t *testing.T, files map[string][]byte) v1.Image {
+	t.Helper()
+
+	l, err := crane.Layer(files)
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
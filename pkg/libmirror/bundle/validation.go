@@ -11,12 +11,14 @@ import (
 
 func ValidateUnpackedBundle(mirrorCtx *contexts.PushContext) error {
 	mandatoryLayouts := map[string]string{
-		"root layout":                mirrorCtx.UnpackedImagesPath,
-		"installers layout":          filepath.Join(mirrorCtx.UnpackedImagesPath, "install"),
-		"release channels layout":    filepath.Join(mirrorCtx.UnpackedImagesPath, "release-channel"),
-		"trivy database layout":      filepath.Join(mirrorCtx.UnpackedImagesPath, "security", "trivy-db"),
-		"trivy bdu layout":           filepath.Join(mirrorCtx.UnpackedImagesPath, "security", "trivy-bdu"),
-		"trivy java database layout": filepath.Join(mirrorCtx.UnpackedImagesPath, "security", "trivy-java-db"),
+		"root layout":             mirrorCtx.UnpackedImagesPath,
+		"installers layout":       filepath.Join(mirrorCtx.UnpackedImagesPath, "install"),
+		"release channels layout": filepath.Join(mirrorCtx.UnpackedImagesPath, "release-channel"),
+	}
+	for _, artifact := range mirrorCtx.Security() {
+		if !artifact.Optional {
+			mandatoryLayouts[artifact.Name+" layout"] = filepath.Join(mirrorCtx.UnpackedImagesPath, "security", artifact.Name)
+		}
 	}
 
 	for layoutDescription, fsPath := range mandatoryLayouts {
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+)
+
+// layoutsWriter copies images from bundle layouts into the tree of OCI Image Layouts at rootDir.
+// Every blob is written to disk only once, copies of it in other layouts are hard links to the first one.
+type layoutsWriter struct {
+	rootDir string
+	indexes map[string]*v1.IndexManifest
+	blobs   map[v1.Hash]string
+	// Layouts where images were replaced, blobs of the replaced images are deleted on close.
+	replaced map[string]struct{}
+}
+
+func newLayoutsWriter(rootDir string) *layoutsWriter {
+	return &layoutsWriter{
+		rootDir:  rootDir,
+		indexes:  map[string]*v1.IndexManifest{},
+		blobs:    map[v1.Hash]string{},
+		replaced: map[string]struct{}{},
+	}
+}
+
+// CopyImage copies image or image index described by desc from src layout to the layout at dstPath.
+// Image that is already in the destination layout under the same reference is replaced with the new one.
+func (w *layoutsWriter) CopyImage(src Layout, dstPath string, desc v1.Descriptor) (replaced bool, err error) {
+	index, err := w.layoutIndex(dstPath)
+	if err != nil {
+		return false, err
+	}
+
+	if err = w.copyManifest(src, dstPath, desc); err != nil {
+		return false, fmt.Errorf("copy %s: %w", desc.Digest, err)
+	}
+
+	ref := ImageReference(desc)
+	for i, existing := range index.Manifests {
+		switch {
+		case ref != "" && ImageReference(existing) == ref:
+			replaced = existing.Digest != desc.Digest
+			if replaced {
+				w.replaced[dstPath] = struct{}{}
+			}
+			index.Manifests[i] = desc
+			return replaced, nil
+		case ref == "" && ImageReference(existing) == "" && existing.Digest == desc.Digest:
+			return false, nil
+		}
+	}
+
+	index.Manifests = append(index.Manifests, desc)
+	return false, nil
+}
+
+// Close writes index.json files of all layouts that were written to
+// and deletes blobs of the images replaced by the newer ones.
+func (w *layoutsWriter) Close() error {
+	for layoutPath, index := range w.indexes {
+		rawIndex, err := json.MarshalIndent(index, "", "    ")
+		if err != nil {
+			return fmt.Errorf("marshal %s/index.json: %w", layoutPath, err)
+		}
+		if err = os.WriteFile(filepath.Join(w.rootDir, layoutPath, "index.json"), rawIndex, 0o644); err != nil {
+			return fmt.Errorf("write %s/index.json: %w", layoutPath, err)
+		}
+	}
+
+	for layoutPath := range w.replaced {
+		if err := w.deleteUnreferencedBlobs(layoutPath); err != nil {
+			return fmt.Errorf("delete replaced images blobs of %s: %w", layoutPath, err)
+		}
+	}
+	return nil
+}
+
+// deleteUnreferencedBlobs removes blobs that are not referenced by any image or image index of the layout.
+func (w *layoutsWriter) deleteUnreferencedBlobs(layoutPath string) error {
+	layoutDir := filepath.Join(w.rootDir, layoutPath)
+	referenced := map[v1.Hash]struct{}{}
+	for _, desc := range w.indexes[layoutPath].Manifests {
+		if err := collectReferencedBlobs(layoutDir, desc, referenced); err != nil {
+			return err
+		}
+	}
+
+	return filepath.WalkDir(filepath.Join(layoutDir, "blobs"), func(blobPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		algorithm := filepath.Base(filepath.Dir(blobPath))
+		if _, found := referenced[v1.Hash{Algorithm: algorithm, Hex: d.Name()}]; found {
+			return nil
+		}
+		return os.Remove(blobPath)
+	})
+}
+
+func collectReferencedBlobs(layoutDir string, desc v1.Descriptor, referenced map[v1.Hash]struct{}) error {
+	referenced[desc.Digest] = struct{}{}
+	rawManifest, err := os.ReadFile(filepath.Join(layoutDir, "blobs", desc.Digest.Algorithm, desc.Digest.Hex))
+	if err != nil {
+		return fmt.Errorf("read manifest %s: %w", desc.Digest, err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(rawManifest))
+		if err != nil {
+			return fmt.Errorf("parse image index %s: %w", desc.Digest, err)
+		}
+		for _, childDesc := range indexManifest.Manifests {
+			if err = collectReferencedBlobs(layoutDir, childDesc, referenced); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return fmt.Errorf("parse image manifest %s: %w", desc.Digest, err)
+	}
+	referenced[manifest.Config.Digest] = struct{}{}
+	for _, layer := range manifest.Layers {
+		referenced[layer.Digest] = struct{}{}
+	}
+	return nil
+}
+
+func (w *layoutsWriter) layoutIndex(layoutPath string) (*v1.IndexManifest, error) {
+	if index, found := w.indexes[layoutPath]; found {
+		return index, nil
+	}
+
+	if _, err := layouts.CreateEmptyImageLayoutAtPath(filepath.Join(w.rootDir, layoutPath)); err != nil {
+		return nil, fmt.Errorf("create %s layout: %w", layoutPath, err)
+	}
+	index := &v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.oci.image.index.v1+json",
+		Manifests:     make([]v1.Descriptor, 0),
+	}
+	w.indexes[layoutPath] = index
+	return index, nil
+}
+
+func (w *layoutsWriter) copyManifest(src Layout, dstPath string, desc v1.Descriptor) error {
+	if err := w.copyBlob(src, dstPath, desc.Digest); err != nil {
+		return err
+	}
+	rawManifest, err := fs.ReadFile(src.fsys, src.blobPath(desc.Digest))
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(rawManifest))
+		if err != nil {
+			return fmt.Errorf("parse image index: %w", err)
+		}
+		for _, childDesc := range indexManifest.Manifests {
+			if err = w.copyManifest(src, dstPath, childDesc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return fmt.Errorf("parse image manifest: %w", err)
+	}
+	if err = w.copyBlob(src, dstPath, manifest.Config.Digest); err != nil {
+		return err
+	}
+	for _, layer := range manifest.Layers {
+		if err = w.copyBlob(src, dstPath, layer.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *layoutsWriter) copyBlob(src Layout, dstPath string, digest v1.Hash) error {
+	blobPath := filepath.Join(w.rootDir, dstPath, "blobs", digest.Algorithm, digest.Hex)
+	if _, err := os.Stat(blobPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return fmt.Errorf("create blobs directory: %w", err)
+	}
+
+	if existingBlobPath, found := w.blobs[digest]; found {
+		if err := os.Link(existingBlobPath, blobPath); err == nil {
+			return nil
+		}
+		// Hard links are not supported by every file system, fall back to copying the data.
+	}
+
+	blob, err := src.Blob(digest)
+	if err != nil {
+		return fmt.Errorf("open blob %s: %w", digest, err)
+	}
+	defer blob.Close()
+
+	if err = writeFileAtomically(blobPath, blob); err != nil {
+		return fmt.Errorf("write blob %s: %w", digest, err)
+	}
+	w.blobs[digest] = blobPath
+	return nil
+}
+
+// writeFileAtomically writes contents to a temporary file and renames it to filePath,
+// so that interrupted writes never leave partially written blobs behind.
+func writeFileAtomically(filePath string, contents io.Reader) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-"+filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmpFile, contents)
+	err = errors.Join(err, tmpFile.Close())
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filePath)
+}
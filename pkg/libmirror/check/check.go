@@ -0,0 +1,361 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/registry"
+)
+
+// WriteCheckTag is the tag of the synthetic image that older versions of d8 pushed to check write access to the registry.
+const WriteCheckTag = "d8WriteCheck"
+
+type IssueKind string
+
+const (
+	MissingRepo     IssueKind = "missing-repo"
+	MissingTag      IssueKind = "missing-tag"
+	DigestMismatch  IssueKind = "digest-mismatch"
+	BrokenManifest  IssueKind = "broken-manifest"
+	MissingBlob     IssueKind = "missing-blob"
+	LeftoverTestTag IssueKind = "leftover-write-check"
+)
+
+type Issue struct {
+	Kind      IssueKind `json:"kind"`
+	Reference string    `json:"reference"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// String formats the issue for humans.
+func (i Issue) String() string {
+	b := strings.Builder{}
+	b.WriteString(string(i.Kind))
+	b.WriteString(": ")
+	b.WriteString(i.Reference)
+	if i.Details != "" {
+		b.WriteString(" (")
+		b.WriteString(i.Details)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+type Report struct {
+	Repos  int     `json:"repos"`
+	Images int     `json:"images"`
+	Blobs  int     `json:"blobs"`
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+func (r *Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// expectedRepo is the registry repository along with tags that must be present in it.
+type expectedRepo struct {
+	repo string
+	// Expected digests by tags, zero digest matches any image. Nil map means that every tag found
+	// in the registry is checked without comparing its digest.
+	tags map[string]v1.Hash
+	// Optional repos are not reported if missing.
+	optional bool
+}
+
+// Options are the settings of d8 mirror push that change repositories images are pushed to.
+type Options struct {
+	RewriteRules *rewrite.Rules
+	// Repository extra images of the bundle were pushed to, by default they are under the extra path of the root repo.
+	ExtraImagesRepo string
+}
+
+// repo returns the repository the layout at bundlePath is pushed to, the same way d8 mirror push does.
+func (o Options) repo(rootRepo, bundlePath string) string {
+	repo := path.Join(rootRepo, bundlePath)
+	if relPath, isExtra := strings.CutPrefix(bundlePath, extra.Folder+"/"); isExtra && o.ExtraImagesRepo != "" {
+		repo = path.Join(o.ExtraImagesRepo, relPath)
+	}
+	return o.RewriteRules.Repo(repo)
+}
+
+// Registry checks contents of the registry at mirrorCtx.RegistryHost and mirrorCtx.RegistryPath.
+// If bundleFS is not nil, every image from the bundle must be in the registry under the same tag and digest,
+// otherwise all images found in the Deckhouse repositories are checked to be complete.
+// Expected repositories are mapped through opts the same way push maps them.
+func Registry(ctx context.Context, mirrorCtx *contexts.BaseContext, bundleFS *bundle.FS, opts Options) (*Report, error) {
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
+	c := &checker{
+		logger:       mirrorCtx.Logger,
+		nameOpts:     nameOpts,
+		remoteOpts:   remoteOpts,
+		report:       &Report{},
+		checkedBlobs: map[string]struct{}{},
+	}
+	rootRepo := path.Join(mirrorCtx.RegistryHost, mirrorCtx.RegistryPath)
+
+	var (
+		repos []expectedRepo
+		err   error
+	)
+	if bundleFS != nil {
+		repos, err = expectedReposFromBundle(bundleFS, rootRepo, opts)
+	} else {
+		repos, err = c.expectedReposFromRegistry(rootRepo, mirrorCtx.Security(), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repos {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err = c.checkRepo(repo); err != nil {
+			return nil, fmt.Errorf("check %s: %w", repo.repo, err)
+		}
+	}
+	return c.report, nil
+}
+
+func expectedReposFromBundle(bundleFS *bundle.FS, rootRepo string, opts Options) ([]expectedRepo, error) {
+	layoutPaths, err := bundle.FindLayouts(bundleFS)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]expectedRepo, 0, len(layoutPaths)+1)
+	modulesRepo := expectedRepo{repo: opts.repo(rootRepo, "modules"), tags: map[string]v1.Hash{}}
+	for _, layoutPath := range layoutPaths {
+		indexManifest, err := bundle.NewLayout(bundleFS, layoutPath).IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", layoutPath, err)
+		}
+
+		repo := expectedRepo{repo: opts.repo(rootRepo, layoutPath), tags: map[string]v1.Hash{}}
+		for _, desc := range indexManifest.Manifests {
+			if tag := desc.Annotations["io.deckhouse.image.short_tag"]; tag != "" {
+				repo.tags[tag] = desc.Digest
+			}
+		}
+		repos = append(repos, repo)
+
+		if moduleName, isModule := bundle.ModuleNameFromLayoutPath(layoutPath); isModule {
+			// Images under module tags are generated during push, so only the tag itself is expected.
+			modulesRepo.tags[moduleName] = v1.Hash{}
+		}
+	}
+	if len(modulesRepo.tags) > 0 {
+		repos = append(repos, modulesRepo)
+	}
+	return repos, nil
+}
+
+func (c *checker) expectedReposFromRegistry(rootRepo string, securityArtifacts []security.Artifact, opts Options) ([]expectedRepo, error) {
+	repos := []expectedRepo{
+		{repo: opts.repo(rootRepo, "")},
+		{repo: opts.repo(rootRepo, "install")},
+		{repo: opts.repo(rootRepo, "install-standalone")},
+		{repo: opts.repo(rootRepo, "release-channel")},
+		{repo: opts.repo(rootRepo, "modules"), optional: true},
+	}
+	for _, artifact := range securityArtifacts {
+		repos = append(repos, expectedRepo{repo: opts.repo(rootRepo, path.Join("security", artifact.Name)), optional: true})
+	}
+
+	modules, err := registry.ListTags(opts.repo(rootRepo, "modules"), c.nameOpts, c.remoteOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list modules: %w", err)
+	}
+	for _, moduleName := range modules {
+		if moduleName == WriteCheckTag {
+			continue
+		}
+		repos = append(repos,
+			expectedRepo{repo: opts.repo(rootRepo, path.Join("modules", moduleName))},
+			expectedRepo{repo: opts.repo(rootRepo, path.Join("modules", moduleName, "release"))},
+		)
+	}
+	return repos, nil
+}
+
+type checker struct {
+	logger     contexts.Logger
+	nameOpts   []name.Option
+	remoteOpts []remote.Option
+	report     *Report
+	// Blobs that were found in the registry, as repo@digest.
+	checkedBlobs map[string]struct{}
+}
+
+func (c *checker) addIssue(kind IssueKind, ref, details string) {
+	c.report.Issues = append(c.report.Issues, Issue{Kind: kind, Reference: ref, Details: details})
+}
+
+func (c *checker) checkRepo(repo expectedRepo) error {
+	c.logger.DebugF("Checking %s", repo.repo)
+	registryTags, err := registry.ListTags(repo.repo, c.nameOpts, c.remoteOpts)
+	if err != nil {
+		return err
+	}
+	c.report.Repos++
+
+	if slices.Contains(registryTags, WriteCheckTag) {
+		c.addIssue(LeftoverTestTag, repo.repo+":"+WriteCheckTag, "image left by the registry write access check")
+	}
+
+	tags := make([]string, 0, len(registryTags))
+	if repo.tags == nil {
+		if len(registryTags) == 0 && !repo.optional {
+			c.addIssue(MissingRepo, repo.repo, "repository has no tags")
+		}
+		for _, tag := range registryTags {
+			if tag != WriteCheckTag {
+				tags = append(tags, tag)
+			}
+		}
+	} else {
+		for tag := range repo.tags {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+
+	for _, tag := range tags {
+		if repo.tags != nil && !slices.Contains(registryTags, tag) {
+			c.addIssue(MissingTag, repo.repo+":"+tag, "")
+			continue
+		}
+		if err = c.checkImage(repo.repo, tag, repo.tags[tag]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkImage(repo, tag string, expectedDigest v1.Hash) error {
+	ref, err := name.NewTag(repo+":"+tag, c.nameOpts...)
+	if err != nil {
+		return err
+	}
+	c.report.Images++
+
+	desc, err := remote.Get(ref, c.remoteOpts...)
+	if err != nil {
+		if errorutil.IsNotFoundError(err) {
+			c.addIssue(MissingTag, ref.String(), "tag is listed, but its manifest is missing")
+			return nil
+		}
+		return fmt.Errorf("get %s: %w", ref, err)
+	}
+	if expectedDigest != (v1.Hash{}) && desc.Digest != expectedDigest {
+		c.addIssue(DigestMismatch, ref.String(), fmt.Sprintf("expected %s, found %s", expectedDigest, desc.Digest))
+	}
+
+	return c.checkDescriptor(ref.String(), ref.Context(), desc)
+}
+
+// checkDescriptor checks that all blobs of the image or of every image in the index are present in the registry.
+func (c *checker) checkDescriptor(ref string, repo name.Repository, desc *remote.Descriptor) error {
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			c.addIssue(BrokenManifest, ref, err.Error())
+			return nil
+		}
+		for _, child := range indexManifest.Manifests {
+			childDesc, err := remote.Get(repo.Digest(child.Digest.String()), c.remoteOpts...)
+			if err != nil {
+				if errorutil.IsNotFoundError(err) {
+					c.addIssue(BrokenManifest, ref, fmt.Sprintf("manifest %s is missing", child.Digest))
+					continue
+				}
+				return err
+			}
+			if err = c.checkDescriptor(ref, repo, childDesc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		c.addIssue(BrokenManifest, ref, err.Error())
+		return nil
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		c.addIssue(BrokenManifest, ref, err.Error())
+		return nil
+	}
+
+	blobs := []v1.Hash{manifest.Config.Digest}
+	for _, layer := range manifest.Layers {
+		blobs = append(blobs, layer.Digest)
+	}
+	for _, blob := range blobs {
+		if err = c.checkBlob(ref, repo.Digest(blob.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkBlob(imageRef string, blobRef name.Digest) error {
+	if _, checked := c.checkedBlobs[blobRef.String()]; checked {
+		return nil
+	}
+
+	layer, err := remote.Layer(blobRef, c.remoteOpts...)
+	if err != nil {
+		return err
+	}
+	exists, err := partial.Exists(layer)
+	if err != nil && !errorutil.IsNotFoundError(err) {
+		return fmt.Errorf("check blob %s: %w", blobRef, err)
+	}
+	if !exists {
+		c.addIssue(MissingBlob, imageRef, "blob "+blobRef.DigestStr()+" is missing")
+		return nil
+	}
+
+	c.report.Blobs++
+	c.checkedBlobs[blobRef.String()] = struct{}{}
+	return nil
+}
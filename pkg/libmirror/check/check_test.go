@@ -0,0 +1,189 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+	mirrorTestUtils "github.com/deckhouse/deckhouse-cli/testing/util/mirror"
+)
+
+func TestCheckRegistryAgainstBundle(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	platformImage, installImage, moduleImage := randomImage(t), randomImage(t), randomImage(t)
+	bundleDir := t.TempDir()
+	appendImages(t, bundleDir, "registry.deckhouse.io/deckhouse/ee", map[string]v1.Image{"v1.61.0": platformImage})
+	appendImages(t, filepath.Join(bundleDir, "install"), "registry.deckhouse.io/deckhouse/ee/install", map[string]v1.Image{"v1.61.0": installImage})
+	appendImages(t, filepath.Join(bundleDir, "modules", "console"), "registry.deckhouse.io/deckhouse/ee/modules/console", map[string]v1.Image{"v1.2.3": moduleImage})
+
+	tagImage(t, repo+":v1.61.0", platformImage)
+	tagImage(t, repo+":"+WriteCheckTag, randomImage(t))
+	tagImage(t, repo+"/install:v1.61.0", randomImage(t))
+
+	bundleFS, err := bundle.OpenFS(bundleDir)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	report, err := Registry(context.Background(), mirrorCtx, bundleFS, Options{})
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.ElementsMatch(t, []string{
+		string(LeftoverTestTag) + " " + repo + ":" + WriteCheckTag,
+		string(DigestMismatch) + " " + repo + "/install:v1.61.0",
+		string(MissingTag) + " " + repo + "/modules/console:v1.2.3",
+		string(MissingTag) + " " + repo + "/modules:console",
+	}, issueRefs(report))
+}
+
+func TestCheckRegistryFindsMissingBlobsAndRepos(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	tagImage(t, repo+":v1.61.0", randomImage(t))
+	tagImage(t, repo+"/release-channel:v1.61.0", randomImage(t))
+	tagImage(t, repo+"/release-channel:stable", randomImage(t))
+	// Only the manifest is uploaded, registry has none of the image blobs.
+	brokenImage := randomImage(t)
+	require.NoError(t, remote.Put(parseReference(t, repo+"/install:v1.61.0"), brokenImage))
+
+	report, err := Registry(context.Background(), mirrorCtx, nil, Options{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		string(MissingBlob) + " " + repo + "/install:v1.61.0",
+		string(MissingBlob) + " " + repo + "/install:v1.61.0",
+		string(MissingRepo) + " " + repo + "/install-standalone",
+	}, issueRefs(report))
+	require.Equal(t, 4, report.Images)
+}
+
+func TestCheckCompleteRegistry(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	for _, ref := range []string{"", "/install", "/install-standalone", "/release-channel", "/modules/console", "/modules/console/release"} {
+		tagImage(t, repo+ref+":v1.61.0", randomImage(t))
+	}
+	tagImage(t, repo+"/modules:console", randomImage(t))
+
+	report, err := Registry(context.Background(), mirrorCtx, nil, Options{})
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Issues)
+	require.Equal(t, 7, report.Images)
+	require.Equal(t, 11, report.Repos)
+}
+
+func TestCheckRegistryWithRewriteRulesAndExtraImagesRepo(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	platformImage, moduleImage, extraImage := randomImage(t), randomImage(t), randomImage(t)
+	bundleDir := t.TempDir()
+	appendImages(t, bundleDir, "registry.deckhouse.io/deckhouse/ee", map[string]v1.Image{"v1.61.0": platformImage})
+	appendImages(t, filepath.Join(bundleDir, "modules", "console"), "registry.deckhouse.io/deckhouse/ee/modules/console", map[string]v1.Image{"v1.2.3": moduleImage})
+	appendImages(t, filepath.Join(bundleDir, "extra", "library", "nginx"), "docker.io/library/nginx", map[string]v1.Image{"1.27": extraImage})
+
+	tagImage(t, repo+":v1.61.0", platformImage)
+	tagImage(t, repo+"-modules/console:v1.2.3", moduleImage)
+	tagImage(t, repo+"-modules:console", randomImage(t))
+	tagImage(t, repo+"-extra/library/nginx:1.27", extraImage)
+
+	rules, err := rewrite.Parse([]byte("rules:\n  - prefix: " + repo + "/modules\n    replacement: " + repo + "-modules\n"))
+	require.NoError(t, err)
+
+	bundleFS, err := bundle.OpenFS(bundleDir)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	report, err := Registry(context.Background(), mirrorCtx, bundleFS, Options{RewriteRules: rules, ExtraImagesRepo: repo + "-extra"})
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Issues)
+	require.Equal(t, 4, report.Repos)
+
+	report, err = Registry(context.Background(), mirrorCtx, nil, Options{RewriteRules: rules})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		string(MissingRepo) + " " + repo + "/install",
+		string(MissingRepo) + " " + repo + "/install-standalone",
+		string(MissingRepo) + " " + repo + "/release-channel",
+		string(MissingRepo) + " " + repo + "-modules/console/release",
+	}, issueRefs(report))
+}
+
+func issueRefs(report *Report) []string {
+	result := make([]string, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		result = append(result, string(issue.Kind)+" "+issue.Reference)
+	}
+	return result
+}
+
+func setupRegistry(t *testing.T) (*contexts.BaseContext, string) {
+	t.Helper()
+	host, repoPath, _ := mirrorTestUtils.SetupEmptyRegistryRepo(false)
+	return &contexts.BaseContext{
+		RegistryHost: host,
+		RegistryPath: repoPath,
+		Insecure:     true,
+		Logger:       log.NewSLogger(slog.LevelWarn),
+	}, host + repoPath
+}
+
+func appendImages(t *testing.T, layoutPath, repo string, images map[string]v1.Image) {
+	t.Helper()
+
+	l, err := layouts.CreateEmptyImageLayoutAtPath(layoutPath)
+	require.NoError(t, err)
+	for tag, img := range images {
+		err = l.AppendImage(img, layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": repo + ":" + tag,
+			"io.deckhouse.image.short_tag":      tag,
+		}))
+		require.NoError(t, err)
+	}
+}
+
+func randomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	return img
+}
+
+func tagImage(t *testing.T, ref string, img v1.Image) {
+	t.Helper()
+	require.NoError(t, remote.Write(parseReference(t, ref), img))
+}
+
+func parseReference(t *testing.T, ref string) name.Reference {
+	t.Helper()
+	parsed, err := name.ParseReference(ref, name.Insecure)
+	require.NoError(t, err)
+	return parsed
+}
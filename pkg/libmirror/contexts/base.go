@@ -18,6 +18,8 @@ package contexts
 
 import (
 	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 )
 
 type Logger interface {
@@ -48,5 +50,15 @@ type BaseContext struct {
 	Insecure            bool // --insecure
 	SkipTLSVerification bool // --skip-tls-verify
 
+	SecurityArtifacts []security.Artifact // --security-artifacts, security.DefaultArtifacts if nil
+
 	Logger Logger
 }
+
+// Security returns the artifacts copied into the security repo.
+func (c *BaseContext) Security() []security.Artifact {
+	if c.SecurityArtifacts == nil {
+		return security.DefaultArtifacts
+	}
+	return c.SecurityArtifacts
+}
@@ -18,6 +18,8 @@ package contexts
 
 import (
 	"github.com/Masterminds/semver/v3"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 )
 
 // PullContext holds data related to pending mirroring-from-registry operation.
@@ -28,6 +30,10 @@ type PullContext struct {
 	SkipModulesPull bool  // --no-modules
 	BundleChunkSize int64 // Plain bytes
 
+	BundleCompression string // --bundle-compression, empty for plain tar
+
+	ExtraImages []extra.Image // --extra-images
+
 	// Only one of those 2 is filled at a single time or none at all.
 	MinVersion      *semver.Version // --min-version
 	SpecificVersion *semver.Version // --release
@@ -16,19 +16,44 @@ limitations under the License.
 
 package contexts
 
+import (
+	"errors"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+)
+
 // PushContext holds data related to pending mirroring-to-registry operation.
 type PushContext struct {
 	BaseContext
 
 	Parallelism ParallelismConfig
+
+	// Security databases are pushed on the best effort basis, as registry might not accept their media types.
+	OptionalSecurityDatabases bool
+
+	// Rules to push images into other repositories than the ones under RegistryHost and RegistryPath, nil if not used.
+	RewriteRules *rewrite.Rules
+
+	// Repo extra images of the bundle are pushed under, extra repo under RegistryHost and RegistryPath if empty.
+	ExtraImagesRepo string // --extra-images-repo
 }
 
 type ParallelismConfig struct {
-	Blobs  int
-	Images int
+	Blobs   int // Blobs of the image pushed at once
+	Images  int // Images of the repo pushed at once
+	Modules int // Modules pushed at once
 }
 
 var DefaultParallelism = ParallelismConfig{
-	Blobs:  4,
-	Images: 1,
+	Blobs:   4,
+	Images:  1,
+	Modules: 1,
+}
+
+// Validate checks that every kind of work is done by at least one worker.
+func (p ParallelismConfig) Validate() error {
+	if p.Modules < 1 || p.Images < 1 || p.Blobs < 1 {
+		return errors.New("--parallel-modules, --parallel-images and --parallel-blobs must be at least 1")
+	}
+	return nil
 }
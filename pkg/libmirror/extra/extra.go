@@ -0,0 +1,120 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extra
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/yaml"
+)
+
+// Folder is where layouts of extra images are placed in the bundle, each one at the path of its repository.
+const Folder = "extra"
+
+// Config lists images and OCI Helm charts mirrored along with Deckhouse. It is loaded from the file like:
+//
+//	images:
+//	  - docker.io/grafana/grafana:10.4.2
+//	  - quay.io/prometheus/node-exporter@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80
+//	charts:
+//	  - oci://ghcr.io/actions/actions-runner-controller-charts/gha-runner-scale-set:0.9.3
+//
+// Tag or digest is required, images are not pulled by the implicit latest tag.
+type Config struct {
+	Images []string `json:"images"`
+	Charts []string `json:"charts"`
+}
+
+// Image is the image or the chart to mirror.
+type Image struct {
+	// Reference to pull the image by, with the registry and the tag or the digest.
+	Reference string
+	// Repo is the path of the repository without the registry. Image is placed into the bundle at extra/<Repo>
+	// and pushed to <extra images repo>/<Repo>.
+	Repo string
+}
+
+func Load(configPath string) ([]Image, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read extra images list: %w", err)
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) ([]Image, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parse extra images list: %w", err)
+	}
+
+	refs := append(slices.Clone(config.Images), config.Charts...)
+	result := make([]Image, 0, len(refs))
+	registryByRepo := map[string]string{}
+	for _, rawRef := range refs {
+		ref, err := parseReference(rawRef)
+		if err != nil {
+			return nil, err
+		}
+
+		image := Image{Reference: ref.Name(), Repo: ref.Context().RepositoryStr()}
+		registry := ref.Context().RegistryStr()
+		if other, found := registryByRepo[image.Repo]; found && other != registry {
+			return nil, fmt.Errorf("%s: repository %s is also pulled from %s, both would be pushed to the same repository", rawRef, image.Repo, other)
+		}
+		registryByRepo[image.Repo] = registry
+
+		if !slices.Contains(result, image) {
+			result = append(result, image)
+		}
+	}
+	return result, nil
+}
+
+func parseReference(rawRef string) (name.Reference, error) {
+	rawRef = strings.TrimPrefix(strings.TrimSpace(rawRef), "oci://")
+	if strings.Contains(rawRef, "://") {
+		return nil, fmt.Errorf("%s: only oci:// charts are supported", rawRef)
+	}
+	ref, err := name.ParseReference(rawRef)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rawRef, err)
+	}
+	if tag, isTag := ref.(name.Tag); isTag && !strings.HasSuffix(rawRef, ":"+tag.TagStr()) {
+		return nil, fmt.Errorf("%s: tag or digest is required", rawRef)
+	}
+	// Layout of the parent repository keeps its blobs there
+	if slices.Contains(strings.Split(ref.Context().RepositoryStr(), "/"), "blobs") {
+		return nil, fmt.Errorf("%s: repositories named blobs are not supported", rawRef)
+	}
+	return ref, nil
+}
+
+// Repos returns repositories of the images without duplicates, in the order of the images.
+func Repos(images []Image) []string {
+	repos := make([]string, 0, len(images))
+	for _, image := range images {
+		if !slices.Contains(repos, image.Repo) {
+			repos = append(repos, image.Repo)
+		}
+	}
+	return repos
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extra
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	images, err := Parse([]byte(`
+images:
+  - registry.example.com/monitoring/grafana:10.4.2
+  - nginx:1.25
+  - quay.io/prometheus/node-exporter@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80
+  - registry.example.com/monitoring/grafana:10.4.2
+charts:
+  - oci://ghcr.io/actions/actions-runner-controller-charts/gha-runner-scale-set:0.9.3
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Image{
+		{Reference: "registry.example.com/monitoring/grafana:10.4.2", Repo: "monitoring/grafana"},
+		{Reference: "index.docker.io/library/nginx:1.25", Repo: "library/nginx"},
+		{
+			Reference: "quay.io/prometheus/node-exporter@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80",
+			Repo:      "prometheus/node-exporter",
+		},
+		{
+			Reference: "ghcr.io/actions/actions-runner-controller-charts/gha-runner-scale-set:0.9.3",
+			Repo:      "actions/actions-runner-controller-charts/gha-runner-scale-set",
+		},
+	}, images)
+	require.Equal(t, []string{
+		"monitoring/grafana",
+		"library/nginx",
+		"prometheus/node-exporter",
+		"actions/actions-runner-controller-charts/gha-runner-scale-set",
+	}, Repos(images))
+}
+
+func TestParseRejectsBadList(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":         "image:\n  - nginx:1.25\n",
+		"no tag":                "images:\n  - registry.example.com/nginx\n",
+		"invalid reference":     "images:\n  - registry.example.com/Nginx:1.25\n",
+		"same repo":             "images:\n  - registry.example.com/nginx:1.25\n  - mirror.example.com/nginx:1.26\n",
+		"reserved repo":         "images:\n  - registry.example.com/nginx/blobs:1.25\n",
+		"chart without tag":     "charts:\n  - oci://ghcr.io/org/charts/runner\n",
+		"chart with bad scheme": "charts:\n  - https://ghcr.io/org/charts/runner:1.0.0\n",
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(config))
+			require.Error(t, err)
+		})
+	}
+}
@@ -104,21 +104,36 @@ func findDigestForInstallerTag(installerTag string, indexManifest *v1.IndexManif
 }
 
 func parseImagesFromJSON(registryRepo string, jsonDigests io.Reader, dst map[string]struct{}, tagsCompatMode bool) error {
+	imageIDs, err := ImageIDsFromJSON(jsonDigests)
+	if err != nil {
+		return err
+	}
+
+	for _, imageID := range imageIDs {
+		if tagsCompatMode {
+			dst[registryRepo+":"+imageID] = struct{}{}
+			continue
+		}
+
+		dst[registryRepo+"@"+imageID] = struct{}{}
+	}
+
+	return nil
+}
+
+// ImageIDsFromJSON returns digests or tags of Deckhouse images listed in images_digests.json or images_tags.json
+// of the installer image. Both files map module names to the names of module images to their IDs.
+func ImageIDsFromJSON(jsonDigests io.Reader) ([]string, error) {
 	digestsByModule := map[string]map[string]string{}
 	if err := json.NewDecoder(jsonDigests).Decode(&digestsByModule); err != nil {
-		return fmt.Errorf("parse images from json: %w", err)
+		return nil, fmt.Errorf("parse images from json: %w", err)
 	}
 
+	imageIDs := make([]string, 0)
 	for _, nameDigestTuple := range digestsByModule {
 		for _, imageID := range nameDigestTuple {
-			if tagsCompatMode {
-				dst[registryRepo+":"+imageID] = struct{}{}
-				continue
-			}
-
-			dst[registryRepo+"@"+imageID] = struct{}{}
+			imageIDs = append(imageIDs, imageID)
 		}
 	}
-
-	return nil
+	return imageIDs, nil
 }
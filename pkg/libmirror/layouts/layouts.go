@@ -17,6 +17,7 @@ limitations under the License.
 package layouts
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -34,8 +35,10 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/releases"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/modules"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 )
 
@@ -52,14 +55,8 @@ type ImageLayouts struct {
 	ReleaseChannel       layout.Path
 	ReleaseChannelImages map[string]struct{}
 
-	TrivyDB           layout.Path
-	TrivyDBImages     map[string]struct{}
-	TrivyBDU          layout.Path
-	TrivyBDUImages    map[string]struct{}
-	TrivyJavaDB       layout.Path
-	TrivyJavaDBImages map[string]struct{}
-	TrivyChecks       layout.Path
-	TrivyChecksImages map[string]struct{}
+	Security map[string]layout.Path // Layouts of security artifacts by their names
+	Extra    map[string]layout.Path // Layouts of extra images by their repositories
 
 	Modules map[string]ModuleImageLayout
 
@@ -77,6 +74,8 @@ type ModuleImageLayout struct {
 func CreateOCIImageLayoutsForDeckhouse(
 	rootFolder string,
 	modules []modules.Module,
+	securityArtifacts []security.Artifact,
+	extraImages []extra.Image,
 ) (*ImageLayouts, error) {
 	var err error
 	layouts := &ImageLayouts{
@@ -89,27 +88,33 @@ func CreateOCIImageLayoutsForDeckhouse(
 		&layouts.Install:           filepath.Join(rootFolder, "install"),
 		&layouts.InstallStandalone: filepath.Join(rootFolder, "install-standalone"),
 		&layouts.ReleaseChannel:    filepath.Join(rootFolder, "release-channel"),
-		&layouts.TrivyDB:           filepath.Join(rootFolder, "security", "trivy-db"),
-		&layouts.TrivyBDU:          filepath.Join(rootFolder, "security", "trivy-bdu"),
-		&layouts.TrivyJavaDB:       filepath.Join(rootFolder, "security", "trivy-java-db"),
-		&layouts.TrivyChecks:       filepath.Join(rootFolder, "security", "trivy-checks"),
 	}
 	for layoutPtr, fsPath := range fsPaths {
-		*layoutPtr, err = CreateEmptyImageLayoutAtPath(fsPath)
+		*layoutPtr, err = OpenOrCreateImageLayoutAtPath(fsPath)
 		if err != nil {
 			return nil, fmt.Errorf("create OCI Image Layout at %s: %w", fsPath, err)
 		}
 	}
 
+	layouts.Security, err = CreateSecurityLayouts(filepath.Join(rootFolder, "security"), securityArtifacts)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts.Extra, err = CreateExtraLayouts(filepath.Join(rootFolder, extra.Folder), extraImages)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, module := range modules {
 		path := filepath.Join(rootFolder, "modules", module.Name)
-		moduleLayout, err := CreateEmptyImageLayoutAtPath(path)
+		moduleLayout, err := OpenOrCreateImageLayoutAtPath(path)
 		if err != nil {
 			return nil, fmt.Errorf("create OCI Image Layout at %s: %w", path, err)
 		}
 
 		path = filepath.Join(rootFolder, "modules", module.Name, "release")
-		moduleReleasesLayout, err := CreateEmptyImageLayoutAtPath(path)
+		moduleReleasesLayout, err := OpenOrCreateImageLayoutAtPath(path)
 		if err != nil {
 			return nil, fmt.Errorf("create OCI Image Layout at %s: %w", path, err)
 		}
@@ -125,6 +130,49 @@ func CreateOCIImageLayoutsForDeckhouse(
 	return layouts, nil
 }
 
+// CreateSecurityLayouts opens or creates the layout for each of the security artifacts in the securityFolder.
+func CreateSecurityLayouts(securityFolder string, artifacts []security.Artifact) (map[string]layout.Path, error) {
+	result := make(map[string]layout.Path, len(artifacts))
+	for _, artifact := range artifacts {
+		path := filepath.Join(securityFolder, artifact.Name)
+		l, err := OpenOrCreateImageLayoutAtPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("create OCI Image Layout at %s: %w", path, err)
+		}
+		result[artifact.Name] = l
+	}
+	return result, nil
+}
+
+// CreateExtraLayouts opens or creates the layout for each repository of extra images in the extraFolder.
+func CreateExtraLayouts(extraFolder string, images []extra.Image) (map[string]layout.Path, error) {
+	result := make(map[string]layout.Path)
+	for _, repo := range extra.Repos(images) {
+		path := filepath.Join(extraFolder, filepath.FromSlash(repo))
+		l, err := OpenOrCreateImageLayoutAtPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("create OCI Image Layout at %s: %w", path, err)
+		}
+		result[repo] = l
+	}
+	return result, nil
+}
+
+// OpenOrCreateImageLayoutAtPath reuses the layout left at path by the previous pull, so images pulled into it are not pulled again.
+// Layout with unreadable index is recreated, blobs that are already written to it are reused anyway.
+func OpenOrCreateImageLayoutAtPath(path string) (layout.Path, error) {
+	if _, err := os.Stat(filepath.Join(path, "oci-layout")); err == nil {
+		l := layout.Path(path)
+		if index, err := l.ImageIndex(); err == nil {
+			if _, err = index.IndexManifest(); err == nil {
+				return l, nil
+			}
+		}
+	}
+
+	return CreateEmptyImageLayoutAtPath(path)
+}
+
 func CreateEmptyImageLayoutAtPath(path string) (layout.Path, error) {
 	layoutFilePath := filepath.Join(path, "oci-layout")
 	indexFilePath := filepath.Join(path, "index.json")
@@ -182,12 +230,6 @@ func FillLayoutsWithBasicDeckhouseImages(
 	layouts.InstallImages = map[string]struct{}{}
 	layouts.InstallStandaloneImages = map[string]struct{}{}
 	layouts.ReleaseChannelImages = map[string]struct{}{}
-	layouts.TrivyDBImages = map[string]struct{}{
-		mirrorCtx.DeckhouseRegistryRepo + "/security/trivy-db:2":      {},
-		mirrorCtx.DeckhouseRegistryRepo + "/security/trivy-bdu:1":     {},
-		mirrorCtx.DeckhouseRegistryRepo + "/security/trivy-java-db:1": {},
-		mirrorCtx.DeckhouseRegistryRepo + "/security/trivy-checks:0":  {},
-	}
 
 	for _, version := range deckhouseVersions {
 		layouts.DeckhouseImages[fmt.Sprintf("%s:v%s", mirrorCtx.DeckhouseRegistryRepo, version.String())] = struct{}{}
@@ -227,6 +269,10 @@ func FillLayoutsWithBasicDeckhouseImages(
 }
 
 func FindDeckhouseModulesImages(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return FindDeckhouseModulesImagesContext(context.Background(), mirrorCtx, layouts)
+}
+
+func FindDeckhouseModulesImagesContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	modulesNames := maps.Keys(layouts.Modules)
 	for _, moduleName := range modulesNames {
 		moduleData := layouts.Modules[moduleName]
@@ -238,7 +284,8 @@ func FindDeckhouseModulesImages(mirrorCtx *contexts.PullContext, layouts *ImageL
 			mirrorCtx.DeckhouseRegistryRepo + "/modules/" + moduleName + "/release:rock-solid":   {},
 		}
 
-		channelVersions, err := releases.FetchVersionsFromModuleReleaseChannels(
+		channelVersions, err := releases.FetchVersionsFromModuleReleaseChannelsContext(
+			ctx,
 			moduleData.ReleaseImages,
 			mirrorCtx.RegistryAuth,
 			mirrorCtx.Insecure,
@@ -261,7 +308,7 @@ func FindDeckhouseModulesImages(mirrorCtx *contexts.PullContext, layouts *ImageL
 				return fmt.Errorf("get digests for %q version: %w", imageTag, err)
 			}
 
-			img, err := remote.Image(ref, remoteOpts...)
+			img, err := remote.Image(ref, append(remoteOpts, remote.WithContext(ctx))...)
 			if err != nil {
 				return fmt.Errorf("get digests for %q version: %w", imageTag, err)
 			}
@@ -306,3 +353,45 @@ func FindImageByTag(l layout.Path, tag string) (v1.Image, error) {
 
 	return nil, nil
 }
+
+// DeleteUnreferencedBlobs removes blobs of the images that are no longer referenced by the layout index,
+// like the previous versions of images that were replaced by the pull.
+func DeleteUnreferencedBlobs(l layout.Path) error {
+	index, err := l.ImageIndex()
+	if err != nil {
+		return err
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	referenced := map[v1.Hash]struct{}{}
+	for _, desc := range indexManifest.Manifests {
+		referenced[desc.Digest] = struct{}{}
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return fmt.Errorf("read image %s: %w", desc.Digest, err)
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return fmt.Errorf("read manifest of %s: %w", desc.Digest, err)
+		}
+		referenced[manifest.Config.Digest] = struct{}{}
+		for _, layer := range manifest.Layers {
+			referenced[layer.Digest] = struct{}{}
+		}
+	}
+
+	blobsDir := filepath.Join(string(l), "blobs")
+	return filepath.WalkDir(blobsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		algorithm := filepath.Base(filepath.Dir(path))
+		if _, found := referenced[v1.Hash{Algorithm: algorithm, Hex: d.Name()}]; found {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
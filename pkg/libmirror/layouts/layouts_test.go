@@ -21,6 +21,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/stretchr/testify/require"
 )
 
@@ -37,3 +39,71 @@ func TestCreateEmptyImageLayoutAtPath(t *testing.T) {
 	require.FileExists(t, filepath.Join(p, "oci-layout"))
 	require.FileExists(t, filepath.Join(p, "index.json"))
 }
+
+func TestOpenOrCreateImageLayoutAtPath(t *testing.T) {
+	p := t.TempDir()
+	l, err := OpenOrCreateImageLayoutAtPath(p)
+	require.NoError(t, err)
+
+	img, err := random.Image(16, 1)
+	require.NoError(t, err)
+	require.NoError(t, l.AppendImage(img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	l, err = OpenOrCreateImageLayoutAtPath(p)
+	require.NoError(t, err)
+	_, err = l.Image(digest)
+	require.NoError(t, err, "Layout should be reused with images in it")
+
+	require.NoError(t, os.WriteFile(filepath.Join(p, "index.json"), []byte(`{"schemaVer`), 0o644))
+	l, err = OpenOrCreateImageLayoutAtPath(p)
+	require.NoError(t, err)
+	index, err := l.ImageIndex()
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Empty(t, indexManifest.Manifests, "Layout with broken index should be recreated")
+}
+
+func TestDeleteUnreferencedBlobs(t *testing.T) {
+	l, err := CreateEmptyImageLayoutAtPath(t.TempDir())
+	require.NoError(t, err)
+
+	keptImage, err := random.Image(16, 2)
+	require.NoError(t, err)
+	require.NoError(t, l.AppendImage(keptImage))
+	unreferencedImage, err := random.Image(16, 2)
+	require.NoError(t, err)
+	require.NoError(t, l.WriteImage(unreferencedImage))
+
+	require.NoError(t, DeleteUnreferencedBlobs(l))
+
+	keptLayers, err := keptImage.Layers()
+	require.NoError(t, err)
+	for _, layer := range keptLayers {
+		digest, err := layer.Digest()
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(string(l), "blobs", digest.Algorithm, digest.Hex))
+	}
+	keptImageFromLayout, err := l.Image(mustDigest(t, keptImage))
+	require.NoError(t, err)
+	_, err = keptImageFromLayout.ConfigFile()
+	require.NoError(t, err)
+
+	unreferencedLayers, err := unreferencedImage.Layers()
+	require.NoError(t, err)
+	for _, layer := range unreferencedLayers {
+		digest, err := layer.Digest()
+		require.NoError(t, err)
+		require.NoFileExists(t, filepath.Join(string(l), "blobs", digest.Algorithm, digest.Hex))
+	}
+	require.NoFileExists(t, filepath.Join(string(l), "blobs", "sha256", mustDigest(t, unreferencedImage).Hex))
+}
+
+func mustDigest(t *testing.T, img v1.Image) v1.Hash {
+	t.Helper()
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	return digest
+}
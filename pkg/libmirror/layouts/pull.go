@@ -19,16 +19,21 @@ package layouts
 import (
 	"context"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/retry"
@@ -36,8 +41,13 @@ import (
 )
 
 func PullInstallers(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullInstallersContext(context.Background(), mirrorCtx, layouts)
+}
+
+func PullInstallersContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	mirrorCtx.Logger.InfoLn("Beginning to pull installers")
-	if err := PullImageSet(
+	if err := PullImageSetContext(
+		ctx,
 		mirrorCtx,
 		layouts.Install,
 		layouts.InstallImages,
@@ -50,8 +60,13 @@ func PullInstallers(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) erro
 }
 
 func PullStandaloneInstallers(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullStandaloneInstallersContext(context.Background(), mirrorCtx, layouts)
+}
+
+func PullStandaloneInstallersContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	mirrorCtx.Logger.InfoLn("Beginning to pull standalone installers")
-	if err := PullImageSet(
+	if err := PullImageSetContext(
+		ctx,
 		mirrorCtx,
 		layouts.InstallStandalone,
 		layouts.InstallStandaloneImages,
@@ -65,8 +80,13 @@ func PullStandaloneInstallers(mirrorCtx *contexts.PullContext, layouts *ImageLay
 }
 
 func PullDeckhouseReleaseChannels(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullDeckhouseReleaseChannelsContext(context.Background(), mirrorCtx, layouts)
+}
+
+func PullDeckhouseReleaseChannelsContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	mirrorCtx.Logger.InfoLn("Beginning to pull Deckhouse release channels information")
-	if err := PullImageSet(
+	if err := PullImageSetContext(
+		ctx,
 		mirrorCtx,
 		layouts.ReleaseChannel,
 		layouts.ReleaseChannelImages,
@@ -80,8 +100,13 @@ func PullDeckhouseReleaseChannels(mirrorCtx *contexts.PullContext, layouts *Imag
 }
 
 func PullDeckhouseImages(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullDeckhouseImagesContext(context.Background(), mirrorCtx, layouts)
+}
+
+func PullDeckhouseImagesContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	mirrorCtx.Logger.InfoLn("Beginning to pull Deckhouse, this may take a while")
-	if err := PullImageSet(
+	if err := PullImageSetContext(
+		ctx,
 		mirrorCtx,
 		layouts.Deckhouse,
 		layouts.DeckhouseImages,
@@ -94,9 +119,14 @@ func PullDeckhouseImages(mirrorCtx *contexts.PullContext, layouts *ImageLayouts)
 }
 
 func PullModules(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullModulesContext(context.Background(), mirrorCtx, layouts)
+}
+
+func PullModulesContext(ctx context.Context, mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	mirrorCtx.Logger.InfoLn("Beginning to pull Deckhouse modules")
 	for moduleName, moduleData := range layouts.Modules {
-		if err := PullImageSet(
+		if err := PullImageSetContext(
+			ctx,
 			mirrorCtx,
 			moduleData.ModuleLayout,
 			moduleData.ModuleImages,
@@ -104,7 +134,8 @@ func PullModules(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 		); err != nil {
 			return fmt.Errorf("pull %q module: %w", moduleName, err)
 		}
-		if err := PullImageSet(
+		if err := PullImageSetContext(
+			ctx,
 			mirrorCtx,
 			moduleData.ReleasesLayout,
 			moduleData.ReleaseImages,
@@ -118,44 +149,148 @@ func PullModules(mirrorCtx *contexts.PullContext, layouts *ImageLayouts) error {
 	return nil
 }
 
+// PullTrivyVulnerabilityDatabasesImages pulls security artifacts, like vulnerability databases, into layouts.Security.
 func PullTrivyVulnerabilityDatabasesImages(
 	pullCtx *contexts.PullContext,
 	layouts *ImageLayouts,
+) error {
+	return PullTrivyVulnerabilityDatabasesImagesContext(context.Background(), pullCtx, layouts)
+}
+
+func PullTrivyVulnerabilityDatabasesImagesContext(
+	ctx context.Context,
+	pullCtx *contexts.PullContext,
+	layouts *ImageLayouts,
 ) error {
 	nameOpts, _ := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(&pullCtx.BaseContext)
 
-	dbImages := map[layout.Path]string{
-		layouts.TrivyDB:     path.Join(pullCtx.DeckhouseRegistryRepo, "security", "trivy-db:2"),
-		layouts.TrivyBDU:    path.Join(pullCtx.DeckhouseRegistryRepo, "security", "trivy-bdu:1"),
-		layouts.TrivyJavaDB: path.Join(pullCtx.DeckhouseRegistryRepo, "security", "trivy-java-db:1"),
-		layouts.TrivyChecks: path.Join(pullCtx.DeckhouseRegistryRepo, "security", "trivy-checks:0"),
-	}
+	for _, artifact := range pullCtx.Security() {
+		artifactLayout, found := layouts.Security[artifact.Name]
+		if !found {
+			return fmt.Errorf("no layout for %s security artifact", artifact.Name)
+		}
 
-	for dbImageLayout, imageRef := range dbImages {
+		imageRef := path.Join(pullCtx.DeckhouseRegistryRepo, "security", artifact.Name) + ":" + artifact.Tag
 		ref, err := name.ParseReference(imageRef, nameOpts...)
 		if err != nil {
-			return fmt.Errorf("parse trivy-db reference %q: %w", imageRef, err)
+			return fmt.Errorf("parse %s reference %q: %w", artifact.Name, imageRef, err)
 		}
 
-		if err = PullImageSet(
+		// Databases are updated under the same tags, digest tells if the database pulled earlier is still up to date
+		imageSet := map[string]struct{}{ref.String(): {}}
+		tagsResolver := NewTagsResolver()
+		if err = tagsResolver.ResolveTagsDigestsFromImageSetContext(
+			ctx,
+			imageSet,
+			pullCtx.RegistryAuth,
+			pullCtx.Insecure,
+			pullCtx.SkipTLSVerification,
+		); err != nil {
+			return fmt.Errorf("resolve %s digest: %w", artifact.Name, err)
+		}
+
+		if err = PullImageSetContext(
+			ctx,
 			pullCtx,
-			dbImageLayout,
-			map[string]struct{}{ref.String(): {}},
-			WithTagToDigestMapper(NopTagToDigestMappingFunc),
+			artifactLayout,
+			imageSet,
+			WithTagToDigestMapper(tagsResolver.GetTagDigest),
 			WithAllowMissingTags(true), // SE edition does not contain images for trivy
 		); err != nil {
-			return fmt.Errorf("pull vulnerability database: %w", err)
+			return fmt.Errorf("pull %s: %w", artifact.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// PullExtraImages pulls images and charts listed in pullCtx.ExtraImages into layouts.Extra.
+func PullExtraImages(pullCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	return PullExtraImagesContext(context.Background(), pullCtx, layouts)
+}
+
+func PullExtraImagesContext(ctx context.Context, pullCtx *contexts.PullContext, layouts *ImageLayouts) error {
+	imageSets := map[string]map[string]struct{}{}
+	registries := map[string]name.Registry{}
+	for _, image := range pullCtx.ExtraImages {
+		ref, err := name.ParseReference(image.Reference)
+		if err != nil {
+			return fmt.Errorf("parse image reference %q: %w", image.Reference, err)
+		}
+		if imageSets[image.Repo] == nil {
+			imageSets[image.Repo] = map[string]struct{}{}
+		}
+		imageSets[image.Repo][image.Reference] = struct{}{}
+		registries[image.Repo] = ref.Context().Registry
+	}
+
+	for _, repo := range extra.Repos(pullCtx.ExtraImages) {
+		repoLayout, found := layouts.Extra[repo]
+		if !found {
+			return fmt.Errorf("no layout for %s extra images", repo)
+		}
+
+		// Extra images come from registries other than the source one, each of them needs its own credentials
+		repoCtx := *pullCtx
+		repoCtx.RegistryAuth = extraImagesAuth(pullCtx, registries[repo])
+
+		if err := layouts.TagsResolver.ResolveTagsDigestsFromImageSetContext(
+			ctx,
+			imageSets[repo],
+			repoCtx.RegistryAuth,
+			repoCtx.Insecure,
+			repoCtx.SkipTLSVerification,
+		); err != nil {
+			return fmt.Errorf("resolve %s tags: %w", repo, err)
+		}
+
+		if err := PullImageSetContext(
+			ctx,
+			&repoCtx,
+			repoLayout,
+			imageSets[repo],
+			WithTagToDigestMapper(layouts.TagsResolver.GetTagDigest),
+		); err != nil {
+			return fmt.Errorf("pull %s: %w", repo, err)
 		}
 	}
 
 	return nil
 }
 
+// extraImagesAuth returns source registry credentials for images from the source registry,
+// credentials from the docker config are used for other registries.
+func extraImagesAuth(pullCtx *contexts.PullContext, registry name.Registry) authn.Authenticator {
+	sourceRepo, err := name.NewRepository(pullCtx.DeckhouseRegistryRepo)
+	if err == nil && sourceRepo.RegistryStr() == registry.RegistryStr() {
+		return pullCtx.RegistryAuth
+	}
+
+	registryAuth, err := authn.DefaultKeychain.Resolve(registry)
+	if err != nil {
+		pullCtx.Logger.WarnF("Read credentials for %s from docker config: %v", registry.RegistryStr(), err)
+		return authn.Anonymous
+	}
+	return registryAuth
+}
+
 func PullImageSet(
 	pullCtx *contexts.PullContext,
 	targetLayout layout.Path,
 	imageSet map[string]struct{},
 	opts ...func(opts *pullImageSetOptions),
+) error {
+	return PullImageSetContext(context.Background(), pullCtx, targetLayout, imageSet, opts...)
+}
+
+// PullImageSetContext pulls images into the layout one by one.
+// Once ctx is cancelled, no more images are pulled and images that are already written to the layout are kept in it.
+func PullImageSetContext(
+	ctx context.Context,
+	pullCtx *contexts.PullContext,
+	targetLayout layout.Path,
+	imageSet map[string]struct{},
+	opts ...func(opts *pullImageSetOptions),
 ) error {
 	pullOpts := &pullImageSetOptions{}
 	for _, o := range opts {
@@ -164,8 +299,18 @@ func PullImageSet(
 
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(pullCtx.RegistryAuth, pullCtx.Insecure, pullCtx.SkipTLSVerification)
 
+	// Layout may already contain images from the previous unfinished pull
+	pulledImages, err := findPulledImages(targetLayout)
+	if err != nil {
+		return fmt.Errorf("find images pulled earlier: %w", err)
+	}
+
 	pullCount, totalCount := 1, len(imageSet)
 	for imageReferenceString := range imageSet {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("pull interrupted: %w", err)
+		}
+
 		imageRepo, imageTag := splitImageRefByRepoAndTag(imageReferenceString)
 
 		// If we already know the digest of the tagged image, we should pull it by this digest instead of pulling by tag
@@ -182,7 +327,15 @@ func PullImageSet(
 			return fmt.Errorf("parse image reference %q: %w", pullReference, err)
 		}
 
-		err = retry.RunTask(
+		// Image is pulled again if the tag was moved to another image since the previous pull.
+		if digest, found := pulledImages[imageReferenceString]; found && digestReference(ref) == digest {
+			pullCtx.Logger.InfoF("[%d / %d] Skipping %s, already pulled", pullCount, totalCount, imageReferenceString)
+			pullCount++
+			continue
+		}
+
+		err = retry.RunTaskWithContext(
+			ctx,
 			pullCtx.Logger,
 			fmt.Sprintf("[%d / %d] Pulling %s ", pullCount, totalCount, imageReferenceString),
 			task.WithConstantRetries(5, 10*time.Second, func(ctx context.Context) error {
@@ -196,12 +349,10 @@ func PullImageSet(
 					return fmt.Errorf("pull image metadata: %w", err)
 				}
 
-				err = targetLayout.AppendImage(img,
+				err = targetLayout.ReplaceImage(img,
+					match.Annotation("org.opencontainers.image.ref.name", imageReferenceString),
 					layout.WithPlatform(v1.Platform{Architecture: "amd64", OS: "linux"}),
-					layout.WithAnnotations(map[string]string{
-						"org.opencontainers.image.ref.name": imageReferenceString,
-						"io.deckhouse.image.short_tag":      imageTag,
-					}),
+					layout.WithAnnotations(pulledImageAnnotations(ref, imageReferenceString, imageTag)),
 				)
 				if err != nil {
 					return fmt.Errorf("write image to index: %w", err)
@@ -214,9 +365,107 @@ func PullImageSet(
 		}
 		pullCount++
 	}
+
+	// Layout reused from the previous pull may contain images that are no longer mirrored,
+	// like versions that were dropped from the release channels since then. They should not get into the bundle.
+	if err = removeImagesNotInSet(targetLayout, imageSet); err != nil {
+		return fmt.Errorf("remove images that are no longer mirrored: %w", err)
+	}
 	return nil
 }
 
+// removeImagesNotInSet removes images that are not in imageSet from the layout index along with their blobs.
+func removeImagesNotInSet(l layout.Path, imageSet map[string]struct{}) error {
+	err := l.RemoveDescriptors(func(desc v1.Descriptor) bool {
+		_, inSet := imageSet[desc.Annotations["org.opencontainers.image.ref.name"]]
+		return !inSet
+	})
+	if err != nil {
+		return err
+	}
+	return DeleteUnreferencedBlobs(l)
+}
+
+// findPulledImages maps image references to digests of the images in the layout that have all of their blobs written in full.
+func findPulledImages(l layout.Path) (map[string]v1.Hash, error) {
+	index, err := l.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]v1.Hash, len(indexManifest.Manifests))
+	for _, desc := range indexManifest.Manifests {
+		imageRef, found := desc.Annotations["org.opencontainers.image.ref.name"]
+		if !found || !blobIsComplete(l, desc.Digest, desc.Size) {
+			continue
+		}
+
+		img, err := l.Image(desc.Digest)
+		if err != nil {
+			continue
+		}
+		manifest, err := img.Manifest()
+		if err != nil || !blobIsComplete(l, manifest.Config.Digest, manifest.Config.Size) {
+			continue
+		}
+
+		complete := true
+		for _, layer := range manifest.Layers {
+			if !blobIsComplete(l, layer.Digest, layer.Size) {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		// Multi-arch images are pulled by the digest of the index, but only the platform image is stored in the layout.
+		result[imageRef] = desc.Digest
+		if sourceDigest, err := v1.NewHash(desc.Annotations["io.deckhouse.image.source_digest"]); err == nil {
+			result[imageRef] = sourceDigest
+		}
+	}
+
+	return result, nil
+}
+
+// blobIsComplete reports whether the blob is present in the layout and has the expected size.
+// Blobs are written in place, so the blob that was being written when the pull was interrupted is shorter than expected.
+func blobIsComplete(l layout.Path, digest v1.Hash, size int64) bool {
+	stat, err := os.Stat(filepath.Join(string(l), "blobs", digest.Algorithm, digest.Hex))
+	return err == nil && stat.Mode().IsRegular() && stat.Size() == size
+}
+
+// pulledImageAnnotations returns annotations of the image pulled by ref. Digest the image was pulled by is kept,
+// as it differs from the digest of the stored image when ref points to the image index.
+func pulledImageAnnotations(ref name.Reference, imageReferenceString, imageTag string) map[string]string {
+	annotations := map[string]string{
+		"org.opencontainers.image.ref.name": imageReferenceString,
+		"io.deckhouse.image.short_tag":      imageTag,
+	}
+	if digest := digestReference(ref); digest != (v1.Hash{}) {
+		annotations["io.deckhouse.image.source_digest"] = digest.String()
+	}
+	return annotations
+}
+
+// digestReference returns the digest of the image if ref points to it by digest.
+func digestReference(ref name.Reference) v1.Hash {
+	digestRef, ok := ref.(name.Digest)
+	if !ok {
+		return v1.Hash{}
+	}
+	digest, err := v1.NewHash(digestRef.DigestStr())
+	if err != nil {
+		return v1.Hash{}
+	}
+	return digest
+}
+
 func splitImageRefByRepoAndTag(imageReferenceString string) (repo, tag string) {
 	splitIndex := strings.LastIndex(imageReferenceString, ":")
 	repo = imageReferenceString[:splitIndex]
@@ -17,21 +17,31 @@ limitations under the License.
 package layouts
 
 import (
+	"context"
 	"log/slog"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/stretchr/testify/require"
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
 )
@@ -62,12 +72,12 @@ func TestPullTrivyVulnerabilityDatabaseImageSuccessSkipTLS(t *testing.T) {
 		wantImages = append(wantImages, wantImage)
 	}
 
-	layouts := &ImageLayouts{
-		TrivyDB:     createEmptyOCILayout(t),
-		TrivyBDU:    createEmptyOCILayout(t),
-		TrivyJavaDB: createEmptyOCILayout(t),
-		TrivyChecks: createEmptyOCILayout(t),
-	}
+	layouts := &ImageLayouts{Security: map[string]layout.Path{
+		"trivy-db":      createEmptyOCILayout(t),
+		"trivy-bdu":     createEmptyOCILayout(t),
+		"trivy-java-db": createEmptyOCILayout(t),
+		"trivy-checks":  createEmptyOCILayout(t),
+	}}
 
 	err := PullTrivyVulnerabilityDatabasesImages(
 		&contexts.PullContext{BaseContext: contexts.BaseContext{
@@ -117,12 +127,12 @@ func TestPullTrivyVulnerabilityDatabaseImageSuccessInsecure(t *testing.T) {
 		wantImages = append(wantImages, wantImage)
 	}
 
-	layouts := &ImageLayouts{
-		TrivyDB:     createEmptyOCILayout(t),
-		TrivyBDU:    createEmptyOCILayout(t),
-		TrivyJavaDB: createEmptyOCILayout(t),
-		TrivyChecks: createEmptyOCILayout(t),
-	}
+	layouts := &ImageLayouts{Security: map[string]layout.Path{
+		"trivy-db":      createEmptyOCILayout(t),
+		"trivy-bdu":     createEmptyOCILayout(t),
+		"trivy-java-db": createEmptyOCILayout(t),
+		"trivy-checks":  createEmptyOCILayout(t),
+	}}
 
 	err := PullTrivyVulnerabilityDatabasesImages(
 		&contexts.PullContext{BaseContext: contexts.BaseContext{
@@ -148,21 +158,259 @@ func TestPullTrivyVulnerabilityDatabaseImageSuccessInsecure(t *testing.T) {
 	}
 }
 
+func TestPullTrivyVulnerabilityDatabasesImagesConfiguredArtifacts(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authn.Anonymous, true, false)
+
+	deckhouseRepo := strings.TrimPrefix(server.URL, "http://") + "/deckhouse/ee"
+	ref, err := name.ParseReference(deckhouseRepo+"/security/grype-db:v6", nameOpts...)
+	require.NoError(t, err)
+	wantImage, err := random.Image(256, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, wantImage, remoteOpts...))
+
+	artifacts := []security.Artifact{{Name: "grype-db", Tag: "v6"}}
+	securityLayouts, err := CreateSecurityLayouts(t.TempDir(), artifacts)
+	require.NoError(t, err)
+	require.Len(t, securityLayouts, 1)
+
+	err = PullTrivyVulnerabilityDatabasesImages(
+		&contexts.PullContext{BaseContext: contexts.BaseContext{
+			Logger:                testLogger,
+			RegistryAuth:          authn.Anonymous,
+			DeckhouseRegistryRepo: deckhouseRepo,
+			Insecure:              true,
+			SecurityArtifacts:     artifacts,
+		}},
+		&ImageLayouts{Security: securityLayouts},
+	)
+	require.NoError(t, err)
+
+	wantDigest, err := wantImage.Digest()
+	require.NoError(t, err)
+	_, err = securityLayouts["grype-db"].Image(wantDigest)
+	require.NoError(t, err)
+}
+
+func TestPullExtraImages(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authn.Anonymous, true, false)
+
+	grafana, err := random.Image(256, 2)
+	require.NoError(t, err)
+	chart, err := random.Image(128, 1)
+	require.NoError(t, err)
+	chart = mutate.ConfigMediaType(chart, "application/vnd.cncf.helm.config.v1+json")
+	wantImages := map[string]v1.Image{
+		host + "/monitoring/grafana:10.4.2":         grafana,
+		host + "/charts/gha-runner-scale-set:0.9.3": chart,
+	}
+	for imageRef, img := range wantImages {
+		ref, err := name.ParseReference(imageRef, nameOpts...)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img, remoteOpts...))
+	}
+
+	extraImages, err := extra.Parse([]byte(`
+images:
+  - ` + host + `/monitoring/grafana:10.4.2
+charts:
+  - oci://` + host + `/charts/gha-runner-scale-set:0.9.3
+`))
+	require.NoError(t, err)
+	extraLayouts, err := CreateExtraLayouts(t.TempDir(), extraImages)
+	require.NoError(t, err)
+	require.Len(t, extraLayouts, 2)
+
+	err = PullExtraImages(
+		&contexts.PullContext{
+			BaseContext: contexts.BaseContext{
+				Logger:                testLogger,
+				RegistryAuth:          authn.Anonymous,
+				DeckhouseRegistryRepo: "registry.deckhouse.io/deckhouse/ee",
+				Insecure:              true,
+			},
+			ExtraImages: extraImages,
+		},
+		&ImageLayouts{Extra: extraLayouts, TagsResolver: NewTagsResolver()},
+	)
+	require.NoError(t, err)
+
+	for repo, imageRef := range map[string]string{
+		"monitoring/grafana":          host + "/monitoring/grafana:10.4.2",
+		"charts/gha-runner-scale-set": host + "/charts/gha-runner-scale-set:0.9.3",
+	} {
+		wantDigest, err := wantImages[imageRef].Digest()
+		require.NoError(t, err)
+		pulled, err := findPulledImages(extraLayouts[repo])
+		require.NoError(t, err)
+		require.Equal(t, map[string]v1.Hash{imageRef: wantDigest}, pulled)
+	}
+}
+
+func TestPullImageSetContextKeepsPulledImagesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Pull is cancelled as soon as the second image is requested, so only the first one gets into the layout.
+	manifestRequests := atomic.Int32{}
+	registryHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") && manifestRequests.Add(1) == 2 {
+			cancel()
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authn.Anonymous, true, false)
+
+	repo := strings.TrimPrefix(server.URL, "http://") + "/deckhouse/ee"
+	imageSet := map[string]struct{}{}
+	for _, tag := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		ref, err := name.ParseReference(repo+":"+tag, nameOpts...)
+		require.NoError(t, err)
+		img, err := random.Image(256, 1)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img, remoteOpts...))
+		imageSet[ref.String()] = struct{}{}
+	}
+
+	targetLayout := createEmptyOCILayout(t)
+	err := PullImageSetContext(
+		ctx,
+		&contexts.PullContext{BaseContext: contexts.BaseContext{
+			Logger:       testLogger,
+			RegistryAuth: authn.Anonymous,
+			Insecure:     true,
+		}},
+		targetLayout,
+		imageSet,
+	)
+	require.ErrorIs(t, err, context.Canceled)
+
+	index, err := targetLayout.ImageIndex()
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 1)
+
+	pulledImage, err := index.Image(indexManifest.Manifests[0].Digest)
+	require.NoError(t, err)
+	_, err = pulledImage.Layers()
+	require.NoError(t, err)
+}
+
+func TestPullImageSetResumesPartialPull(t *testing.T) {
+	requestedManifestsMu := sync.Mutex{}
+	requestedManifests := map[string]struct{}{}
+	registryHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+			requestedManifestsMu.Lock()
+			requestedManifests[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] = struct{}{}
+			requestedManifestsMu.Unlock()
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authn.Anonymous, true, false)
+	pullCtx := &contexts.PullContext{BaseContext: contexts.BaseContext{
+		Logger:       testLogger,
+		RegistryAuth: authn.Anonymous,
+		Insecure:     true,
+	}}
+
+	repo := strings.TrimPrefix(server.URL, "http://") + "/deckhouse/ee"
+	pushImage := func(tag string) (string, v1.Image) {
+		ref, err := name.ParseReference(repo+":"+tag, nameOpts...)
+		require.NoError(t, err)
+		img, err := random.Image(256, 2)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img, remoteOpts...))
+		return ref.String(), img
+	}
+	intactRef, intactImage := pushImage("v1.0.0")
+	brokenRef, brokenImage := pushImage("v1.1.0")
+	movedRef, _ := pushImage("alpha")
+	imageSet := map[string]struct{}{intactRef: {}, brokenRef: {}, movedRef: {}}
+
+	targetLayout := createEmptyOCILayout(t)
+	resolver := NewTagsResolver()
+	require.NoError(t, resolver.ResolveTagsDigestsFromImageSet(imageSet, authn.Anonymous, true, false))
+	require.NoError(t, PullImageSet(pullCtx, targetLayout, imageSet, WithTagToDigestMapper(resolver.GetTagDigest)))
+
+	// Emulate the pull interrupted in the middle of writing the layer and the release channel moved after that.
+	brokenLayers, err := brokenImage.Layers()
+	require.NoError(t, err)
+	brokenLayerDigest, err := brokenLayers[0].Digest()
+	require.NoError(t, err)
+	brokenBlobPath := filepath.Join(string(targetLayout), "blobs", brokenLayerDigest.Algorithm, brokenLayerDigest.Hex)
+	require.NoError(t, os.Truncate(brokenBlobPath, 10))
+	_, movedImage := pushImage("alpha")
+
+	requestedManifests = map[string]struct{}{}
+	resolver = NewTagsResolver()
+	require.NoError(t, resolver.ResolveTagsDigestsFromImageSet(imageSet, authn.Anonymous, true, false))
+	require.NoError(t, PullImageSet(pullCtx, targetLayout, imageSet, WithTagToDigestMapper(resolver.GetTagDigest)))
+
+	intactDigest, err := intactImage.Digest()
+	require.NoError(t, err)
+	brokenDigest, err := brokenImage.Digest()
+	require.NoError(t, err)
+	movedDigest, err := movedImage.Digest()
+	require.NoError(t, err)
+	require.NotContains(t, requestedManifests, intactDigest.String(), "Complete image should not be pulled again")
+	require.Contains(t, requestedManifests, brokenDigest.String(), "Image with incomplete blob should be pulled again")
+	require.Contains(t, requestedManifests, movedDigest.String(), "Image should be pulled again if its tag was moved")
+
+	brokenLayerSize, err := brokenLayers[0].Size()
+	require.NoError(t, err)
+	stat, err := os.Stat(brokenBlobPath)
+	require.NoError(t, err)
+	require.Equal(t, brokenLayerSize, stat.Size())
+
+	pulled, err := findPulledImages(targetLayout)
+	require.NoError(t, err)
+	require.Equal(t, map[string]v1.Hash{
+		intactRef: intactDigest,
+		brokenRef: brokenDigest,
+		movedRef:  movedDigest,
+	}, pulled)
+
+	index, err := targetLayout.ImageIndex()
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 3, "Moved tag should replace the image pulled earlier")
+
+	// Version dropped from the image set since the previous pull should be removed from the layout with its blobs.
+	delete(imageSet, intactRef)
+	require.NoError(t, PullImageSet(pullCtx, targetLayout, imageSet, WithTagToDigestMapper(resolver.GetTagDigest)))
+
+	pulled, err = findPulledImages(targetLayout)
+	require.NoError(t, err)
+	require.Equal(t, map[string]v1.Hash{brokenRef: brokenDigest, movedRef: movedDigest}, pulled)
+
+	intactLayers, err := intactImage.Layers()
+	require.NoError(t, err)
+	for _, l := range intactLayers {
+		digest, err := l.Digest()
+		require.NoError(t, err)
+		require.NoFileExists(t, filepath.Join(string(targetLayout), "blobs", digest.Algorithm, digest.Hex))
+	}
+	require.NoFileExists(t, filepath.Join(string(targetLayout), "blobs", intactDigest.Algorithm, intactDigest.Hex))
+}
+
 func layoutByIndex(t *testing.T, layouts *ImageLayouts, idx int) layout.Path {
 	t.Helper()
-	switch idx {
-	case 0:
-		return layouts.TrivyDB
-	case 1:
-		return layouts.TrivyBDU
-	case 2:
-		return layouts.TrivyJavaDB
-	case 3:
-		return layouts.TrivyChecks
-	default:
-		t.Fatalf("Unexpected layout index, expected only [0-2], but got %d", idx)
-		return ""
+	names := []string{"trivy-db", "trivy-bdu", "trivy-java-db", "trivy-checks"}
+	if idx < 0 || idx >= len(names) {
+		t.Fatalf("Unexpected layout index, expected only [0-3], but got %d", idx)
 	}
+	return layouts.Security[names[idx]]
 }
 
 func createEmptyOCILayout(t *testing.T) layout.Path {
@@ -172,3 +420,49 @@ func createEmptyOCILayout(t *testing.T) layout.Path {
 	require.NoError(t, err)
 	return l
 }
+
+func TestPullImageSetResumesMultiArchImage(t *testing.T) {
+	manifestRequests := atomic.Int32{}
+	registryHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+			manifestRequests.Add(1)
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authn.Anonymous, true, false)
+	pullCtx := &contexts.PullContext{BaseContext: contexts.BaseContext{
+		Logger:       testLogger,
+		RegistryAuth: authn.Anonymous,
+		Insecure:     true,
+	}}
+
+	amd64Image, err := random.Image(256, 1)
+	require.NoError(t, err)
+	arm64Image, err := random.Image(256, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64Image, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64Image, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://")+"/deckhouse/ee:v1.0.0", nameOpts...)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, index, remoteOpts...))
+	imageSet := map[string]struct{}{ref.String(): {}}
+
+	targetLayout := createEmptyOCILayout(t)
+	resolver := NewTagsResolver()
+	require.NoError(t, resolver.ResolveTagsDigestsFromImageSet(imageSet, authn.Anonymous, true, false))
+	require.NoError(t, PullImageSet(pullCtx, targetLayout, imageSet, WithTagToDigestMapper(resolver.GetTagDigest)))
+
+	indexDigest, err := index.Digest()
+	require.NoError(t, err)
+	pulled, err := findPulledImages(targetLayout)
+	require.NoError(t, err)
+	require.Equal(t, map[string]v1.Hash{ref.String(): indexDigest}, pulled)
+
+	manifestRequests.Store(0)
+	require.NoError(t, PullImageSet(pullCtx, targetLayout, imageSet, WithTagToDigestMapper(resolver.GetTagDigest)))
+	require.Zero(t, manifestRequests.Load(), "Multi-arch image should not be pulled again")
+}
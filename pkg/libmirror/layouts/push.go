@@ -20,7 +20,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -28,12 +27,11 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/hashicorp/go-multierror"
 	"github.com/samber/lo"
-	"github.com/samber/lo/parallel"
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/concurrent"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/retry"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/retry/task"
@@ -109,17 +107,9 @@ func PushLayoutToRepoContext(
 				logger.InfoF("- %s", registryRepo+":"+manifest.Annotations["io.deckhouse.image.short_tag"])
 			}
 
-			errMu := &sync.Mutex{}
-			merr := &multierror.Error{}
-			parallel.ForEach(manifestSet, func(item v1.Descriptor, i int) {
-				if err = pushImage(ctx, registryRepo, index, item, refOpts, remoteOpts); err != nil {
-					errMu.Lock()
-					defer errMu.Unlock()
-					merr = multierror.Append(merr, err)
-				}
+			return concurrent.ForEach(manifestSet, len(manifestSet), func(item v1.Descriptor) error {
+				return pushImage(ctx, registryRepo, index, item, refOpts, remoteOpts)
 			})
-
-			return merr.ErrorOrNil()
 		})
 		if err != nil {
 			return fmt.Errorf("Push batch of images: %w", err)
@@ -155,7 +145,7 @@ func pushImage(
 		task.WithConstantRetries(4, 3*time.Second, func(ctx context.Context) error {
 			if err = remote.Write(ref, img, append(remoteOpts, remote.WithContext(ctx))...); err != nil {
 				if errorutil.IsTrivyMediaTypeNotAllowedError(err) {
-					return fmt.Errorf(errorutil.CustomTrivyMediaTypesWarning)
+					return errorutil.ErrCustomMediaTypesNotAllowed
 				}
 				return fmt.Errorf("Write %s to registry: %w", ref.String(), err)
 			}
@@ -163,7 +153,7 @@ func pushImage(
 		}),
 	)
 	if err != nil {
-		return fmt.Errorf("Run push task: %v", err)
+		return fmt.Errorf("Run push task: %w", err)
 	}
 	return nil
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package layouts
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -44,6 +45,14 @@ func NopTagToDigestMappingFunc(_ string) *v1.Hash {
 }
 
 func (r *TagsResolver) ResolveTagsDigestsForImageLayouts(mirrorCtx *contexts.BaseContext, layouts *ImageLayouts) error {
+	return r.ResolveTagsDigestsForImageLayoutsContext(context.Background(), mirrorCtx, layouts)
+}
+
+func (r *TagsResolver) ResolveTagsDigestsForImageLayoutsContext(
+	ctx context.Context,
+	mirrorCtx *contexts.BaseContext,
+	layouts *ImageLayouts,
+) error {
 	imageSets := []map[string]struct{}{
 		layouts.DeckhouseImages,
 		layouts.ReleaseChannelImages,
@@ -57,7 +66,8 @@ func (r *TagsResolver) ResolveTagsDigestsForImageLayouts(mirrorCtx *contexts.Bas
 	}
 
 	for _, imageSet := range imageSets {
-		if err := r.ResolveTagsDigestsFromImageSet(
+		if err := r.ResolveTagsDigestsFromImageSetContext(
+			ctx,
 			imageSet,
 			mirrorCtx.RegistryAuth,
 			mirrorCtx.Insecure,
@@ -74,8 +84,18 @@ func (r *TagsResolver) ResolveTagsDigestsFromImageSet(
 	imageSet map[string]struct{},
 	authProvider authn.Authenticator,
 	insecure, skipTLSVerification bool,
+) error {
+	return r.ResolveTagsDigestsFromImageSetContext(context.Background(), imageSet, authProvider, insecure, skipTLSVerification)
+}
+
+func (r *TagsResolver) ResolveTagsDigestsFromImageSetContext(
+	ctx context.Context,
+	imageSet map[string]struct{},
+	authProvider authn.Authenticator,
+	insecure, skipTLSVerification bool,
 ) error {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authProvider, insecure, skipTLSVerification)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
 	for imageRef := range imageSet {
 		if images.IsValidImageDigestString(imageRef) {
 			continue
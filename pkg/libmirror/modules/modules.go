@@ -17,6 +17,7 @@ limitations under the License.
 package modules
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -41,12 +42,17 @@ type Module struct {
 }
 
 func GetDeckhouseExternalModules(mirrorCtx *contexts.PullContext) ([]Module, error) {
+	return GetDeckhouseExternalModulesContext(context.Background(), mirrorCtx)
+}
+
+func GetDeckhouseExternalModulesContext(ctx context.Context, mirrorCtx *contexts.PullContext) ([]Module, error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(&mirrorCtx.BaseContext)
 	repoPathBuildFuncForDeckhouseModule := func(repo, moduleName string) string {
 		return fmt.Sprintf("%s/modules/%s", mirrorCtx.DeckhouseRegistryRepo, moduleName)
 	}
 
 	result, err := getModulesForRepo(
+		ctx,
 		mirrorCtx.DeckhouseRegistryRepo+"/modules",
 		repoPathBuildFuncForDeckhouseModule,
 		nameOpts,
@@ -60,12 +66,21 @@ func GetDeckhouseExternalModules(mirrorCtx *contexts.PullContext) ([]Module, err
 }
 
 func GetExternalModulesFromRepo(repo string, registryAuth authn.Authenticator, insecure, skipVerifyTLS bool) ([]Module, error) {
+	return GetExternalModulesFromRepoContext(context.Background(), repo, registryAuth, insecure, skipVerifyTLS)
+}
+
+func GetExternalModulesFromRepoContext(
+	ctx context.Context,
+	repo string,
+	registryAuth authn.Authenticator,
+	insecure, skipVerifyTLS bool,
+) ([]Module, error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(registryAuth, insecure, skipVerifyTLS)
 	repoPathBuildFuncForExternalModule := func(repo, moduleName string) string {
 		return fmt.Sprintf("%s/%s", repo, moduleName)
 	}
 
-	result, err := getModulesForRepo(repo, repoPathBuildFuncForExternalModule, nameOpts, remoteOpts)
+	result, err := getModulesForRepo(ctx, repo, repoPathBuildFuncForExternalModule, nameOpts, remoteOpts)
 	if err != nil {
 		return nil, fmt.Errorf("Get external modules: %w", err)
 	}
@@ -74,6 +89,7 @@ func GetExternalModulesFromRepo(repo string, registryAuth authn.Authenticator, i
 }
 
 func getModulesForRepo(
+	ctx context.Context,
 	repo string,
 	repoPathBuildFunc func(repo, moduleName string) string,
 	nameOpts []name.Option,
@@ -83,6 +99,7 @@ func getModulesForRepo(
 	if err != nil {
 		return nil, fmt.Errorf("Parsing modules repo: %v", err)
 	}
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
 
 	modules, err := remote.List(modulesRepo, remoteOpts...)
 	if err != nil {
@@ -118,8 +135,19 @@ func FindExternalModuleImages(
 	filter *Filter,
 	authProvider authn.Authenticator,
 	insecure, skipVerifyTLS bool,
+) (moduleImages, releaseImages map[string]struct{}, err error) {
+	return FindExternalModuleImagesContext(context.Background(), mod, filter, authProvider, insecure, skipVerifyTLS)
+}
+
+func FindExternalModuleImagesContext(
+	ctx context.Context,
+	mod *Module,
+	filter *Filter,
+	authProvider authn.Authenticator,
+	insecure, skipVerifyTLS bool,
 ) (moduleImages, releaseImages map[string]struct{}, err error) {
 	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
 
 	moduleImages = map[string]struct{}{}
 	releaseImages = map[string]struct{}{}
@@ -129,7 +157,7 @@ func FindExternalModuleImages(
 		return nil, nil, fmt.Errorf("Get available release channels of module: %w", err)
 	}
 
-	releaseChannelVersions, err := releases.FetchVersionsFromModuleReleaseChannels(releaseImages, authProvider, insecure, skipVerifyTLS)
+	releaseChannelVersions, err := releases.FetchVersionsFromModuleReleaseChannelsContext(ctx, releaseImages, authProvider, insecure, skipVerifyTLS)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Fetch versions from %q release channels: %w", mod.Name, err)
 	}
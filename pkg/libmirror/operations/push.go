@@ -5,19 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/targets"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/concurrent"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
 )
 
 func PushDeckhouseToRegistry(mirrorCtx *contexts.PushContext) error {
@@ -27,30 +35,36 @@ func PushDeckhouseToRegistry(mirrorCtx *contexts.PushContext) error {
 func PushDeckhouseToRegistryContext(ctx context.Context, mirrorCtx *contexts.PushContext) error {
 	logger := mirrorCtx.Logger
 	logger.InfoF("Looking for Deckhouse images to push")
-	ociLayouts, modulesList, err := findLayoutsToPush(ctx, mirrorCtx)
+	ociLayouts, err := findLayoutsToPush(ctx, mirrorCtx)
 	if err != nil {
 		return fmt.Errorf("Find OCI Image Layouts to push: %w", err)
 	}
 
-	for repo, ociLayout := range ociLayouts {
-		logger.InfoLn("Mirroring", repo)
-		err = layouts.PushLayoutToRepoContext(
-			ctx, ociLayout, repo,
-			mirrorCtx.RegistryAuth,
-			mirrorCtx.Logger,
-			mirrorCtx.Parallelism,
-			mirrorCtx.Insecure,
-			mirrorCtx.SkipTLSVerification,
-		)
-		switch {
-		case errors.Is(err, layouts.ErrEmptyLayout):
-			logger.InfoF("Skipped repo %s as it contains no images", repo)
-			continue
-		case err != nil:
+	for _, repo := range sortedRepos(ociLayouts.platform) {
+		_, isSecurityRepo := ociLayouts.security[repo]
+		if err = pushLayout(ctx, mirrorCtx, repo, ociLayouts.platform[repo], isSecurityRepo); err != nil {
 			return fmt.Errorf("Push Deckhouse to registry: %w", err)
 		}
+	}
 
-		logger.InfoF("Repo %s is mirrored", repo)
+	modulesList := ociLayouts.moduleNames()
+	err = concurrent.ForEach(modulesList, mirrorCtx.Parallelism.Modules, func(moduleName string) error {
+		moduleLayouts := ociLayouts.modules[moduleName]
+		for _, repo := range sortedRepos(moduleLayouts) {
+			if err := pushLayout(ctx, mirrorCtx, repo, moduleLayouts[repo], false); err != nil {
+				return fmt.Errorf("Push module %s to registry: %w", moduleName, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range sortedRepos(ociLayouts.extra) {
+		if err = pushLayout(ctx, extraRepoContext(mirrorCtx, repo), repo, ociLayouts.extra[repo], false); err != nil {
+			return fmt.Errorf("Push extra images to registry: %w", err)
+		}
 	}
 
 	logger.InfoLn("All repositories are mirrored")
@@ -60,7 +74,7 @@ func PushDeckhouseToRegistryContext(ctx context.Context, mirrorCtx *contexts.Pus
 	}
 
 	logger.InfoLn("Pushing modules tags")
-	if err = pushModulesTags(ctx, &mirrorCtx.BaseContext, modulesList); err != nil {
+	if err = pushModulesTags(ctx, &mirrorCtx.BaseContext, modulesRepo(mirrorCtx), modulesList); err != nil {
 		return fmt.Errorf("Push modules tags: %w", err)
 	}
 	logger.InfoF("All modules tags are pushed")
@@ -68,7 +82,143 @@ func PushDeckhouseToRegistryContext(ctx context.Context, mirrorCtx *contexts.Pus
 	return nil
 }
 
-func pushModulesTags(ctx context.Context, mirrorCtx *contexts.BaseContext, modulesList []string) error {
+// pushLayout pushes the layout to the repo. Security databases are skipped if the registry rejects their media types
+// and mirrorCtx.OptionalSecurityDatabases is set.
+func pushLayout(ctx context.Context, mirrorCtx *contexts.PushContext, repo string, ociLayout layout.Path, isSecurityRepo bool) error {
+	logger := mirrorCtx.Logger
+	logger.InfoLn("Mirroring", repo)
+	err := layouts.PushLayoutToRepoContext(
+		ctx, ociLayout, repo,
+		mirrorCtx.RegistryAuth,
+		mirrorCtx.Logger,
+		mirrorCtx.Parallelism,
+		mirrorCtx.Insecure,
+		mirrorCtx.SkipTLSVerification,
+	)
+	switch {
+	case errors.Is(err, layouts.ErrEmptyLayout):
+		logger.InfoF("Skipped repo %s as it contains no images", repo)
+		return nil
+	case mirrorCtx.OptionalSecurityDatabases && isSecurityRepo && errors.Is(err, errorutil.ErrCustomMediaTypesNotAllowed):
+		logger.WarnF("Skipped repo %s: %v", repo, err)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	logger.InfoF("Repo %s is mirrored", repo)
+	return nil
+}
+
+// extraRepoContext returns the context to push extra images to repo with. Registries other than the one Deckhouse
+// is pushed to are accessed over verified HTTPS with the credentials from the docker config, the same way pull does.
+func extraRepoContext(mirrorCtx *contexts.PushContext, repo string) *contexts.PushContext {
+	repository, err := name.NewRepository(repo)
+	if err != nil {
+		return mirrorCtx
+	}
+	registry, err := name.NewRegistry(mirrorCtx.RegistryHost)
+	if err != nil || registry.RegistryStr() == repository.RegistryStr() {
+		return mirrorCtx
+	}
+
+	repoCtx := *mirrorCtx
+	repoCtx.Insecure, repoCtx.SkipTLSVerification = false, false
+	repoCtx.RegistryAuth, err = authn.DefaultKeychain.Resolve(repository.Registry)
+	if err != nil {
+		mirrorCtx.Logger.WarnF("Read credentials for %s from docker config: %v", repository.RegistryStr(), err)
+		repoCtx.RegistryAuth = authn.Anonymous
+	}
+	return &repoCtx
+}
+
+// PushDeckhouseToTarget writes images of the bundle into the local push target instead of the registry.
+// Repositories and tags are the same as they would be in the registry at mirrorCtx.RegistryHost and mirrorCtx.RegistryPath.
+func PushDeckhouseToTarget(mirrorCtx *contexts.PushContext, target targets.Target) error {
+	return PushDeckhouseToTargetContext(context.Background(), mirrorCtx, target)
+}
+
+func PushDeckhouseToTargetContext(ctx context.Context, mirrorCtx *contexts.PushContext, target targets.Target) error {
+	logger := mirrorCtx.Logger
+	logger.InfoF("Looking for Deckhouse images to push")
+	ociLayouts, err := findLayoutsToPush(ctx, mirrorCtx)
+	if err != nil {
+		return fmt.Errorf("Find OCI Image Layouts to push: %w", err)
+	}
+
+	allLayouts := maps.Clone(ociLayouts.platform)
+	maps.Copy(allLayouts, ociLayouts.extra)
+	for _, moduleLayouts := range ociLayouts.modules {
+		maps.Copy(allLayouts, moduleLayouts)
+	}
+	for _, repo := range sortedRepos(allLayouts) {
+		logger.InfoLn("Mirroring", repo)
+		if err = writeLayoutToTarget(ctx, allLayouts[repo], repo, target); err != nil {
+			return fmt.Errorf("Write %s: %w", repo, err)
+		}
+		logger.InfoF("Repo %s is mirrored", repo)
+	}
+
+	logger.InfoLn("All repositories are mirrored")
+
+	modulesRepo := modulesRepo(mirrorCtx)
+	for _, moduleName := range ociLayouts.moduleNames() {
+		img, err := random.Image(32, 1)
+		if err != nil {
+			return fmt.Errorf("random.Image: %w", err)
+		}
+		if err = target.WriteImage(modulesRepo, moduleName, img); err != nil {
+			return fmt.Errorf("Write module index tag: %w", err)
+		}
+	}
+
+	if err = target.Close(); err != nil {
+		return fmt.Errorf("Write push target: %w", err)
+	}
+	return nil
+}
+
+func writeLayoutToTarget(ctx context.Context, ociLayout layout.Path, repo string, target targets.Target) error {
+	index, err := ociLayout.ImageIndex()
+	if err != nil {
+		return fmt.Errorf("Read OCI Image Index: %w", err)
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("Parse OCI Image Index Manifest: %w", err)
+	}
+
+	for _, manifest := range indexManifest.Manifests {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		tag := manifest.Annotations["io.deckhouse.image.short_tag"]
+		switch {
+		case manifest.MediaType.IsIndex():
+			imageIndex, err := index.ImageIndex(manifest.Digest)
+			if err != nil {
+				return fmt.Errorf("Read image index: %w", err)
+			}
+			if err = target.WriteIndex(repo, tag, imageIndex); err != nil {
+				return err
+			}
+		case manifest.MediaType.IsImage():
+			img, err := index.Image(manifest.Digest)
+			if err != nil {
+				return fmt.Errorf("Read image: %w", err)
+			}
+			if err = target.WriteImage(repo, tag, img); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unsupported media type %q of %s", manifest.MediaType, manifest.Digest)
+		}
+	}
+	return nil
+}
+
+func pushModulesTags(ctx context.Context, mirrorCtx *contexts.BaseContext, modulesRepo string, modulesList []string) error {
 	if len(modulesList) == 0 {
 		return nil
 	}
@@ -76,7 +226,6 @@ func pushModulesTags(ctx context.Context, mirrorCtx *contexts.BaseContext, modul
 	logger := mirrorCtx.Logger
 	refOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
 	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
-	modulesRepo := path.Join(mirrorCtx.RegistryHost, mirrorCtx.RegistryPath, "modules")
 	pushCount := 1
 	for _, moduleName := range modulesList {
 		logger.InfoF("[%d / %d] Pushing module tag for %s", pushCount, len(modulesList), moduleName)
@@ -99,25 +248,75 @@ func pushModulesTags(ctx context.Context, mirrorCtx *contexts.BaseContext, modul
 	return nil
 }
 
-func findLayoutsToPush(ctx context.Context, mirrorCtx *contexts.PushContext) (map[string]layout.Path, []string, error) {
-	ociLayouts := make(map[string]layout.Path)
+func modulesRepo(mirrorCtx *contexts.PushContext) string {
+	return mirrorCtx.RewriteRules.Repo(path.Join(mirrorCtx.RegistryHost, mirrorCtx.RegistryPath, "modules"))
+}
+
+// layoutsToPush are OCI Image Layouts of the bundle by repositories they are pushed to.
+type layoutsToPush struct {
+	platform map[string]layout.Path
+	// Layouts of every module by module names.
+	modules map[string]map[string]layout.Path
+	// Layouts of extra images and charts.
+	extra map[string]layout.Path
+	// Repositories security artifacts of the bundle are pushed to, they are found by their paths in the bundle
+	// as rewrite rules may put them anywhere.
+	security map[string]struct{}
+	// All repositories layouts are pushed to, each repository can only be pushed once.
+	repos map[string]struct{}
+}
+
+func (l *layoutsToPush) add(repos map[string]layout.Path, repo string, ociLayout layout.Path) error {
+	if _, found := l.repos[repo]; found {
+		return fmt.Errorf("%w: %s", rewrite.ErrConflict, repo)
+	}
+	l.repos[repo] = struct{}{}
+	repos[repo] = ociLayout
+	return nil
+}
+
+func (l *layoutsToPush) moduleNames() []string {
+	names := make([]string, 0, len(l.modules))
+	for moduleName := range l.modules {
+		names = append(names, moduleName)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func sortedRepos(ociLayouts map[string]layout.Path) []string {
+	repos := make([]string, 0, len(ociLayouts))
+	for repo := range ociLayouts {
+		repos = append(repos, repo)
+	}
+	slices.Sort(repos)
+	return repos
+}
+
+func findLayoutsToPush(ctx context.Context, mirrorCtx *contexts.PushContext) (*layoutsToPush, error) {
+	ociLayouts := &layoutsToPush{
+		platform: make(map[string]layout.Path),
+		modules:  make(map[string]map[string]layout.Path),
+		extra:    make(map[string]layout.Path),
+		security: make(map[string]struct{}),
+		repos:    make(map[string]struct{}),
+	}
 	bundlePaths := [][]string{
 		{""}, // Root contains main deckhouse repo
 		{"install"},
 		{"install-standalone"},
 		{"release-channel"},
-		{"security", "trivy-db"},
-		{"security", "trivy-bdu"},
-		{"security", "trivy-java-db"},
-		{"security", "trivy-checks"},
+	}
+	for _, artifact := range mirrorCtx.Security() {
+		bundlePaths = append(bundlePaths, []string{"security", artifact.Name})
 	}
 
 	for _, bundlePath := range bundlePaths {
 		if err := ctx.Err(); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		indexRef := path.Join(append([]string{mirrorCtx.RegistryHost + mirrorCtx.RegistryPath}, bundlePath...)...)
+		indexRef := mirrorCtx.RewriteRules.Repo(path.Join(append([]string{mirrorCtx.RegistryHost + mirrorCtx.RegistryPath}, bundlePath...)...))
 		layoutFileSystemPath := filepath.Join(append([]string{mirrorCtx.UnpackedImagesPath}, bundlePath...)...)
 		l, err := layout.FromPath(layoutFileSystemPath)
 		if err != nil {
@@ -126,24 +325,32 @@ func findLayoutsToPush(ctx context.Context, mirrorCtx *contexts.PushContext) (ma
 				mirrorCtx.Logger.DebugF("Skipping push of %q as it is missing from bundle", strings.Join(bundlePath, "/"))
 				continue
 			}
-			return nil, nil, err
+			return nil, err
+		}
+		if err = ociLayouts.add(ociLayouts.platform, indexRef, l); err != nil {
+			return nil, err
+		}
+		if bundlePath[0] == "security" {
+			ociLayouts.security[indexRef] = struct{}{}
 		}
-		ociLayouts[indexRef] = l
+	}
+
+	if err := findExtraLayoutsToPush(ctx, mirrorCtx, ociLayouts); err != nil {
+		return nil, fmt.Errorf("find extra images: %w", err)
 	}
 
 	modulesPath := filepath.Join(mirrorCtx.UnpackedImagesPath, "modules")
-	modulesNames := make([]string, 0)
 	dirs, err := os.ReadDir(modulesPath)
 	switch {
 	case errors.Is(err, fs.ErrNotExist):
-		return ociLayouts, []string{}, nil
+		return ociLayouts, nil
 	case err != nil:
-		return nil, nil, err
+		return nil, err
 	}
 
 	for _, dirEntry := range dirs {
 		if err = ctx.Err(); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		if !dirEntry.IsDir() {
@@ -151,19 +358,67 @@ func findLayoutsToPush(ctx context.Context, mirrorCtx *contexts.PushContext) (ma
 		}
 
 		moduleName := dirEntry.Name()
-		modulesNames = append(modulesNames, moduleName)
-		moduleRef := path.Join(mirrorCtx.RegistryHost+mirrorCtx.RegistryPath, "modules", moduleName)
-		moduleReleasesRef := path.Join(mirrorCtx.RegistryHost+mirrorCtx.RegistryPath, "modules", moduleName, "release")
+		moduleRef := mirrorCtx.RewriteRules.Repo(path.Join(mirrorCtx.RegistryHost+mirrorCtx.RegistryPath, "modules", moduleName))
+		moduleReleasesRef := mirrorCtx.RewriteRules.Repo(path.Join(mirrorCtx.RegistryHost+mirrorCtx.RegistryPath, "modules", moduleName, "release"))
 		moduleLayout, err := layout.FromPath(filepath.Join(modulesPath, moduleName))
 		if err != nil {
-			return nil, nil, fmt.Errorf("create module layout from path: %w", err)
+			return nil, fmt.Errorf("create module layout from path: %w", err)
 		}
 		moduleReleaseLayout, err := layout.FromPath(filepath.Join(modulesPath, moduleName, "release"))
 		if err != nil {
-			return nil, nil, fmt.Errorf("create module release layout from path: %w", err)
+			return nil, fmt.Errorf("create module release layout from path: %w", err)
+		}
+		moduleLayouts := make(map[string]layout.Path)
+		if err = ociLayouts.add(moduleLayouts, moduleRef, moduleLayout); err != nil {
+			return nil, err
 		}
-		ociLayouts[moduleRef] = moduleLayout
-		ociLayouts[moduleReleasesRef] = moduleReleaseLayout
+		if err = ociLayouts.add(moduleLayouts, moduleReleasesRef, moduleReleaseLayout); err != nil {
+			return nil, err
+		}
+		ociLayouts.modules[moduleName] = moduleLayouts
+	}
+	return ociLayouts, nil
+}
+
+// findExtraLayoutsToPush adds layouts found under the extra folder of the bundle, each is pushed to the repository
+// at the same path under the extra images repo.
+func findExtraLayoutsToPush(ctx context.Context, mirrorCtx *contexts.PushContext, ociLayouts *layoutsToPush) error {
+	extraRepo := mirrorCtx.ExtraImagesRepo
+	if extraRepo == "" {
+		extraRepo = path.Join(mirrorCtx.RegistryHost+mirrorCtx.RegistryPath, extra.Folder)
+	}
+
+	extraPath := filepath.Join(mirrorCtx.UnpackedImagesPath, extra.Folder)
+	err := filepath.WalkDir(extraPath, func(fsPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if entry.Name() == "blobs" {
+			return filepath.SkipDir
+		}
+		if _, err = os.Stat(filepath.Join(fsPath, "oci-layout")); err != nil {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(extraPath, fsPath)
+		if err != nil {
+			return err
+		}
+		l, err := layout.FromPath(fsPath)
+		if err != nil {
+			return fmt.Errorf("create extra images layout from path: %w", err)
+		}
+		repo := mirrorCtx.RewriteRules.Repo(path.Join(extraRepo, filepath.ToSlash(relPath)))
+		return ociLayouts.add(ociLayouts.extra, repo, l)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
 	}
-	return ociLayouts, modulesNames, nil
+	return err
 }
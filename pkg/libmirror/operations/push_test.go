@@ -0,0 +1,130 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/rewrite"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+func TestPushSkipsRejectedSecurityDatabasesWithRewriteRules(t *testing.T) {
+	// Registry rejects media types of security databases like Quay does
+	registryHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/security-") && strings.Contains(r.URL.Path, "/manifests/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"MANIFEST_INVALID","message":"manifest invalid","detail":"media type application/vnd.aquasec.trivy.config.v1+json is not allowed"}]}`))
+			return
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	registryHost := strings.TrimPrefix(server.URL, "http://")
+
+	bundleDir := t.TempDir()
+	writeTestLayout(t, bundleDir, "v1.61.2")
+	writeTestLayout(t, filepath.Join(bundleDir, "security", "trivy-db"), "2")
+
+	rules, err := rewrite.Parse([]byte(`
+rules:
+  - regex: ^` + strings.ReplaceAll(registryHost, ".", `\.`) + `/deckhouse/security/(.+)$
+    replacement: ` + registryHost + `/deckhouse/security-$1
+`))
+	require.NoError(t, err)
+
+	pushCtx := &contexts.PushContext{
+		BaseContext: contexts.BaseContext{
+			RegistryAuth:       authn.Anonymous,
+			RegistryHost:       registryHost,
+			RegistryPath:       "/deckhouse",
+			UnpackedImagesPath: bundleDir,
+			Insecure:           true,
+			SecurityArtifacts:  []security.Artifact{{Name: "trivy-db", Tag: "2"}},
+			Logger:             log.NewSLogger(slog.LevelDebug),
+		},
+		Parallelism:  contexts.DefaultParallelism,
+		RewriteRules: rules,
+	}
+
+	err = PushDeckhouseToRegistryContext(context.Background(), pushCtx)
+	require.Error(t, err, "Rejected security database should fail the push unless it is optional")
+
+	pushCtx.OptionalSecurityDatabases = true
+	require.NoError(t, PushDeckhouseToRegistryContext(context.Background(), pushCtx))
+}
+
+func writeTestLayout(t *testing.T, layoutPath, tag string) {
+	t.Helper()
+
+	l, err := layouts.CreateEmptyImageLayoutAtPath(layoutPath)
+	require.NoError(t, err)
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	require.NoError(t, l.AppendImage(img,
+		layout.WithPlatform(v1.Platform{Architecture: "amd64", OS: "linux"}),
+		layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": "registry.example.com/deckhouse:" + tag,
+			"io.deckhouse.image.short_tag":      tag,
+		}),
+	))
+}
+
+func TestExtraRepoContextUsesDockerConfigForOtherRegistries(t *testing.T) {
+	dockerConfigDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfigDir)
+	require.NoError(t, os.WriteFile(filepath.Join(dockerConfigDir, "config.json"),
+		[]byte(`{"auths":{"mirror.example.com":{"username":"extra","password":"secret"}}}`), 0o600))
+
+	mirrorCtx := &contexts.PushContext{BaseContext: contexts.BaseContext{
+		Logger:              log.NewSLogger(slog.LevelWarn),
+		RegistryHost:        "registry.example.com:5000",
+		RegistryPath:        "/deckhouse/ee",
+		RegistryAuth:        authn.FromConfig(authn.AuthConfig{Username: "deckhouse", Password: "secret"}),
+		Insecure:            true,
+		SkipTLSVerification: true,
+	}}
+
+	require.Same(t, mirrorCtx, extraRepoContext(mirrorCtx, "registry.example.com:5000/deckhouse/ee/extra/library/nginx"))
+
+	repoCtx := extraRepoContext(mirrorCtx, "mirror.example.com/library/nginx")
+	require.False(t, repoCtx.Insecure)
+	require.False(t, repoCtx.SkipTLSVerification)
+	authConfig, err := repoCtx.RegistryAuth.Authorization()
+	require.NoError(t, err)
+	require.Equal(t, "extra", authConfig.Username)
+	require.True(t, mirrorCtx.Insecure, "Context of the main registry should not be changed")
+}
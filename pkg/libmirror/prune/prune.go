@@ -0,0 +1,368 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/exp/maps"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/images"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/registry"
+)
+
+// Images pulled by digest are pushed with the hex part of the digest as a tag.
+var digestTagRegex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+var releaseChannels = []string{"alpha", "beta", "early-access", "stable", "rock-solid"}
+
+type Options struct {
+	// KeepOlderVersions is the number of versions older than the oldest version on release channels that are kept.
+	KeepOlderVersions int
+}
+
+// product is the set of repositories of Deckhouse or one of its modules that are released together.
+type product struct {
+	name string
+	// Repo with release channels images tagged by channel names and release versions.
+	channelsRepo string
+	// Repos that hold images tagged by release versions.
+	versionRepos []string
+	// Repo with images pulled by digests, that are referenced by digestsFile of images in digestsImageRepo.
+	digestsRepo      string
+	digestsImageRepo string
+	digestsFile      string
+}
+
+// Plan lists tags that are not needed anymore.
+type Plan struct {
+	Products []ProductPlan
+}
+
+type ProductPlan struct {
+	Name string
+	// Versions on the release channels by channel names.
+	Channels map[string]string
+	// Versions that are kept in the registry.
+	KeptVersions []string
+	// Image references to delete.
+	Delete []string
+	// Reasons why some of the images were not considered for deletion.
+	Warnings []string
+}
+
+// MakePlan works out which Deckhouse and modules versions in the registry at mirrorCtx.RegistryHost and mirrorCtx.RegistryPath
+// are not referenced by release channels and older than the configured number of kept versions.
+func MakePlan(ctx context.Context, mirrorCtx *contexts.BaseContext, opts Options) (*Plan, error) {
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
+	p := &planner{opts: opts, nameOpts: nameOpts, remoteOpts: remoteOpts, tags: map[string][]string{}}
+
+	rootRepo := path.Join(mirrorCtx.RegistryHost, mirrorCtx.RegistryPath)
+	products := []product{{
+		name:             "Deckhouse",
+		channelsRepo:     path.Join(rootRepo, "release-channel"),
+		versionRepos:     []string{rootRepo, path.Join(rootRepo, "install"), path.Join(rootRepo, "install-standalone"), path.Join(rootRepo, "release-channel")},
+		digestsRepo:      rootRepo,
+		digestsImageRepo: path.Join(rootRepo, "install"),
+		digestsFile:      "deckhouse/candi/images_digests.json",
+	}}
+
+	modules, err := p.listTags(path.Join(rootRepo, "modules"))
+	if err != nil {
+		return nil, fmt.Errorf("list modules: %w", err)
+	}
+	for _, moduleName := range modules {
+		moduleRepo := path.Join(rootRepo, "modules", moduleName)
+		products = append(products, product{
+			name:             "Module " + moduleName,
+			channelsRepo:     path.Join(moduleRepo, "release"),
+			versionRepos:     []string{moduleRepo, path.Join(moduleRepo, "release")},
+			digestsRepo:      moduleRepo,
+			digestsImageRepo: moduleRepo,
+			digestsFile:      "images_digests.json",
+		})
+	}
+
+	plan := &Plan{}
+	for _, prod := range products {
+		productPlan, err := p.planProduct(prod)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", prod.name, err)
+		}
+		plan.Products = append(plan.Products, *productPlan)
+	}
+	return plan, nil
+}
+
+type planner struct {
+	opts       Options
+	nameOpts   []name.Option
+	remoteOpts []remote.Option
+	tags       map[string][]string // Cached tags of repos
+}
+
+func (p *planner) planProduct(prod product) (*ProductPlan, error) {
+	plan := &ProductPlan{Name: prod.name, Channels: map[string]string{}}
+
+	channelTags, err := p.listTags(prod.channelsRepo)
+	if err != nil {
+		return nil, err
+	}
+	var oldestChannelVersion *semver.Version
+	for _, tag := range channelTags {
+		if !slices.Contains(releaseChannels, tag) {
+			continue
+		}
+		version, err := p.channelVersion(prod.channelsRepo + ":" + tag)
+		if err != nil {
+			return nil, fmt.Errorf("read release channel %s: %w", tag, err)
+		}
+		plan.Channels[tag] = "v" + version.String()
+		if oldestChannelVersion == nil || version.LessThan(oldestChannelVersion) {
+			oldestChannelVersion = version
+		}
+	}
+	if oldestChannelVersion == nil {
+		plan.Warnings = append(plan.Warnings, "No release channels found, nothing is pruned")
+		return plan, nil
+	}
+
+	// Versions are keyed by the parsed semver, so that tags like v1.60 and 1.60.0 refer to the same release.
+	allVersions := map[string]*semver.Version{}
+	for _, repo := range prod.versionRepos {
+		tags, err := p.listTags(repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if version, err := semver.NewVersion(tag); err == nil {
+				allVersions[version.String()] = version
+			}
+		}
+	}
+
+	versions := maps.Values(allVersions)
+	slices.SortFunc(versions, func(a, b *semver.Version) int { return b.Compare(a) })
+	keptVersions := map[string]struct{}{}
+	olderVersionsKept := 0
+	for _, version := range versions {
+		if version.LessThan(oldestChannelVersion) {
+			if olderVersionsKept >= p.opts.KeepOlderVersions {
+				continue
+			}
+			olderVersionsKept++
+		}
+		keptVersions[version.String()] = struct{}{}
+		plan.KeptVersions = append(plan.KeptVersions, "v"+version.String())
+	}
+
+	for _, repo := range prod.versionRepos {
+		tags, _ := p.listTags(repo)
+		for _, tag := range tags {
+			version, err := semver.NewVersion(tag)
+			if err != nil {
+				continue
+			}
+			if _, kept := keptVersions[version.String()]; !kept {
+				plan.Delete = append(plan.Delete, repo+":"+tag)
+			}
+		}
+	}
+
+	referencedDigests, err := p.referencedDigests(prod, keptVersions)
+	if err != nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Images pulled by digests are not pruned: %v", err))
+		return plan, nil
+	}
+	digestsRepoTags, err := p.listTags(prod.digestsRepo)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range digestsRepoTags {
+		if !digestTagRegex.MatchString(tag) {
+			continue
+		}
+		if _, referenced := referencedDigests["sha256:"+tag]; !referenced {
+			plan.Delete = append(plan.Delete, prod.digestsRepo+":"+tag)
+		}
+	}
+
+	return plan, nil
+}
+
+func (p *planner) channelVersion(ref string) (*semver.Version, error) {
+	img, err := p.image(ref)
+	if err != nil {
+		return nil, err
+	}
+	versionJSON, err := images.ExtractFileFromImage(img, "version.json")
+	if err != nil {
+		return nil, fmt.Errorf("read version.json from %s: %w", ref, err)
+	}
+	releaseInfo := &struct {
+		Version string `json:"version"`
+	}{}
+	if err = json.Unmarshal(versionJSON.Bytes(), releaseInfo); err != nil {
+		return nil, fmt.Errorf("parse version.json from %s: %w", ref, err)
+	}
+	return semver.NewVersion(releaseInfo.Version)
+}
+
+// referencedDigests reads digests of images used by kept versions.
+// Error is returned if any of the kept versions can not be read, as it is not safe to delete images pulled by digests then.
+func (p *planner) referencedDigests(prod product, keptVersions map[string]struct{}) (map[string]struct{}, error) {
+	tags, err := p.listTags(prod.digestsImageRepo)
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]struct{}{}
+	for _, tag := range tags {
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		if _, kept := keptVersions[version.String()]; !kept {
+			continue
+		}
+		img, err := p.image(prod.digestsImageRepo + ":" + tag)
+		if err != nil {
+			return nil, fmt.Errorf("read %s:%s: %w", prod.digestsImageRepo, tag, err)
+		}
+		digestsFile, err := images.ExtractFileFromImage(img, prod.digestsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read %s from %s:%s: %w", prod.digestsFile, prod.digestsImageRepo, tag, err)
+		}
+		for _, digest := range images.ExtractDigestsFromJSONFile(digestsFile.Bytes()) {
+			digests[digest] = struct{}{}
+		}
+	}
+	return digests, nil
+}
+
+func (p *planner) image(ref string) (v1.Image, error) {
+	parsedRef, err := name.ParseReference(ref, p.nameOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Image(parsedRef, p.remoteOpts...)
+}
+
+// listTags returns tags of the repo, missing repos have no tags.
+func (p *planner) listTags(repo string) ([]string, error) {
+	if tags, cached := p.tags[repo]; cached {
+		return tags, nil
+	}
+
+	tags, err := registry.ListTags(repo, p.nameOpts, p.remoteOpts)
+	if err != nil {
+		return nil, err
+	}
+	p.tags[repo] = tags
+	return tags, nil
+}
+
+// Execute deletes images listed in the plan from the registry.
+// Registries delete manifests rather than tags, so the image is only deleted if all of its tags are to be deleted.
+func (plan *Plan) Execute(ctx context.Context, mirrorCtx *contexts.BaseContext) error {
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
+	p := &planner{nameOpts: nameOpts, remoteOpts: remoteOpts, tags: map[string][]string{}}
+
+	tagsToDelete := map[string][]string{}
+	for _, productPlan := range plan.Products {
+		for _, ref := range productPlan.Delete {
+			repo, tag := splitTag(ref)
+			tagsToDelete[repo] = append(tagsToDelete[repo], tag)
+		}
+	}
+
+	repos := maps.Keys(tagsToDelete)
+	slices.Sort(repos)
+	for _, repo := range repos {
+		if err := p.deleteTags(mirrorCtx.Logger, repo, tagsToDelete[repo]); err != nil {
+			return fmt.Errorf("prune %s: %w", repo, err)
+		}
+	}
+	return nil
+}
+
+func (p *planner) deleteTags(logger contexts.Logger, repo string, tagsToDelete []string) error {
+	tags, err := p.listTags(repo)
+	if err != nil {
+		return err
+	}
+
+	tagsByDigest := map[v1.Hash][]string{}
+	for _, tag := range tags {
+		ref, err := name.NewTag(repo+":"+tag, p.nameOpts...)
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(ref, p.remoteOpts...)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", ref, err)
+		}
+		tagsByDigest[desc.Digest] = append(tagsByDigest[desc.Digest], tag)
+	}
+
+	digests := maps.Keys(tagsByDigest)
+	slices.SortFunc(digests, func(a, b v1.Hash) int { return strings.Compare(a.String(), b.String()) })
+	for _, digest := range digests {
+		digestTags := tagsByDigest[digest]
+		deletedTags := 0
+		for _, tag := range digestTags {
+			if slices.Contains(tagsToDelete, tag) {
+				deletedTags++
+			}
+		}
+		switch {
+		case deletedTags == 0:
+			continue
+		case deletedTags != len(digestTags):
+			logger.WarnF("%s@%s is kept as it is also tagged as %s", repo, digest, strings.Join(digestTags, ", "))
+			continue
+		}
+
+		ref, err := name.NewDigest(repo+"@"+digest.String(), p.nameOpts...)
+		if err != nil {
+			return err
+		}
+		if err = remote.Delete(ref, p.remoteOpts...); err != nil {
+			return fmt.Errorf("delete %s: %w", ref, err)
+		}
+		logger.InfoF("Deleted %s (%s)", ref, strings.Join(digestTags, ", "))
+	}
+	return nil
+}
+
+func splitTag(ref string) (repo, tag string) {
+	splitIndex := strings.LastIndex(ref, ":")
+	return ref[:splitIndex], ref[splitIndex+1:]
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+	mirrorTestUtils "github.com/deckhouse/deckhouse-cli/testing/util/mirror"
+)
+
+func TestPrunePlatformAndModules(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	usedComponent, unusedComponent := randomImage(t), randomImage(t)
+	pushPlatformRelease(t, repo, "v1.60.0", unusedComponent)
+	pushPlatformRelease(t, repo, "v1.61.0", usedComponent)
+	pushPlatformRelease(t, repo, "v1.62.0", usedComponent)
+	tagImage(t, repo+"/release-channel:stable", releaseImage(t, "v1.61.0", nil))
+	tagImage(t, repo+"/release-channel:alpha", releaseImage(t, "v1.62.0", nil))
+
+	tagImage(t, repo+"/modules:console", randomImage(t))
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		tagImage(t, repo+"/modules/console:"+version, releaseImage(t, version, map[string]string{"images_digests.json": "{}"}))
+		tagImage(t, repo+"/modules/console/release:"+version, releaseImage(t, version, nil))
+	}
+	tagImage(t, repo+"/modules/console/release:stable", releaseImage(t, "v1.1.0", nil))
+
+	plan, err := MakePlan(context.Background(), mirrorCtx, Options{})
+	require.NoError(t, err)
+	require.Len(t, plan.Products, 2)
+
+	platform := plan.Products[0]
+	require.Empty(t, platform.Warnings)
+	require.Equal(t, map[string]string{"stable": "v1.61.0", "alpha": "v1.62.0"}, platform.Channels)
+	require.Equal(t, []string{"v1.62.0", "v1.61.0"}, platform.KeptVersions)
+	unusedComponentDigest, err := unusedComponent.Digest()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		repo + ":v1.60.0",
+		repo + "/install:v1.60.0",
+		repo + "/release-channel:v1.60.0",
+		repo + ":" + unusedComponentDigest.Hex,
+	}, platform.Delete)
+
+	module := plan.Products[1]
+	require.Equal(t, "Module console", module.Name)
+	require.Equal(t, []string{"v1.1.0"}, module.KeptVersions)
+	require.ElementsMatch(t, []string{
+		repo + "/modules/console:v1.0.0",
+		repo + "/modules/console/release:v1.0.0",
+	}, module.Delete)
+
+	require.NoError(t, plan.Execute(context.Background(), mirrorCtx))
+	requireDeleted(t, repo, unusedComponentDigest)
+	usedComponentDigest, err := usedComponent.Digest()
+	require.NoError(t, err)
+	_, err = remote.Head(parseReference(t, repo+"@"+usedComponentDigest.String()))
+	require.NoError(t, err, "Component image used by kept versions should not be deleted")
+}
+
+func TestPruneKeepsOlderVersions(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	component := randomImage(t)
+	for _, version := range []string{"v1.59.0", "v1.60.0", "v1.61.0"} {
+		pushPlatformRelease(t, repo, version, component)
+	}
+	tagImage(t, repo+"/release-channel:stable", releaseImage(t, "v1.61.0", nil))
+
+	plan, err := MakePlan(context.Background(), mirrorCtx, Options{KeepOlderVersions: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.61.0", "v1.60.0"}, plan.Products[0].KeptVersions)
+	require.ElementsMatch(t, []string{
+		repo + ":v1.59.0",
+		repo + "/install:v1.59.0",
+		repo + "/release-channel:v1.59.0",
+	}, plan.Products[0].Delete)
+}
+
+func TestPruneDoesNothingWithoutReleaseChannels(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+	pushPlatformRelease(t, repo, "v1.61.0", randomImage(t))
+
+	plan, err := MakePlan(context.Background(), mirrorCtx, Options{})
+	require.NoError(t, err)
+	require.Empty(t, plan.Products[0].Delete)
+	require.NotEmpty(t, plan.Products[0].Warnings)
+}
+
+func TestPruneMatchesVersionTagsBySemver(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+
+	component := randomImage(t)
+	pushPlatformRelease(t, repo, "1.59.0", component)
+	pushPlatformRelease(t, repo, "v1.60", component)
+	pushPlatformRelease(t, repo, "1.61.1", component)
+	tagImage(t, repo+"/release-channel:stable", releaseImage(t, "v1.60.0", nil))
+
+	plan, err := MakePlan(context.Background(), mirrorCtx, Options{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.61.1", "v1.60.0"}, plan.Products[0].KeptVersions)
+	require.ElementsMatch(t, []string{
+		repo + ":1.59.0",
+		repo + "/install:1.59.0",
+		repo + "/release-channel:1.59.0",
+	}, plan.Products[0].Delete)
+}
+
+func TestPruneFailsOnUnreadableReleaseChannel(t *testing.T) {
+	mirrorCtx, repo := setupRegistry(t)
+	pushPlatformRelease(t, repo, "v1.61.0", randomImage(t))
+	tagImage(t, repo+"/release-channel:stable", randomImage(t))
+
+	_, err := MakePlan(context.Background(), mirrorCtx, Options{})
+	require.ErrorContains(t, err, "read release channel stable")
+}
+
+func setupRegistry(t *testing.T) (*contexts.BaseContext, string) {
+	t.Helper()
+	host, repoPath, _ := mirrorTestUtils.SetupEmptyRegistryRepo(false)
+	return &contexts.BaseContext{
+		RegistryHost: host,
+		RegistryPath: repoPath,
+		Insecure:     true,
+		Logger:       log.NewSLogger(slog.LevelWarn),
+	}, host + repoPath
+}
+
+// pushPlatformRelease pushes images of the Deckhouse release the same way d8 mirror push does.
+func pushPlatformRelease(t *testing.T, repo, version string, component v1.Image) {
+	t.Helper()
+
+	componentDigest, err := component.Digest()
+	require.NoError(t, err)
+	tagImage(t, repo+":"+componentDigest.Hex, component)
+	tagImage(t, repo+":"+version, randomImage(t))
+	tagImage(t, repo+"/install:"+version, releaseImage(t, version, map[string]string{
+		"deckhouse/candi/images_digests.json": fmt.Sprintf(`{"component":%q}`, componentDigest),
+	}))
+	tagImage(t, repo+"/release-channel:"+version, releaseImage(t, version, nil))
+}
+
+func releaseImage(t *testing.T, version string, files map[string]string) v1.Image {
+	t.Helper()
+
+	layerFiles := map[string][]byte{"version.json": []byte(fmt.Sprintf(`{"version":%q}`, version))}
+	for fileName, content := range files {
+		layerFiles[fileName] = []byte(content)
+	}
+	l, err := crane.Layer(layerFiles)
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, l)
+	require.NoError(t, err)
+	return img
+}
+
+func randomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	return img
+}
+
+func tagImage(t *testing.T, ref string, img v1.Image) {
+	t.Helper()
+	require.NoError(t, remote.Write(parseReference(t, ref), img))
+}
+
+func requireDeleted(t *testing.T, repo string, digest v1.Hash) {
+	t.Helper()
+	_, err := remote.Head(parseReference(t, repo+"@"+digest.String()))
+	require.Error(t, err, "%s@%s should be deleted", repo, digest)
+}
+
+func parseReference(t *testing.T, ref string) name.Reference {
+	t.Helper()
+	parsed, err := name.ParseReference(ref, name.Insecure)
+	require.NoError(t, err)
+	return parsed
+}
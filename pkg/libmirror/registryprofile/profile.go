@@ -0,0 +1,398 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryprofile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+)
+
+type Kind string
+
+const (
+	Generic Kind = "generic"
+	Harbor  Kind = "harbor"
+	Quay    Kind = "quay"
+	Nexus   Kind = "nexus"
+	GitLab  Kind = "gitlab"
+)
+
+// deckhouseRepoDepth is the number of path levels Deckhouse repositories take under the registry path,
+// the deepest one is modules/<name>/release.
+const deckhouseRepoDepth = 3
+
+// Profile describes known limits of the registry implementation.
+type Profile struct {
+	Kind Kind
+	// Maximum number of path levels under the top-level namespace, 0 if not limited.
+	MaxRepoDepth int
+	// Registry has to be configured to accept media types of security databases artifacts.
+	RestrictsArtifactMediaTypes bool
+}
+
+var profiles = map[Kind]Profile{
+	Generic: {Kind: Generic},
+	Harbor:  {Kind: Harbor},
+	Quay:    {Kind: Quay, RestrictsArtifactMediaTypes: true},
+	Nexus:   {Kind: Nexus},
+	// GitLab allows 3 levels of image names under the project path. Project path is assumed to be group/project,
+	// projects in nested groups are reported as too deep.
+	GitLab: {Kind: GitLab, MaxRepoDepth: 2 + deckhouseRepoDepth},
+}
+
+type Finding struct {
+	// Fatal findings mean that push will fail.
+	Fatal   bool
+	Message string
+}
+
+type Result struct {
+	Profile  Profile
+	Findings []Finding
+	// Whether release channels tags can be overwritten, as told by the registry-specific settings.
+	// Empty if the registry does not tell it.
+	TagOverwrite auth.Permission
+}
+
+func (r *Result) Fatal() []Finding {
+	fatal := make([]Finding, 0)
+	for _, finding := range r.Findings {
+		if finding.Fatal {
+			fatal = append(fatal, finding)
+		}
+	}
+	return fatal
+}
+
+func (r *Result) addFinding(fatal bool, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Fatal: fatal, Message: fmt.Sprintf(format, args...)})
+}
+
+// Probe detects the type of registry at mirrorCtx.RegistryHost and checks that Deckhouse can be pushed under mirrorCtx.RegistryPath.
+func Probe(ctx context.Context, mirrorCtx *contexts.BaseContext) (*Result, error) {
+	p, err := newAPIClient(ctx, mirrorCtx)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := p.detect()
+	if err != nil {
+		return nil, fmt.Errorf("Detect registry type: %w", err)
+	}
+
+	result := &Result{Profile: profiles[kind]}
+	repoPath := strings.Split(strings.Trim(mirrorCtx.RegistryPath, "/"), "/")
+	if maxDepth := result.Profile.MaxRepoDepth; maxDepth > 0 && len(repoPath)+deckhouseRepoDepth > maxDepth {
+		result.addFinding(true,
+			"%s allows at most %d path levels in repository names, but Deckhouse needs %d levels under %s. "+
+				"Use the shorter registry path, for example the path of the project itself.",
+			kind, maxDepth, len(repoPath)+deckhouseRepoDepth, mirrorCtx.RegistryPath)
+	}
+
+	switch kind {
+	case Harbor:
+		err = p.checkHarbor(result, repoPath[0], strings.Join(repoPath[1:], "/"))
+	case Quay:
+		err = p.checkQuay(result, repoPath[0])
+	case Nexus:
+		result.addFinding(false,
+			"Release channels tags are overwritten by every push. "+
+				"Make sure that deployment policy of the Nexus Docker repository allows redeploy.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// apiClient sends requests to the product-specific APIs of the registry.
+type apiClient struct {
+	ctx     context.Context
+	client  *http.Client
+	baseURL url.URL
+	auth    authn.Authenticator
+}
+
+func newAPIClient(ctx context.Context, mirrorCtx *contexts.BaseContext) (*apiClient, error) {
+	nameOpts, _ := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
+	registry, err := name.NewRegistry(mirrorCtx.RegistryHost, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("Parse registry address: %w", err)
+	}
+
+	return &apiClient{
+		ctx:     ctx,
+		client:  &http.Client{Transport: auth.MakeTransport(mirrorCtx.SkipTLSVerification)},
+		baseURL: url.URL{Scheme: registry.Scheme(), Host: registry.RegistryStr()},
+		auth:    mirrorCtx.RegistryAuth,
+	}, nil
+}
+
+// detect finds out the registry type by its product-specific API endpoints and headers.
+func (p *apiClient) detect() (Kind, error) {
+	resp, err := p.get("/v2/", false)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if strings.HasPrefix(resp.Header.Get("Server"), "Nexus") {
+		return Nexus, nil
+	}
+	if challenge := resp.Header.Get("WWW-Authenticate"); strings.Contains(challenge, "/jwt/auth") {
+		return GitLab, nil
+	}
+
+	probes := []struct {
+		kind Kind
+		path string
+	}{
+		{Harbor, "/api/v2.0/systeminfo"},
+		{Quay, "/api/v1/discovery"},
+		{Nexus, "/service/rest/v1/status"},
+	}
+	for _, probe := range probes {
+		resp, err = p.get(probe.path, false)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return probe.kind, nil
+		}
+	}
+	return Generic, nil
+}
+
+// checkHarbor checks that the project exists and that its tag immutability rules do not protect release channels tags.
+// Repository is the path of Deckhouse repository inside the project.
+func (p *apiClient) checkHarbor(result *Result, project, repository string) error {
+	exists, err := p.harborProjectExists(project)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		result.addFinding(true, "Harbor project %q does not exist. Harbor does not create projects on push, create it in advance or let d8 provision it.", project)
+		return nil
+	}
+
+	var rules []harborImmutableRule
+	// Rules can only be read by project members, nothing is reported if they are not readable.
+	readable, err := p.getJSON("/api/v2.0/projects/"+url.PathEscape(project)+"/immutabletagrules", &rules)
+	if err != nil || !readable {
+		return err
+	}
+
+	result.TagOverwrite = auth.PermissionAllowed
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		if rule.protectsReleaseChannels(repository) {
+			result.TagOverwrite = auth.PermissionDenied
+			result.addFinding(false,
+				"Harbor project %q has tag immutability rule %d that matches release channels tags. "+
+					"Release channels tags are overwritten by every push, exclude them from the rule.", project, rule.ID)
+			return nil
+		}
+		// Rules that protect other tags or repositories may still match tags of modules releases.
+		result.TagOverwrite = ""
+	}
+	if result.TagOverwrite == "" {
+		result.addFinding(false,
+			"Harbor project %q has tag immutability rules. "+
+				"Release channels tags are overwritten by every push, make sure the rules do not match them.", project)
+	}
+	return nil
+}
+
+// releaseChannels are the tags that are overwritten by every push.
+var releaseChannels = []string{"alpha", "beta", "early-access", "stable", "rock-solid"}
+
+type harborImmutableRule struct {
+	ID             int                         `json:"id"`
+	Disabled       bool                        `json:"disabled"`
+	TagSelectors   []harborSelector            `json:"tag_selectors"`
+	ScopeSelectors map[string][]harborSelector `json:"scope_selectors"`
+}
+
+type harborSelector struct {
+	Kind       string `json:"kind"`
+	Decoration string `json:"decoration"`
+	Pattern    string `json:"pattern"`
+}
+
+// protectsReleaseChannels reports whether the rule makes any release channel tag of Deckhouse immutable.
+// Repository is the path of Deckhouse repository inside the project, release channels are tagged in it
+// and in its release-channel repository.
+func (r *harborImmutableRule) protectsReleaseChannels(repository string) bool {
+	for _, repo := range []string{repository, path.Join(repository, "release-channel")} {
+		if !harborSelectorsMatch(r.ScopeSelectors["repository"], repo) {
+			continue
+		}
+		for _, channel := range releaseChannels {
+			if harborSelectorsMatch(r.TagSelectors, channel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// harborSelectorsMatch reports whether value is matched by all selectors, rule without selectors matches everything.
+func harborSelectorsMatch(selectors []harborSelector, value string) bool {
+	for _, selector := range selectors {
+		// Only doublestar patterns are supported by Harbor.
+		matched := doublestarPattern(selector.Pattern).MatchString(value)
+		if strings.HasSuffix(strings.ToLower(selector.Decoration), "excludes") {
+			matched = !matched
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// doublestarPattern converts doublestar pattern to the regular expression: ** matches any path,
+// * and ? do not match path separators, {a,b} matches any of alternatives.
+func doublestarPattern(pattern string) *regexp.Regexp {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	inAlternatives := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '{':
+			expr.WriteString("(?:")
+			inAlternatives = true
+		case c == '}' && inAlternatives:
+			expr.WriteString(")")
+			inAlternatives = false
+		case c == ',' && inAlternatives:
+			expr.WriteString("|")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if inAlternatives {
+		// Pattern with unbalanced braces matches nothing.
+		return regexp.MustCompile(`^\b\B$`)
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+func (p *apiClient) checkQuay(result *Result, namespace string) error {
+	result.addFinding(false,
+		"Quay has to be configured to accept media types of security databases. "+
+			"Failure to push security databases is reported, but does not fail the whole push.")
+
+	for _, namespacePath := range []string{"/api/v1/organization/", "/api/v1/users/"} {
+		resp, err := p.get(namespacePath+url.PathEscape(namespace), true)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			return nil
+		}
+	}
+	result.addFinding(true, "Quay organization %q does not exist. Create it before push.", namespace)
+	return nil
+}
+
+// getJSON decodes response body into v, false is returned if the request was not successful.
+func (p *apiClient) getJSON(path string, v any) (bool, error) {
+	resp, err := p.get(path, true)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return true, nil
+}
+
+func (p *apiClient) get(path string, authorize bool) (*http.Response, error) {
+	return p.do(http.MethodGet, path, nil, authorize)
+}
+
+// do sends the request to the registry API, body is encoded as JSON if not nil.
+func (p *apiClient) do(method, path string, body any, authorize bool) (*http.Response, error) {
+	reqURL, err := p.baseURL.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := io.Reader(http.NoBody)
+	if body != nil {
+		rawBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(rawBody)
+	}
+	req, err := http.NewRequestWithContext(p.ctx, method, reqURL.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorize && p.auth != nil && p.auth != authn.Anonymous {
+		authConfig, err := p.auth.Authorization()
+		if err != nil {
+			return nil, fmt.Errorf("get registry credentials: %w", err)
+		}
+		if authConfig.Username != "" {
+			req.SetBasicAuth(authConfig.Username, authConfig.Password)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Responses are only used for their status and small JSON documents, drop the rest.
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, 1<<20), resp.Body}
+	return resp, nil
+}
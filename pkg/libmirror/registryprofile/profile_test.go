@@ -0,0 +1,226 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryprofile
+
+import (
+	"context"
+	"io"
+	golog "log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+func TestProbeCompatibilityMatrix(t *testing.T) {
+	tests := []struct {
+		name         string
+		registryPath string
+		// Registry-specific endpoints served in addition to the distribution API.
+		endpoints     map[string]http.HandlerFunc
+		expectedKind  Kind
+		fatalFindings int
+		findings      int
+		// Tag overwrite permission told by the registry settings, empty if not told.
+		tagOverwrite auth.Permission
+	}{
+		{
+			name:         "generic registry",
+			registryPath: "/deckhouse/ee",
+			expectedKind: Generic,
+		},
+		{
+			name:         "harbor with existing project and immutable tags",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v2.0/systeminfo":                           jsonResponse(`{"harbor_version":"v2.10.0"}`),
+				"/api/v2.0/projects":                             jsonResponse(`[]`),
+				"/api/v2.0/projects/deckhouse/immutabletagrules": jsonResponse(`[{"id":1,"disabled":false}]`),
+			},
+			expectedKind: Harbor,
+			findings:     1,
+			tagOverwrite: auth.PermissionDenied,
+		},
+		{
+			name:         "harbor with immutable release channels tags",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v2.0/systeminfo": jsonResponse(`{"harbor_version":"v2.10.0"}`),
+				"/api/v2.0/projects":   jsonResponse(`[]`),
+				"/api/v2.0/projects/deckhouse/immutabletagrules": jsonResponse(`[{
+					"id": 1,
+					"disabled": false,
+					"tag_selectors": [{"kind": "doublestar", "decoration": "matches", "pattern": "{alpha,stable}"}],
+					"scope_selectors": {"repository": [{"kind": "doublestar", "decoration": "repoMatches", "pattern": "ee/**"}]}
+				}]`),
+			},
+			expectedKind: Harbor,
+			findings:     1,
+			tagOverwrite: auth.PermissionDenied,
+		},
+		{
+			name:         "harbor with immutable rules for other tags",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v2.0/systeminfo": jsonResponse(`{"harbor_version":"v2.10.0"}`),
+				"/api/v2.0/projects":   jsonResponse(`[]`),
+				"/api/v2.0/projects/deckhouse/immutabletagrules": jsonResponse(`[{
+					"id": 1,
+					"disabled": false,
+					"tag_selectors": [{"kind": "doublestar", "decoration": "excludes", "pattern": "{alpha,beta,early-access,stable,rock-solid}"}],
+					"scope_selectors": {"repository": [{"kind": "doublestar", "decoration": "repoMatches", "pattern": "**"}]}
+				}, {
+					"id": 2,
+					"disabled": false,
+					"tag_selectors": [{"kind": "doublestar", "decoration": "matches", "pattern": "**"}],
+					"scope_selectors": {"repository": [{"kind": "doublestar", "decoration": "repoMatches", "pattern": "ce/*"}]}
+				}]`),
+			},
+			expectedKind: Harbor,
+			findings:     1,
+		},
+		{
+			name:         "harbor without immutable rules",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v2.0/systeminfo":                           jsonResponse(`{"harbor_version":"v2.10.0"}`),
+				"/api/v2.0/projects":                             jsonResponse(`[]`),
+				"/api/v2.0/projects/deckhouse/immutabletagrules": jsonResponse(`[{"id":1,"disabled":true}]`),
+			},
+			expectedKind: Harbor,
+			tagOverwrite: auth.PermissionAllowed,
+		},
+		{
+			name:         "harbor without project",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v2.0/systeminfo": jsonResponse(`{"harbor_version":"v2.10.0"}`),
+				"/api/v2.0/projects":   http.NotFound,
+			},
+			expectedKind:  Harbor,
+			fatalFindings: 1,
+			findings:      1,
+		},
+		{
+			name:         "quay with organization",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v1/discovery":              jsonResponse(`{}`),
+				"/api/v1/organization/deckhouse": jsonResponse(`{"name":"deckhouse"}`),
+			},
+			expectedKind: Quay,
+			findings:     1,
+		},
+		{
+			name:         "quay without organization",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/api/v1/discovery": jsonResponse(`{}`),
+			},
+			expectedKind:  Quay,
+			fatalFindings: 1,
+			findings:      2,
+		},
+		{
+			name:         "nexus",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/v2/": func(w http.ResponseWriter, _ *http.Request) {
+					w.Header().Set("Server", "Nexus/3.68.1-02 (OSS)")
+					w.WriteHeader(http.StatusOK)
+				},
+			},
+			expectedKind: Nexus,
+			findings:     1,
+		},
+		{
+			name:         "gitlab project",
+			registryPath: "/deckhouse/ee",
+			endpoints: map[string]http.HandlerFunc{
+				"/v2/": gitlabChallenge,
+			},
+			expectedKind: GitLab,
+		},
+		{
+			name:         "gitlab repository too deep",
+			registryPath: "/deckhouse/ee/mirror",
+			endpoints: map[string]http.HandlerFunc{
+				"/v2/": gitlabChallenge,
+			},
+			expectedKind:  GitLab,
+			fatalFindings: 1,
+			findings:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := setupStandIn(t, tt.endpoints)
+			result, err := Probe(context.Background(), &contexts.BaseContext{
+				RegistryHost: host,
+				RegistryPath: tt.registryPath,
+				Insecure:     true,
+				Logger:       log.NewSLogger(slog.LevelWarn),
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedKind, result.Profile.Kind)
+			require.Len(t, result.Findings, tt.findings, result.Findings)
+			require.Len(t, result.Fatal(), tt.fatalFindings, result.Findings)
+			require.Equal(t, tt.tagOverwrite, result.TagOverwrite)
+		})
+	}
+}
+
+// setupStandIn starts the registry that serves given endpoints in front of the distribution API.
+func setupStandIn(t *testing.T, endpoints map[string]http.HandlerFunc) string {
+	t.Helper()
+
+	registryHandler := registry.New(registry.Logger(golog.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler, found := endpoints[r.URL.Path]; found {
+			handler(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/service/") {
+			http.NotFound(w, r)
+			return
+		}
+		registryHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func jsonResponse(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func gitlabChallenge(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="https://gitlab.example.com/jwt/auth",service="container_registry"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
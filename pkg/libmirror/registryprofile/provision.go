@@ -0,0 +1,157 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryprofile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+)
+
+// ProvisionOptions configure the project or repository created for Deckhouse.
+type ProvisionOptions struct {
+	// Images can be pulled without credentials.
+	Public bool
+	// Storage quota in bytes, 0 means no quota. Only Harbor supports quotas.
+	StorageLimit int64
+	// Blob store for the Nexus repository, "default" if empty.
+	NexusBlobStore string
+	// Port of the HTTP connector Nexus serves the repository on. Nexus serves Docker repositories only
+	// through connectors, without the port the connector has to be configured by hand.
+	NexusHTTPPort int
+}
+
+// Provision creates the Harbor project or the Nexus hosted Docker repository named after the first level of mirrorCtx.RegistryPath
+// through the management API of the registry. Registry credentials must allow to manage projects or repositories.
+// False is returned if the project or repository already exists.
+func Provision(ctx context.Context, mirrorCtx *contexts.BaseContext, kind Kind, opts ProvisionOptions) (bool, error) {
+	p, err := newAPIClient(ctx, mirrorCtx)
+	if err != nil {
+		return false, err
+	}
+	namespace := strings.Split(strings.Trim(mirrorCtx.RegistryPath, "/"), "/")[0]
+
+	switch kind {
+	case Harbor:
+		return p.provisionHarborProject(namespace, opts)
+	case Nexus:
+		return p.provisionNexusRepository(namespace, opts)
+	default:
+		return false, fmt.Errorf("provisioning is not supported for %s registries", kind)
+	}
+}
+
+func (p *apiClient) harborProjectExists(project string) (bool, error) {
+	resp, err := p.do(http.MethodHead, "/api/v2.0/projects?project_name="+url.QueryEscape(project), nil, true)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound, nil
+}
+
+func (p *apiClient) provisionHarborProject(project string, opts ProvisionOptions) (bool, error) {
+	exists, err := p.harborProjectExists(project)
+	if err != nil || exists {
+		return false, err
+	}
+
+	storageLimit := int64(-1)
+	if opts.StorageLimit > 0 {
+		storageLimit = opts.StorageLimit
+	}
+	resp, err := p.do(http.MethodPost, "/api/v2.0/projects", map[string]any{
+		"project_name":  project,
+		"metadata":      map[string]string{"public": strconv.FormatBool(opts.Public)},
+		"storage_limit": storageLimit,
+	}, true)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, fmt.Errorf("create Harbor project %q: %w", project, unexpectedResponse(resp))
+	}
+}
+
+func (p *apiClient) provisionNexusRepository(repository string, opts ProvisionOptions) (bool, error) {
+	if opts.StorageLimit > 0 {
+		return false, fmt.Errorf("Nexus does not support quotas for repositories, configure quota of the blob store instead")
+	}
+
+	repositoryPath := "/service/rest/v1/repositories/docker/hosted/" + url.PathEscape(repository)
+	resp, err := p.get(repositoryPath, true)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	blobStore := opts.NexusBlobStore
+	if blobStore == "" {
+		blobStore = "default"
+	}
+	dockerSettings := map[string]any{
+		"v1Enabled":      false,
+		"forceBasicAuth": !opts.Public,
+	}
+	if opts.NexusHTTPPort > 0 {
+		dockerSettings["httpPort"] = opts.NexusHTTPPort
+	}
+	resp, err = p.do(http.MethodPost, "/service/rest/v1/repositories/docker/hosted", map[string]any{
+		"name":   repository,
+		"online": true,
+		"storage": map[string]any{
+			"blobStoreName":               blobStore,
+			"strictContentTypeValidation": true,
+			// Release channels tags are overwritten by every push.
+			"writePolicy": "allow",
+		},
+		"docker": dockerSettings,
+	}, true)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return false, fmt.Errorf("create Nexus repository %q: %w", repository, unexpectedResponse(resp))
+	}
+	return true, nil
+}
+
+func unexpectedResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if len(body) == 0 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryprofile
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+func TestProvisionHarborProject(t *testing.T) {
+	api := &fakeManagementAPI{created: map[string]map[string]any{}}
+	host := setupStandIn(t, map[string]http.HandlerFunc{
+		"/api/v2.0/systeminfo": jsonResponse(`{"harbor_version":"v2.10.0"}`),
+		"/api/v2.0/projects": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				api.exists(w, r.URL.Query().Get("project_name"))
+				return
+			}
+			api.create(w, r, "project_name")
+		},
+	})
+	mirrorCtx := testContext(host)
+
+	result, err := Probe(context.Background(), mirrorCtx)
+	require.NoError(t, err)
+	require.Len(t, result.Fatal(), 1)
+
+	created, err := Provision(context.Background(), mirrorCtx, Harbor, ProvisionOptions{StorageLimit: 100 << 30})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, map[string]any{
+		"project_name":  "deckhouse",
+		"metadata":      map[string]any{"public": "false"},
+		"storage_limit": float64(100 << 30),
+	}, api.created["deckhouse"])
+
+	created, err = Provision(context.Background(), mirrorCtx, Harbor, ProvisionOptions{})
+	require.NoError(t, err)
+	require.False(t, created, "Existing project should not be created again")
+
+	result, err = Probe(context.Background(), mirrorCtx)
+	require.NoError(t, err)
+	require.Empty(t, result.Fatal())
+}
+
+func TestProvisionNexusRepository(t *testing.T) {
+	api := &fakeManagementAPI{created: map[string]map[string]any{}}
+	host := setupStandIn(t, map[string]http.HandlerFunc{
+		"/service/rest/v1/status": jsonResponse(``),
+		"/service/rest/v1/repositories/docker/hosted/deckhouse": func(w http.ResponseWriter, _ *http.Request) {
+			api.exists(w, "deckhouse")
+		},
+		"/service/rest/v1/repositories/docker/hosted": func(w http.ResponseWriter, r *http.Request) {
+			api.create(w, r, "name")
+		},
+	})
+	mirrorCtx := testContext(host)
+
+	_, err := Provision(context.Background(), mirrorCtx, Nexus, ProvisionOptions{StorageLimit: 1 << 30})
+	require.Error(t, err, "Nexus repositories have no quotas")
+
+	created, err := Provision(context.Background(), mirrorCtx, Nexus, ProvisionOptions{Public: true})
+	require.NoError(t, err)
+	require.True(t, created)
+	repository := api.created["deckhouse"]
+	require.Equal(t, "default", repository["storage"].(map[string]any)["blobStoreName"])
+	require.Equal(t, "allow", repository["storage"].(map[string]any)["writePolicy"])
+	require.Equal(t, false, repository["docker"].(map[string]any)["forceBasicAuth"])
+	require.NotContains(t, repository["docker"], "httpPort")
+
+	delete(api.created, "deckhouse")
+	created, err = Provision(context.Background(), mirrorCtx, Nexus, ProvisionOptions{NexusHTTPPort: 8082})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, float64(8082), api.created["deckhouse"]["docker"].(map[string]any)["httpPort"])
+
+	created, err = Provision(context.Background(), mirrorCtx, Nexus, ProvisionOptions{})
+	require.NoError(t, err)
+	require.False(t, created, "Existing repository should not be created again")
+}
+
+func TestProvisionUnsupportedRegistry(t *testing.T) {
+	host := setupStandIn(t, nil)
+	_, err := Provision(context.Background(), testContext(host), Generic, ProvisionOptions{})
+	require.Error(t, err)
+}
+
+// fakeManagementAPI keeps created projects or repositories by names.
+type fakeManagementAPI struct {
+	mu      sync.Mutex
+	created map[string]map[string]any
+}
+
+func (api *fakeManagementAPI) exists(w http.ResponseWriter, name string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if _, found := api.created[name]; !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *fakeManagementAPI) create(w http.ResponseWriter, r *http.Request, nameField string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	name, _ := body[nameField].(string)
+	if _, found := api.created[name]; found {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	api.created[name] = body
+	w.WriteHeader(http.StatusCreated)
+}
+
+func testContext(host string) *contexts.BaseContext {
+	return &contexts.BaseContext{
+		RegistryHost: host,
+		RegistryPath: "/deckhouse/ee",
+		Insecure:     true,
+		Logger:       log.NewSLogger(slog.LevelWarn),
+	}
+}
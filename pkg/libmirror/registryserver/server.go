@@ -0,0 +1,338 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryserver
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	golog "log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+)
+
+// Options configure the registry served from the bundle.
+type Options struct {
+	// RepoPath is the path of the repo the bundle is served at, like "/deckhouse/ee".
+	// Images of layouts are served at the same repository paths they would be pushed to by d8 mirror push.
+	RepoPath string
+	// Username and Password enable basic authentication if set.
+	Username string
+	Password string
+
+	Logger contexts.Logger
+}
+
+// Server is a read-only OCI Distribution registry backed by the bundle layouts.
+// Manifests are loaded into memory when the server is created, blobs are read from the bundle on request.
+type Server struct {
+	opts      Options
+	bundleFS  *bundle.FS
+	manifests http.Handler
+
+	// Layouts holding blobs of every repository.
+	repos map[string]bundle.Layout
+	// Blobs of images that are not stored in the bundle, like module index tags.
+	extraBlobs map[string]map[v1.Hash][]byte
+}
+
+// New creates the registry server for the bundle.
+func New(bundleFS *bundle.FS, opts Options) (*Server, error) {
+	s := &Server{
+		opts:       opts,
+		bundleFS:   bundleFS,
+		manifests:  registry.New(registry.Logger(golog.New(io.Discard, "", 0))),
+		repos:      map[string]bundle.Layout{},
+		extraBlobs: map[string]map[v1.Hash][]byte{},
+	}
+
+	layoutPaths, err := bundle.FindLayouts(bundleFS)
+	if err != nil {
+		return nil, err
+	}
+	if len(layoutPaths) == 0 {
+		return nil, errors.New("no OCI Image Layouts found in bundle")
+	}
+
+	modules := make([]string, 0)
+	for _, layoutPath := range layoutPaths {
+		repo := path.Join(strings.Trim(opts.RepoPath, "/"), layoutPath)
+		l := bundle.NewLayout(bundleFS, layoutPath)
+		if err = s.loadLayout(repo, l); err != nil {
+			return nil, fmt.Errorf("load %s: %w", layoutPath, err)
+		}
+		s.repos[repo] = l
+
+		if parts := strings.Split(layoutPath, "/"); len(parts) == 2 && parts[0] == "modules" {
+			modules = append(modules, parts[1])
+		}
+	}
+
+	// Modules are discovered by the tags of the modules repo, d8 mirror push creates them the same way.
+	modulesRepo := path.Join(strings.Trim(opts.RepoPath, "/"), "modules")
+	for _, moduleName := range modules {
+		img, err := random.Image(32, 1)
+		if err != nil {
+			return nil, fmt.Errorf("random.Image: %w", err)
+		}
+		if err = s.addExtraImage(modulesRepo, moduleName, img); err != nil {
+			return nil, fmt.Errorf("create module index tag: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// loadLayout registers every manifest of the layout under its digest and tagged ones under their short tags.
+func (s *Server) loadLayout(repo string, l bundle.Layout) error {
+	indexManifest, err := l.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	loaded := map[v1.Hash][]byte{}
+	for _, desc := range indexManifest.Manifests {
+		rawManifest, err := s.loadManifest(repo, l, desc, loaded)
+		if err != nil {
+			return fmt.Errorf("load manifest of %s: %w", bundle.ImageReference(desc), err)
+		}
+
+		tag := desc.Annotations["io.deckhouse.image.short_tag"]
+		if tag == "" {
+			continue
+		}
+		if err = s.putManifest(repo, tag, string(desc.MediaType), rawManifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadManifest registers the manifest under its digest and returns its contents.
+// Manifests of the index are registered before the index itself, as registry does not accept indexes of unknown manifests.
+func (s *Server) loadManifest(repo string, l bundle.Layout, desc v1.Descriptor, loaded map[v1.Hash][]byte) ([]byte, error) {
+	if rawManifest, found := loaded[desc.Digest]; found {
+		return rawManifest, nil
+	}
+
+	rawManifest, err := fs.ReadFile(s.bundleFS, path.Join(l.Path, "blobs", desc.Digest.Algorithm, desc.Digest.Hex))
+	if err != nil {
+		return nil, err
+	}
+	if desc.MediaType.IsIndex() {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(rawManifest))
+		if err != nil {
+			return nil, fmt.Errorf("parse index %s: %w", desc.Digest, err)
+		}
+		for _, childDesc := range index.Manifests {
+			if _, err = s.loadManifest(repo, l, childDesc, loaded); err != nil {
+				return nil, fmt.Errorf("load manifest %s of index %s: %w", childDesc.Digest, desc.Digest, err)
+			}
+		}
+	}
+
+	if err = s.putManifest(repo, desc.Digest.String(), string(desc.MediaType), rawManifest); err != nil {
+		return nil, err
+	}
+	loaded[desc.Digest] = rawManifest
+	return rawManifest, nil
+}
+
+func (s *Server) addExtraImage(repo, tag string, img v1.Image) error {
+	blobs := map[v1.Hash][]byte{}
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		blobs[digest], err = io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	configDigest, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	if blobs[configDigest], err = img.RawConfigFile(); err != nil {
+		return err
+	}
+
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+	if err = s.putManifest(repo, tag, string(mediaType), rawManifest); err != nil {
+		return err
+	}
+
+	if s.extraBlobs[repo] == nil {
+		s.extraBlobs[repo] = map[v1.Hash][]byte{}
+	}
+	for digest, blob := range blobs {
+		s.extraBlobs[repo][digest] = blob
+	}
+	return nil
+}
+
+// putManifest stores the manifest in the in-memory manifests registry.
+func (s *Server) putManifest(repo, tag, mediaType string, rawManifest []byte) error {
+	req := httptest.NewRequest(http.MethodPut, "/v2/"+repo+"/manifests/"+tag, bytes.NewReader(rawManifest))
+	req.Header.Set("Content-Type", mediaType)
+	resp := httptest.NewRecorder()
+	s.manifests.ServeHTTP(resp, req)
+	if resp.Code != http.StatusCreated {
+		return fmt.Errorf("store manifest %s:%s: %s", repo, tag, resp.Body.String())
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.DebugF("%s %s", req.Method, req.URL)
+	}
+
+	if !s.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="d8 mirror"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "registry is read-only")
+		return
+	}
+
+	if repo, digest, isBlob := parseBlobPath(req.URL.Path); isBlob {
+		s.serveBlob(w, req, repo, digest)
+		return
+	}
+	s.manifests.ServeHTTP(w, req)
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	if s.opts.Username == "" && s.opts.Password == "" {
+		return true
+	}
+	username, password, ok := req.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.opts.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.opts.Password)) == 1
+}
+
+func (s *Server) serveBlob(w http.ResponseWriter, req *http.Request, repo, rawDigest string) {
+	digest, err := v1.NewHash(rawDigest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest.String())
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	extraBlob, found := s.extraBlobs[repo][digest]
+	if found {
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(extraBlob))
+		return
+	}
+
+	l, found := s.repos[repo]
+	if !found {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository is not known to registry")
+		return
+	}
+	blob, err := l.Blob(digest)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer blob.Close()
+
+	if seeker, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(w, req, "", time.Time{}, seeker)
+		return
+	}
+
+	size, err := l.BlobSize(digest)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, blob)
+}
+
+// parseBlobPath extracts repository and digest from /v2/<repo>/blobs/<digest> path.
+func parseBlobPath(urlPath string) (repo, digest string, isBlob bool) {
+	repoPath, found := strings.CutPrefix(urlPath, "/v2/")
+	if !found {
+		return "", "", false
+	}
+	separatorIdx := strings.LastIndex(repoPath, "/blobs/")
+	if separatorIdx == -1 {
+		return "", "", false
+	}
+	repo, digest = repoPath[:separatorIdx], repoPath[separatorIdx+len("/blobs/"):]
+	if repo == "" || digest == "" || strings.Contains(digest, "/") {
+		return "", "", false
+	}
+	return repo, digest, true
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	type regError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Errors []regError `json:"errors"`
+	}{Errors: []regError{{Code: code, Message: message}}})
+}
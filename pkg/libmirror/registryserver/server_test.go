@@ -0,0 +1,195 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registryserver
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/bundle"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+func TestServeBundle(t *testing.T) {
+	bundleDir := t.TempDir()
+	platformImage := appendImage(t, bundleDir, "registry.example.com/deckhouse/ee:v1.61.2", "v1.61.2")
+	installerImage := appendImage(t, filepath.Join(bundleDir, "install"), "registry.example.com/deckhouse/ee/install:v1.61.2", "v1.61.2")
+	moduleImage := appendImage(t, filepath.Join(bundleDir, "modules", "console"), "registry.example.com/deckhouse/ee/modules/console:v1.0.0", "v1.0.0")
+
+	bundleFS, err := bundle.OpenFS(bundleDir)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	srv, err := New(bundleFS, Options{
+		RepoPath: "/deckhouse/ee",
+		Username: "d8",
+		Password: "secret",
+		Logger:   log.NewSLogger(slog.LevelWarn),
+	})
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+	host := strings.TrimPrefix(httpServer.URL, "http://")
+
+	auth := remote.WithAuth(&authn.Basic{Username: "d8", Password: "secret"})
+	for ref, expected := range map[string]v1.Image{
+		host + "/deckhouse/ee:v1.61.2":                platformImage,
+		host + "/deckhouse/ee/install:v1.61.2":        installerImage,
+		host + "/deckhouse/ee/modules/console:v1.0.0": moduleImage,
+	} {
+		img, err := remote.Image(mustParseReference(t, ref), auth)
+		require.NoError(t, err)
+		require.NoError(t, validate.Image(img), "Image %s should be served intact", ref)
+
+		expectedDigest, err := expected.Digest()
+		require.NoError(t, err)
+		digest, err := img.Digest()
+		require.NoError(t, err)
+		require.Equal(t, expectedDigest, digest)
+	}
+
+	modulesRepo, err := name.NewRepository(host+"/deckhouse/ee/modules", name.Insecure)
+	require.NoError(t, err)
+	tags, err := remote.List(modulesRepo, auth)
+	require.NoError(t, err)
+	require.Equal(t, []string{"console"}, tags)
+	moduleTag, err := remote.Image(modulesRepo.Tag("console"), auth)
+	require.NoError(t, err)
+	require.NoError(t, validate.Image(moduleTag))
+
+	_, err = remote.Image(mustParseReference(t, host+"/deckhouse/ee:v1.61.2"))
+	require.Error(t, err, "Anonymous access should be denied")
+
+	err = remote.Write(mustParseReference(t, host+"/deckhouse/ee:v1.62.0"), randomImage(t), auth)
+	require.Error(t, err, "Registry should be read-only")
+
+	resp, err := http.Get(httpServer.URL + "/v2/deckhouse/ee/blobs/sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServeByDigest(t *testing.T) {
+	bundleDir := t.TempDir()
+	taggedImage := appendImage(t, bundleDir, "registry.example.com/deckhouse/ee:v1.61.2", "v1.61.2")
+
+	l, err := layout.FromPath(bundleDir)
+	require.NoError(t, err)
+	untaggedImage := randomImage(t)
+	untaggedDigest, err := untaggedImage.Digest()
+	require.NoError(t, err)
+	require.NoError(t, l.AppendImage(untaggedImage, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "registry.example.com/deckhouse/ee@" + untaggedDigest.String(),
+	})))
+	index, err := random.Index(256, 1, 2)
+	require.NoError(t, err)
+	indexDigest, err := index.Digest()
+	require.NoError(t, err)
+	require.NoError(t, l.AppendIndex(index, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "registry.example.com/deckhouse/ee@" + indexDigest.String(),
+	})))
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+
+	bundleFS, err := bundle.OpenFS(bundleDir)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+	srv, err := New(bundleFS, Options{RepoPath: "/deckhouse/ee"})
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+	repo := strings.TrimPrefix(httpServer.URL, "http://") + "/deckhouse/ee"
+
+	taggedDigest, err := taggedImage.Digest()
+	require.NoError(t, err)
+	for _, digest := range []v1.Hash{taggedDigest, untaggedDigest, indexManifest.Manifests[1].Digest} {
+		img, err := remote.Image(mustParseReference(t, repo+"@"+digest.String()))
+		require.NoError(t, err)
+		require.NoError(t, validate.Image(img), "Image %s should be served by digest", digest)
+	}
+
+	servedIndex, err := remote.Index(mustParseReference(t, repo+"@"+indexDigest.String()))
+	require.NoError(t, err)
+	require.NoError(t, validate.Index(servedIndex), "Index should be served by digest along with its manifests")
+}
+
+func TestServeReportsUnknownBlob(t *testing.T) {
+	bundleDir := t.TempDir()
+	appendImage(t, bundleDir, "registry.example.com/deckhouse/ee:v1.61.2", "v1.61.2")
+	bundleFS, err := bundle.OpenFS(bundleDir)
+	require.NoError(t, err)
+	defer bundleFS.Close()
+
+	srv, err := New(bundleFS, Options{RepoPath: "/deckhouse/ee"})
+	require.NoError(t, err)
+
+	for url, expectedStatus := range map[string]int{
+		"/v2/deckhouse/ee/blobs/sha256:0000000000000000000000000000000000000000000000000000000000000000": http.StatusNotFound,
+		"/v2/deckhouse/ce/blobs/sha256:0000000000000000000000000000000000000000000000000000000000000000": http.StatusNotFound,
+		"/v2/deckhouse/ee/blobs/not-a-digest": http.StatusBadRequest,
+		"/v2/deckhouse/ee/manifests/v1.61.3":  http.StatusNotFound,
+	} {
+		resp := httptest.NewRecorder()
+		srv.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, url, nil))
+		require.Equal(t, expectedStatus, resp.Code, url)
+	}
+}
+
+func appendImage(t *testing.T, layoutPath, ref, tag string) v1.Image {
+	t.Helper()
+
+	l, err := layout.FromPath(layoutPath)
+	if err != nil {
+		l, err = layout.Write(layoutPath, empty.Index)
+		require.NoError(t, err)
+	}
+
+	img := randomImage(t)
+	require.NoError(t, l.AppendImage(img, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": ref,
+		"io.deckhouse.image.short_tag":      tag,
+	})))
+	return img
+}
+
+func randomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(512, 2)
+	require.NoError(t, err)
+	return img
+}
+
+func mustParseReference(t *testing.T, ref string) name.Reference {
+	t.Helper()
+	parsed, err := name.ParseReference(ref, name.Insecure)
+	require.NoError(t, err)
+	return parsed
+}
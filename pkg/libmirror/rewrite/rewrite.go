@@ -0,0 +1,169 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+)
+
+// ErrConflict is returned if rules map different repositories to the same one.
+var ErrConflict = errors.New("rewrite rules map different repositories to the same one")
+
+// Rules map repositories Deckhouse is pushed to by default, like registry.example.com/deckhouse/ee/modules/console,
+// to the repositories it should be pushed to instead. The first matching rule is applied.
+//
+// Rules are loaded from the file like:
+//
+//	rules:
+//	  - prefix: registry.example.com/deckhouse/ee/modules
+//	    replacement: registry.example.com/deckhouse-modules
+//	  - regex: ^registry\.example\.com/deckhouse/ee/security/(.+)$
+//	    replacement: registry.example.com/deckhouse/security-$1
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	// Prefix matches the repository itself and all repositories nested in it.
+	Prefix string `json:"prefix,omitempty"`
+	// Regex is replaced with Replacement in the repository, $1 and so on expand to submatches.
+	Regex       string `json:"regex,omitempty"`
+	Replacement string `json:"replacement"`
+
+	re *regexp.Regexp
+}
+
+func Load(rulesPath string) (*Rules, error) {
+	data, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("read rewrite rules: %w", err)
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Rules, error) {
+	rules := &Rules{}
+	if err := yaml.UnmarshalStrict(data, rules); err != nil {
+		return nil, fmt.Errorf("parse rewrite rules: %w", err)
+	}
+
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		switch {
+		case rule.Prefix != "" && rule.Regex != "":
+			return nil, fmt.Errorf("rule %d: prefix and regex can not be used together", i+1)
+		case rule.Prefix == "" && rule.Regex == "":
+			return nil, fmt.Errorf("rule %d: either prefix or regex is required", i+1)
+		case rule.Replacement == "":
+			return nil, fmt.Errorf("rule %d: replacement is required", i+1)
+		}
+
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			rule.re = re
+		}
+		rule.Prefix = strings.TrimSuffix(rule.Prefix, "/")
+		rule.Replacement = strings.TrimSuffix(rule.Replacement, "/")
+	}
+	return rules, nil
+}
+
+// Repo returns the repository images of repo should be pushed to. Nil rules leave repo as is.
+func (r *Rules) Repo(repo string) string {
+	if r == nil {
+		return repo
+	}
+
+	for _, rule := range r.Rules {
+		switch {
+		case rule.re != nil && rule.re.MatchString(repo):
+			return rule.re.ReplaceAllString(repo, rule.Replacement)
+		case rule.Prefix != "" && (repo == rule.Prefix || strings.HasPrefix(repo, rule.Prefix+"/")):
+			return rule.Replacement + strings.TrimPrefix(repo, rule.Prefix)
+		}
+	}
+	return repo
+}
+
+// platformRepos are the repositories Deckhouse reads from the images repo of the cluster by their fixed paths.
+// Of the security artifacts only the default ones are read by Deckhouse.
+var platformRepos = append(
+	[]string{"install", "install-standalone", "release-channel"},
+	lo.Map(security.DefaultArtifacts, func(artifact security.Artifact, _ int) string { return "security/" + artifact.Name })...,
+)
+
+// ClusterSettings are the registry settings of the cluster that uses the rewritten repositories.
+type ClusterSettings struct {
+	// Images repo of the Deckhouse installation.
+	ImagesRepo string
+	// Repo of the ModuleSource to install modules from.
+	ModulesRepo string
+	// Repositories that Deckhouse can not find by the settings above.
+	Warnings []string
+
+	rules *Rules
+}
+
+// MakeClusterSettings works out the cluster registry settings for Deckhouse pushed to the rootRepo with modules.
+// Deckhouse derives the paths of its repositories from the images repo, rewrite rules that break this layout are
+// reported as warnings, such repositories have to be made available at the expected paths by the registry itself.
+func (r *Rules) MakeClusterSettings(rootRepo string, modules []string) ClusterSettings {
+	settings := ClusterSettings{
+		ImagesRepo:  r.Repo(rootRepo),
+		ModulesRepo: r.Repo(path.Join(rootRepo, "modules")),
+		rules:       r,
+	}
+
+	for _, repo := range platformRepos {
+		settings.checkRepo(r.Repo(path.Join(rootRepo, repo)), path.Join(settings.ImagesRepo, repo))
+	}
+	settings.checkModules(path.Join(rootRepo, "modules"), modules)
+	return settings
+}
+
+// MakeModuleSourceSettings works out the cluster registry settings for modules pushed to the modulesRepo.
+func (r *Rules) MakeModuleSourceSettings(modulesRepo string, modules []string) ClusterSettings {
+	settings := ClusterSettings{ModulesRepo: r.Repo(modulesRepo), rules: r}
+	settings.checkModules(modulesRepo, modules)
+	return settings
+}
+
+func (s *ClusterSettings) checkModules(modulesRepo string, modules []string) {
+	for _, module := range modules {
+		s.checkRepo(s.rules.Repo(path.Join(modulesRepo, module)), path.Join(s.ModulesRepo, module))
+		s.checkRepo(s.rules.Repo(path.Join(modulesRepo, module, "release")), path.Join(s.ModulesRepo, module, "release"))
+	}
+}
+
+func (s *ClusterSettings) checkRepo(actual, expected string) {
+	if actual != expected {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("Deckhouse expects %s, but images are pushed to %s", expected, actual))
+	}
+}
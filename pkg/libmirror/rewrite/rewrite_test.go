@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - prefix: registry.example.com/deckhouse/ee/modules/
+    replacement: registry.example.com/deckhouse-modules
+  - regex: ^registry\.example\.com/deckhouse/ee/security/(.+)$
+    replacement: registry.example.com/deckhouse/security-$1
+  - prefix: registry.example.com/deckhouse/ee/install
+    replacement: registry.example.com/deckhouse/installer
+`
+
+func TestRulesRepo(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"registry.example.com/deckhouse/ee":                         "registry.example.com/deckhouse/ee",
+		"registry.example.com/deckhouse/ee/modules":                 "registry.example.com/deckhouse-modules",
+		"registry.example.com/deckhouse/ee/modules/console/release": "registry.example.com/deckhouse-modules/console/release",
+		"registry.example.com/deckhouse/ee/security/trivy-db":       "registry.example.com/deckhouse/security-trivy-db",
+		"registry.example.com/deckhouse/ee/install":                 "registry.example.com/deckhouse/installer",
+		// Prefix only matches whole path levels.
+		"registry.example.com/deckhouse/ee/install-standalone": "registry.example.com/deckhouse/ee/install-standalone",
+	}
+	for repo, expected := range tests {
+		require.Equal(t, expected, rules.Repo(repo), repo)
+	}
+
+	var noRules *Rules
+	require.Equal(t, "registry.example.com/deckhouse/ee", noRules.Repo("registry.example.com/deckhouse/ee"))
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, rules := range []string{
+		"rules: [{prefix: a, regex: b, replacement: c}]",
+		"rules: [{replacement: c}]",
+		"rules: [{prefix: a}]",
+		"rules: [{regex: '(', replacement: c}]",
+		"rules: [{prefix: a, replacement: c, unknown: field}]",
+	} {
+		_, err := Parse([]byte(rules))
+		require.Error(t, err, rules)
+	}
+}
+
+func TestMakeClusterSettings(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+
+	settings := rules.MakeClusterSettings("registry.example.com/deckhouse/ee", []string{"console"})
+	require.Equal(t, "registry.example.com/deckhouse/ee", settings.ImagesRepo)
+	require.Equal(t, "registry.example.com/deckhouse-modules", settings.ModulesRepo)
+	require.Len(t, settings.Warnings, 5, "install and 4 security databases are moved out of the images repo")
+
+	settings = rules.MakeModuleSourceSettings("registry.example.com/deckhouse/ee/modules", []string{"console"})
+	require.Equal(t, "registry.example.com/deckhouse-modules", settings.ModulesRepo)
+	require.Empty(t, settings.Warnings)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Artifact is the OCI artifact, like vulnerability database or policy bundle, copied along with Deckhouse
+// to <repo>/security/<Name>:<Tag>. Bundles keep each artifact in the OCI layout at security/<Name>.
+type Artifact struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	// Optional artifacts may be missing from the bundle, other artifacts are required to push it.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// DefaultArtifacts are copied unless configured otherwise.
+var DefaultArtifacts = []Artifact{
+	{Name: "trivy-db", Tag: "2"},
+	{Name: "trivy-bdu", Tag: "1"},
+	{Name: "trivy-java-db", Tag: "1"},
+	{Name: "trivy-checks", Tag: "0", Optional: true},
+}
+
+// Config changes the set of the default artifacts. It is loaded from the file like:
+//
+//	artifacts:
+//	  - name: trivy-checks
+//	    disabled: true
+//	  - name: grype-db
+//	    tag: v6
+//	    optional: true
+//
+// Entries named after the default artifacts change their tags or disable them, other entries add artifacts to the set.
+type Config struct {
+	Artifacts []ArtifactConfig `json:"artifacts"`
+}
+
+type ArtifactConfig struct {
+	Name     string `json:"name"`
+	Tag      string `json:"tag,omitempty"`
+	Optional *bool  `json:"optional,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+var (
+	nameRegexp = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+	tagRegexp  = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+// Load reads the config at configPath and applies it to the default artifacts.
+func Load(configPath string) ([]Artifact, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read security artifacts config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse applies the config to the default artifacts.
+func Parse(data []byte) ([]Artifact, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parse security artifacts config: %w", err)
+	}
+	return config.Apply(DefaultArtifacts)
+}
+
+// Apply changes the artifacts according to the config and returns the resulting set, artifacts are left intact.
+func (c *Config) Apply(artifacts []Artifact) ([]Artifact, error) {
+	result := make([]Artifact, len(artifacts))
+	copy(result, artifacts)
+	disabled := map[string]struct{}{}
+
+	seen := map[string]struct{}{}
+	for i, entry := range c.Artifacts {
+		if !nameRegexp.MatchString(entry.Name) {
+			return nil, fmt.Errorf("artifact %d: invalid name %q", i+1, entry.Name)
+		}
+		if entry.Tag != "" && !tagRegexp.MatchString(entry.Tag) {
+			return nil, fmt.Errorf("artifact %s: invalid tag %q", entry.Name, entry.Tag)
+		}
+		if _, found := seen[entry.Name]; found {
+			return nil, fmt.Errorf("artifact %s is configured more than once", entry.Name)
+		}
+		seen[entry.Name] = struct{}{}
+
+		if entry.Disabled {
+			disabled[entry.Name] = struct{}{}
+			continue
+		}
+
+		idx := slices.IndexFunc(result, func(artifact Artifact) bool { return artifact.Name == entry.Name })
+		if idx < 0 {
+			if entry.Tag == "" {
+				return nil, fmt.Errorf("artifact %s: tag is required", entry.Name)
+			}
+			result = append(result, Artifact{Name: entry.Name})
+			idx = len(result) - 1
+		}
+		if entry.Tag != "" {
+			result[idx].Tag = entry.Tag
+		}
+		if entry.Optional != nil {
+			result[idx].Optional = *entry.Optional
+		}
+	}
+
+	enabled := make([]Artifact, 0, len(result))
+	for _, artifact := range result {
+		if _, found := disabled[artifact.Name]; !found {
+			enabled = append(enabled, artifact)
+		}
+	}
+	return enabled, nil
+}
+
+// Names returns names of the artifacts, which are also the paths of their repositories and layouts under security.
+func Names(artifacts []Artifact) []string {
+	names := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		names = append(names, artifact.Name)
+	}
+	return names
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChangesDefaultArtifacts(t *testing.T) {
+	artifacts, err := Parse([]byte(`
+artifacts:
+  - name: trivy-checks
+    disabled: true
+  - name: trivy-db
+    tag: "3"
+  - name: trivy-bdu
+    optional: true
+  - name: grype-db
+    tag: v6
+    optional: true
+  - name: policies
+    tag: latest
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Artifact{
+		{Name: "trivy-db", Tag: "3"},
+		{Name: "trivy-bdu", Tag: "1", Optional: true},
+		{Name: "trivy-java-db", Tag: "1"},
+		{Name: "grype-db", Tag: "v6", Optional: true},
+		{Name: "policies", Tag: "latest"},
+	}, artifacts)
+	require.Equal(t, "2", DefaultArtifacts[0].Tag, "Default artifacts should be left intact")
+}
+
+func TestParseEmptyConfig(t *testing.T) {
+	artifacts, err := Parse([]byte(``))
+	require.NoError(t, err)
+	require.Equal(t, DefaultArtifacts, artifacts)
+}
+
+func TestParseRejectsBadConfig(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":     "artifacts:\n  - name: grype-db\n    tags: v6\n",
+		"nested name":       "artifacts:\n  - name: grype/db\n    tag: v6\n",
+		"bad tag":           "artifacts:\n  - name: grype-db\n    tag: ':v6'\n",
+		"no tag":            "artifacts:\n  - name: grype-db\n",
+		"configured twice":  "artifacts:\n  - name: trivy-db\n    tag: '3'\n  - name: trivy-db\n    disabled: true\n",
+		"uppercase in name": "artifacts:\n  - name: Grype\n    tag: v6\n",
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(config))
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local is the storage backed by a directory on the local file system.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: filepath.Clean(dir)}
+}
+
+func (l *Local) Create(name string) (io.WriteCloser, error) {
+	f, err := os.Create(filepath.Join(l.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &syncedFile{File: f}, nil
+}
+
+func (l *Local) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.dir, name))
+}
+
+func (l *Local) Stat(name string) (FileInfo, error) {
+	stat, err := os.Stat(filepath.Join(l.dir, name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if stat.IsDir() {
+		return FileInfo{}, fmt.Errorf("%s is a directory", name)
+	}
+	return FileInfo{Name: name, Size: stat.Size()}, nil
+}
+
+func (l *Local) List() ([]FileInfo, error) {
+	catalog, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0, len(catalog))
+	for _, entry := range catalog {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, FileInfo{Name: entry.Name(), Size: info.Size()})
+	}
+	return files, nil
+}
+
+func (l *Local) Close() error {
+	return nil
+}
+
+// syncedFile flushes written data to disk before closing.
+type syncedFile struct {
+	*os.File
+}
+
+func (f *syncedFile) Close() error {
+	return errors.Join(f.File.Sync(), f.File.Close())
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Options configure connection to S3-compatible object storage.
+// Credentials are taken from the standard AWS environment variables and shared configuration files.
+type S3Options struct {
+	Endpoint string // Custom endpoint of S3-compatible storage like MinIO, path-style addressing is used with it
+	Region   string
+}
+
+// S3OptionsFromQuery reads S3Options from the query of s3:// URL, like s3://bucket/d8.tar?endpoint=http://minio:9000&region=us-east-1.
+func S3OptionsFromQuery(query url.Values) S3Options {
+	return S3Options{
+		Endpoint: query.Get("endpoint"),
+		Region:   query.Get("region"),
+	}
+}
+
+// S3 is the storage backed by the prefix in S3-compatible object storage bucket.
+type S3 struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+
+	// Uploads of the writers that were not closed yet, they are aborted when the storage is closed.
+	uploadsMu sync.Mutex
+	uploads   map[*s3Writer]struct{}
+}
+
+func NewS3(bucket, prefix string, opts S3Options) (*S3, error) {
+	config := aws.NewConfig()
+	if opts.Region != "" {
+		config = config.WithRegion(opts.Region)
+	}
+	if opts.Endpoint != "" {
+		config = config.WithEndpoint(opts.Endpoint).WithS3ForcePathStyle(true)
+		if opts.Region == "" {
+			// Region is required by the SDK even though most S3-compatible storages ignore it.
+			config = config.WithRegion("us-east-1")
+		}
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 session: %w", err)
+	}
+
+	client := s3.New(sess)
+	return &S3{
+		client:   client,
+		uploader: s3manager.NewUploaderWithClient(client),
+		bucket:   bucket,
+		prefix:   strings.Trim(prefix, "/"),
+		uploads:  map[*s3Writer]struct{}{},
+	}, nil
+}
+
+func (s *S3) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+// Create streams the data written to the returned writer into the object with multipart upload,
+// so that the file does not need to be fully buffered before it is sent.
+// Object is only created when the writer is closed, uploads of the writers left open are aborted by Close of the storage.
+func (s *S3) Create(name string) (io.WriteCloser, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	w := &s3Writer{storage: s, pipe: pipeWriter, done: make(chan error, 1)}
+	s.uploadsMu.Lock()
+	s.uploads[w] = struct{}{}
+	s.uploadsMu.Unlock()
+	go func() {
+		_, err := s.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.key(name)),
+			Body:   pipeReader,
+		})
+		_ = pipeReader.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return nil, convertS3Error(name, err)
+	}
+	return object.Body, nil
+}
+
+func (s *S3) Stat(name string) (FileInfo, error) {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return FileInfo{}, convertS3Error(name, err)
+	}
+	return FileInfo{Name: name, Size: aws.Int64Value(head.ContentLength)}, nil
+}
+
+func (s *S3) List() ([]FileInfo, error) {
+	prefix := ""
+	if s.prefix != "" {
+		prefix = s.prefix + "/"
+	}
+
+	files := make([]FileInfo, 0)
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			files = append(files, FileInfo{
+				Name: strings.TrimPrefix(aws.StringValue(object.Key), prefix),
+				Size: aws.Int64Value(object.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list objects in s3://%s/%s: %w", s.bucket, prefix, err)
+	}
+	return files, nil
+}
+
+// Close aborts uploads of the writers that were not closed.
+func (s *S3) Close() error {
+	s.uploadsMu.Lock()
+	abandoned := make([]*s3Writer, 0, len(s.uploads))
+	for w := range s.uploads {
+		abandoned = append(abandoned, w)
+	}
+	s.uploadsMu.Unlock()
+
+	for _, w := range abandoned {
+		_ = w.finish(errUploadAborted)
+	}
+	return nil
+}
+
+var errUploadAborted = errors.New("storage was closed before the file was written")
+
+func convertS3Error(name string, err error) error {
+	var requestErr awserr.RequestFailure
+	if errors.As(err, &requestErr) && requestErr.StatusCode() == http.StatusNotFound {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+type s3Writer struct {
+	storage *S3
+	pipe    *io.PipeWriter
+	done    chan error
+
+	finishOnce sync.Once
+	err        error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	return w.finish(nil)
+}
+
+// finish completes the upload if err is nil and cancels it with err otherwise.
+// Uploader aborts the multipart upload itself when reading of the data fails.
+func (w *s3Writer) finish(err error) error {
+	w.finishOnce.Do(func() {
+		_ = w.pipe.CloseWithError(err)
+		if uploadErr := <-w.done; uploadErr != nil {
+			w.err = fmt.Errorf("upload: %w", uploadErr)
+		}
+
+		w.storage.uploadsMu.Lock()
+		delete(w.storage.uploads, w)
+		w.storage.uploadsMu.Unlock()
+	})
+	return w.err
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Storage(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minioadmin")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	st, fileName, err := Open("s3://bundles/transfer/2024/d8.tar?endpoint=" + url.QueryEscape(server.URL))
+	require.NoError(t, err)
+	require.Equal(t, "d8.tar", fileName)
+
+	testStorageRoundTrip(t, st)
+}
+
+func TestS3StorageMultipartUpload(t *testing.T) {
+	fake := newFakeS3()
+	st := newTestS3Storage(t, fake)
+
+	// Uploader switches to multipart upload for the files larger than the 5 MiB part.
+	data := make([]byte, 11*1024*1024)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	w, err := st.Create("d8.tar")
+	require.NoError(t, err)
+	_, err = io.Copy(w, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := st.Open("d8.tar")
+	require.NoError(t, err)
+	readData, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.True(t, bytes.Equal(data, readData), "Data read from the storage differs from the written one")
+	require.Empty(t, fake.uploads, "Multipart upload should be completed")
+}
+
+func TestS3StorageAbortsAbandonedUploads(t *testing.T) {
+	fake := newFakeS3()
+	st := newTestS3Storage(t, fake)
+
+	w, err := st.Create("d8.tar")
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 6*1024*1024))
+	require.NoError(t, err)
+
+	require.NoError(t, st.Close(), "Closing the storage should not wait for the writer that is never closed")
+	require.ErrorContains(t, w.Close(), "storage was closed before the file was written")
+	require.Empty(t, fake.objects, "Abandoned upload should not create the object")
+	require.Empty(t, fake.uploads, "Abandoned multipart upload should be aborted")
+}
+
+func newTestS3Storage(t *testing.T, fake *fakeS3) Storage {
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minioadmin")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	st, _, err := Open("s3://bundles/d8.tar?endpoint=" + url.QueryEscape(server.URL))
+	require.NoError(t, err)
+	return st
+}
+
+// fakeS3 implements the subset of S3 API used by the storage with path-style addressing.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// Parts of multipart uploads in progress by upload ID and part number.
+	uploads map[string]map[int][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	objectKey := bucket + "/" + key
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		s.list(w, bucket, query.Get("prefix"), query.Get("delimiter"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := strconv.Itoa(len(s.objects)+len(s.uploads)) + "-" + key
+		s.uploads[uploadID] = map[int][]byte{}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: uploadID})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, found := s.uploads[query.Get("uploadId")]
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		parts[partNumber], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, partNumber))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, found := s.uploads[query.Get("uploadId")]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		object := make([]byte, 0)
+		for partNumber := 1; partNumber <= len(parts); partNumber++ {
+			object = append(object, parts[partNumber]...)
+		}
+		s.objects[objectKey] = object
+		delete(s.uploads, query.Get("uploadId"))
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: `"etag"`})
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[objectKey] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		object, found := s.objects[objectKey]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			}
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, bucket, prefix, delimiter string) {
+	type object struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []object
+	}{Name: bucket, Prefix: prefix}
+
+	for objectKey, data := range s.objects {
+		key, found := strings.CutPrefix(objectKey, bucket+"/"+prefix)
+		if !found || (delimiter != "" && strings.Contains(key, delimiter)) {
+			continue
+		}
+		result.Contents = append(result.Contents, object{Key: prefix + key, Size: len(data)})
+	}
+	result.KeyCount = len(result.Contents)
+	writeXML(w, result)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Environment variables that configure authentication on the SFTP server.
+const (
+	SFTPPasswordEnv     = "D8_MIRROR_SFTP_PASSWORD"
+	SFTPIdentityFileEnv = "D8_MIRROR_SFTP_IDENTITY_FILE"
+	SFTPKnownHostsEnv   = "D8_MIRROR_SFTP_KNOWN_HOSTS"
+)
+
+// SFTP is the storage backed by a directory on the SFTP server.
+type SFTP struct {
+	sshClient *ssh.Client
+	client    *sftp.Client
+	dir       string
+}
+
+// DialSFTP connects to the SFTP server at u and opens the dir directory on it.
+// Server host key is verified against the known_hosts file.
+// Password from the URL or D8_MIRROR_SFTP_PASSWORD environment variable, private key from the D8_MIRROR_SFTP_IDENTITY_FILE
+// or the default identity files in ~/.ssh and ssh-agent are used for authentication.
+func DialSFTP(u *url.URL, dir string) (*SFTP, error) {
+	config, err := sshClientConfig(u)
+	if err != nil {
+		return nil, fmt.Errorf("configure ssh connection: %w", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	sshClient, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+
+	client, err := sftp.NewClient(sshClient, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	return &SFTP{sshClient: sshClient, client: client, dir: path.Clean(dir)}, nil
+}
+
+func sshClientConfig(u *url.URL) (*ssh.ClientConfig, error) {
+	homeDir, _ := os.UserHomeDir()
+
+	knownHostsFile := os.Getenv(SFTPKnownHostsEnv)
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts: %w", err)
+	}
+
+	username := u.User.Username()
+	if username == "" {
+		username = os.Getenv("USER")
+	}
+
+	authMethods := make([]ssh.AuthMethod, 0)
+	password, hasPassword := u.User.Password()
+	if !hasPassword {
+		password, hasPassword = os.LookupEnv(SFTPPasswordEnv)
+	}
+	if hasPassword {
+		authMethods = append(authMethods, ssh.Password(password))
+	}
+
+	identityFiles := []string{
+		filepath.Join(homeDir, ".ssh", "id_ed25519"),
+		filepath.Join(homeDir, ".ssh", "id_ecdsa"),
+		filepath.Join(homeDir, ".ssh", "id_rsa"),
+	}
+	if identityFile := os.Getenv(SFTPIdentityFileEnv); identityFile != "" {
+		identityFiles = []string{identityFile}
+	}
+	signers := make([]ssh.Signer, 0)
+	for _, identityFile := range identityFiles {
+		keyData, err := os.ReadFile(identityFile)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read identity file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("parse identity file %s: %w", identityFile, err)
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		authMethods = append(authMethods, ssh.PublicKeys(signers...))
+	}
+
+	if agentSocket := os.Getenv("SSH_AUTH_SOCK"); agentSocket != "" {
+		if agentConn, err := net.Dial("unix", agentSocket); err == nil {
+			authMethods = append(authMethods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+func (s *SFTP) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+func (s *SFTP) Create(name string) (io.WriteCloser, error) {
+	return s.client.OpenFile(s.path(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+func (s *SFTP) Open(name string) (io.ReadCloser, error) {
+	return s.client.Open(s.path(name))
+}
+
+func (s *SFTP) Stat(name string) (FileInfo, error) {
+	info, err := s.client.Stat(s.path(name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return FileInfo{}, fmt.Errorf("%s is not a regular file", name)
+	}
+	return FileInfo{Name: name, Size: info.Size()}, nil
+}
+
+func (s *SFTP) List() ([]FileInfo, error) {
+	entries, err := s.client.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, FileInfo{Name: entry.Name(), Size: entry.Size()})
+	}
+	return files, nil
+}
+
+func (s *SFTP) Close() error {
+	err := s.client.Close()
+	if s.sshClient != nil {
+		err = errors.Join(err, s.sshClient.Close())
+	}
+	return err
+}
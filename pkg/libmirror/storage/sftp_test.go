@@ -0,0 +1,128 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSFTPStorage(t *testing.T) {
+	addr, hostKey := startSFTPServer(t, "d8", "secret")
+
+	homeDir := t.TempDir()
+	knownHostsFile := filepath.Join(homeDir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"), 0o600))
+	t.Setenv("HOME", homeDir)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv(SFTPKnownHostsEnv, knownHostsFile)
+	t.Setenv(SFTPPasswordEnv, "secret")
+
+	st, fileName, err := Open("sftp://d8@" + addr + filepath.Join(t.TempDir(), "d8.tar"))
+	require.NoError(t, err)
+	require.Equal(t, "d8.tar", fileName)
+	testStorageRoundTrip(t, st)
+
+	t.Setenv(SFTPPasswordEnv, "wrong")
+	_, _, err = Open("sftp://d8@" + addr + "/tmp/d8.tar")
+	require.ErrorContains(t, err, "unable to authenticate")
+
+	require.NoError(t, os.WriteFile(knownHostsFile, nil, 0o600))
+	_, _, err = Open("sftp://d8@" + addr + "/tmp/d8.tar")
+	require.ErrorContains(t, err, "key is unknown", "Unknown host key should be rejected")
+}
+
+// startSFTPServer starts SSH server with SFTP subsystem on the loopback interface and returns its address and host key.
+func startSFTPServer(t *testing.T, username, password string) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == username && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(conn, config)
+		}
+	}()
+
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveSFTPConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range channelRequests {
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(isSFTP, nil)
+				if !isSFTP {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					_ = channel.Close()
+					return
+				}
+				_ = server.Serve()
+				_ = server.Close()
+				return
+			}
+		}()
+	}
+}
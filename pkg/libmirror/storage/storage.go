@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is a flat directory of files the bundle is written to or read from.
+// It might be a directory on the local file system, a prefix in S3-compatible object storage or a directory on the SFTP server.
+type Storage interface {
+	// Create creates or truncates the named file.
+	// Data is guaranteed to be stored only after the returned writer is successfully closed.
+	Create(name string) (io.WriteCloser, error)
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Stat returns the information about the named file. Error wrapping fs.ErrNotExist is returned for missing files.
+	Stat(name string) (FileInfo, error)
+	// List returns all files in the storage directory.
+	List() ([]FileInfo, error)
+	// Close releases connections to the storage.
+	Close() error
+}
+
+type FileInfo struct {
+	Name string
+	Size int64
+}
+
+// IsRemote reports whether location points to the remote storage rather than to the local file system.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "sftp://")
+}
+
+// Open opens the storage directory that holds the file at location and returns the name of this file within the storage.
+// Location may be a local path, s3://<bucket>/<key> or sftp://[<user>@]<host>[:<port>]/<path> URL.
+func Open(location string) (Storage, string, error) {
+	if !IsRemote(location) {
+		location = filepath.Clean(location)
+		return NewLocal(filepath.Dir(location)), filepath.Base(location), nil
+	}
+
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse storage location: %w", err)
+	}
+	dir, fileName := path.Split(strings.TrimPrefix(path.Clean(locationURL.Path), "/"))
+	if fileName == "" {
+		return nil, "", fmt.Errorf("%s does not point to a file", location)
+	}
+	dir = strings.TrimSuffix(dir, "/")
+
+	var storage Storage
+	switch locationURL.Scheme {
+	case "s3":
+		storage, err = NewS3(locationURL.Host, dir, S3OptionsFromQuery(locationURL.Query()))
+	case "sftp":
+		storage, err = DialSFTP(locationURL, "/"+dir)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return storage, fileName, nil
+}
+
+// WriteFile writes data to the named file in the storage.
+func WriteFile(storage Storage, name string, data io.Reader) error {
+	file, err := storage.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	st, fileName, err := Open(filepath.Join(dir, "bundles", "..", "d8.tar"))
+	require.NoError(t, err)
+	require.Equal(t, "d8.tar", fileName)
+	require.Equal(t, &Local{dir: dir}, st)
+}
+
+func TestOpenRejectsURLWithoutFileName(t *testing.T) {
+	_, _, err := Open("s3://bucket/")
+	require.Error(t, err)
+}
+
+func TestLocalStorage(t *testing.T) {
+	testStorageRoundTrip(t, NewLocal(t.TempDir()))
+}
+
+// testStorageRoundTrip checks that the file written to the storage can be found and read back unchanged.
+func testStorageRoundTrip(t *testing.T, st Storage) {
+	t.Helper()
+
+	_, err := st.Stat("d8.tar")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = st.Open("d8.tar")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	data := make([]byte, 3*1024*1024+15)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	w, err := st.Create("d8.tar")
+	require.NoError(t, err)
+	_, err = io.CopyBuffer(w, bytes.NewReader(data), make([]byte, 100*1024))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, WriteFile(st, "d8.tar.gostsum", bytes.NewReader([]byte("digest"))))
+
+	stat, err := st.Stat("d8.tar")
+	require.NoError(t, err)
+	require.Equal(t, FileInfo{Name: "d8.tar", Size: int64(len(data))}, stat)
+
+	files, err := st.List()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []FileInfo{
+		{Name: "d8.tar", Size: int64(len(data))},
+		{Name: "d8.tar.gostsum", Size: 6},
+	}, files)
+
+	r, err := st.Open("d8.tar")
+	require.NoError(t, err)
+	readData, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.True(t, bytes.Equal(data, readData), "Data read from the storage differs from the written one")
+
+	require.NoError(t, st.Close())
+}
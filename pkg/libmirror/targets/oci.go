@@ -0,0 +1,171 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targets
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/layouts"
+)
+
+// OCILayout writes images into a single OCI Image Layout.
+// Every image is annotated with its full reference, the same way images are annotated in bundle layouts.
+// If the path ends with .tar, the layout is packed into the tar archive on Close.
+type OCILayout struct {
+	layout      layout.Path
+	archivePath string
+}
+
+func NewOCILayout(path string) (*OCILayout, error) {
+	path = filepath.Clean(path)
+	if filepath.Ext(path) != ".tar" {
+		l, err := openOrCreateLayout(path)
+		if err != nil {
+			return nil, err
+		}
+		return &OCILayout{layout: l}, nil
+	}
+
+	layoutDir, err := os.MkdirTemp(filepath.Dir(path), ".oci-layout-")
+	if err != nil {
+		return nil, fmt.Errorf("create OCI Image Layout: %w", err)
+	}
+	l, err := layouts.CreateEmptyImageLayoutAtPath(layoutDir)
+	if err != nil {
+		_ = os.RemoveAll(layoutDir)
+		return nil, fmt.Errorf("create OCI Image Layout: %w", err)
+	}
+	return &OCILayout{layout: l, archivePath: path}, nil
+}
+
+func openOrCreateLayout(path string) (layout.Path, error) {
+	l, err := layout.FromPath(path)
+	if err == nil {
+		return l, nil
+	}
+
+	l, err = layouts.CreateEmptyImageLayoutAtPath(path)
+	if err != nil {
+		return "", fmt.Errorf("create OCI Image Layout: %w", err)
+	}
+	return l, nil
+}
+
+func (o *OCILayout) WriteImage(repo, tag string, img v1.Image) error {
+	ref := repo + ":" + tag
+	err := o.layout.ReplaceImage(img,
+		match.Annotation("org.opencontainers.image.ref.name", ref),
+		layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": ref,
+			"io.deckhouse.image.short_tag":      tag,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("write %s to OCI Image Layout: %w", ref, err)
+	}
+	return nil
+}
+
+func (o *OCILayout) WriteIndex(repo, tag string, index v1.ImageIndex) error {
+	ref := repo + ":" + tag
+	err := o.layout.ReplaceIndex(index,
+		match.Annotation("org.opencontainers.image.ref.name", ref),
+		layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": ref,
+			"io.deckhouse.image.short_tag":      tag,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("write %s to OCI Image Layout: %w", ref, err)
+	}
+	return nil
+}
+
+func (o *OCILayout) Close() error {
+	if o.archivePath == "" {
+		return nil
+	}
+	defer os.RemoveAll(string(o.layout))
+
+	if err := packDir(string(o.layout), o.archivePath); err != nil {
+		return fmt.Errorf("pack OCI Image Layout into %s: %w", o.archivePath, err)
+	}
+	return nil
+}
+
+func packDir(dir, archivePath string) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+
+	tarWriter := tar.NewWriter(archive)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		pathInTar, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:    filepath.ToSlash(pathInTar),
+			Size:    info.Size(),
+			Mode:    0o644,
+			ModTime: info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		_ = archive.Close()
+		return err
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		_ = archive.Close()
+		return err
+	}
+	if err = archive.Sync(); err != nil {
+		_ = archive.Close()
+		return err
+	}
+	return archive.Close()
+}
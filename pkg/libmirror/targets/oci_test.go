@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targets
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCILayoutReplacesImagesWithSameReference(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee/install"
+
+	layoutPath := filepath.Join(t.TempDir(), "layout")
+	target, err := Open("oci:" + layoutPath)
+	require.NoError(t, err)
+
+	newImage := randomImage(t)
+	require.NoError(t, target.WriteImage(repo, "v1.61.2", randomImage(t)))
+	require.NoError(t, target.WriteImage(repo, "v1.61.2", newImage))
+	require.NoError(t, target.WriteImage(repo, "v1.61.3", randomImage(t)))
+	require.NoError(t, target.Close())
+
+	l, err := layout.FromPath(layoutPath)
+	require.NoError(t, err)
+	index, err := l.ImageIndex()
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 2)
+
+	newDigest, err := newImage.Digest()
+	require.NoError(t, err)
+	for _, desc := range indexManifest.Manifests {
+		if desc.Annotations["org.opencontainers.image.ref.name"] == repo+":v1.61.2" {
+			require.Equal(t, newDigest, desc.Digest)
+			require.Equal(t, "v1.61.2", desc.Annotations["io.deckhouse.image.short_tag"])
+		}
+	}
+}
+
+func TestOCILayoutWritesIndex(t *testing.T) {
+	const repo = "registry.example.com/deckhouse/ee"
+
+	layoutPath := filepath.Join(t.TempDir(), "layout")
+	target, err := Open("oci:" + layoutPath)
+	require.NoError(t, err)
+
+	index, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, target.WriteIndex(repo, "v1.61.2", index))
+	require.NoError(t, target.Close())
+
+	l, err := layout.FromPath(layoutPath)
+	require.NoError(t, err)
+	layoutIndex, err := l.ImageIndex()
+	require.NoError(t, err)
+	indexManifest, err := layoutIndex.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 1)
+	require.True(t, indexManifest.Manifests[0].MediaType.IsIndex())
+	require.Equal(t, repo+":v1.61.2", indexManifest.Manifests[0].Annotations["org.opencontainers.image.ref.name"])
+
+	storedIndex, err := layoutIndex.ImageIndex(indexManifest.Manifests[0].Digest)
+	require.NoError(t, err)
+	storedManifest, err := storedIndex.IndexManifest()
+	require.NoError(t, err)
+	for _, desc := range storedManifest.Manifests {
+		_, err = storedIndex.Image(desc.Digest)
+		require.NoError(t, err)
+	}
+}
+
+func TestOCIArchive(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "d8.tar")
+	target, err := Open("oci:" + archivePath)
+	require.NoError(t, err)
+
+	img := randomImage(t)
+	require.NoError(t, target.WriteImage("registry.example.com/deckhouse/ee", "v1.61.2", img))
+	require.NoError(t, target.Close())
+
+	entries, err := os.ReadDir(filepath.Dir(archivePath))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "Temporary layout should be removed after the archive is written")
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	files := readTarFileNames(t, archivePath)
+	require.Contains(t, files, "oci-layout")
+	require.Contains(t, files, "index.json")
+	require.Contains(t, files, "blobs/sha256/"+digest.Hex)
+}
+
+func randomImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(256, 2)
+	require.NoError(t, err)
+	return img
+}
+
+func readTarFileNames(t *testing.T, archivePath string) []string {
+	t.Helper()
+	archive, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	names := make([]string, 0)
+	tarReader := tar.NewReader(archive)
+	for {
+		hdr, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return names
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RegistryStorage writes images into the storage tree of the filesystem driver of distribution registry (registry:2),
+// so that the registry started on top of this tree serves them right away.
+type RegistryStorage struct {
+	root string // Path to the docker/registry/v2 directory
+}
+
+func NewRegistryStorage(path string) (*RegistryStorage, error) {
+	root := filepath.Join(filepath.Clean(path), "docker", "registry", "v2")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create registry storage: %w", err)
+	}
+	return &RegistryStorage{root: root}, nil
+}
+
+func (r *RegistryStorage) WriteImage(repo, tag string, img v1.Image) error {
+	repoDir, err := r.repoDir(repo)
+	if err != nil {
+		return err
+	}
+	if err = r.writeImage(repoDir, img); err != nil {
+		return err
+	}
+	manifestDigest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("read image digest: %w", err)
+	}
+	return writeTag(repoDir, tag, manifestDigest)
+}
+
+// WriteIndex writes the index along with all images it references.
+func (r *RegistryStorage) WriteIndex(repo, tag string, index v1.ImageIndex) error {
+	repoDir, err := r.repoDir(repo)
+	if err != nil {
+		return err
+	}
+	if err = r.writeIndex(repoDir, index); err != nil {
+		return err
+	}
+	indexDigest, err := index.Digest()
+	if err != nil {
+		return fmt.Errorf("read index digest: %w", err)
+	}
+	return writeTag(repoDir, tag, indexDigest)
+}
+
+func (r *RegistryStorage) repoDir(repo string) (string, error) {
+	repository, err := name.NewRepository(repo)
+	if err != nil {
+		return "", fmt.Errorf("parse repository name: %w", err)
+	}
+	return filepath.Join(r.root, "repositories", filepath.FromSlash(repository.RepositoryStr())), nil
+}
+
+func (r *RegistryStorage) writeImage(repoDir string, img v1.Image) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("read image layers: %w", err)
+	}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		if err = r.writeBlob(digest, layer.Compressed); err != nil {
+			return fmt.Errorf("write layer %s: %w", digest, err)
+		}
+		if err = writeLink(filepath.Join(repoDir, "_layers", digest.Algorithm, digest.Hex, "link"), digest); err != nil {
+			return err
+		}
+	}
+
+	configDigest, err := img.ConfigName()
+	if err != nil {
+		return fmt.Errorf("read image config digest: %w", err)
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return fmt.Errorf("read image config: %w", err)
+	}
+	if err = r.writeBlob(configDigest, bytesOpener(rawConfig)); err != nil {
+		return fmt.Errorf("write image config: %w", err)
+	}
+	if err = writeLink(filepath.Join(repoDir, "_layers", configDigest.Algorithm, configDigest.Hex, "link"), configDigest); err != nil {
+		return err
+	}
+
+	manifestDigest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("read image digest: %w", err)
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return fmt.Errorf("read image manifest: %w", err)
+	}
+	return r.writeManifest(repoDir, manifestDigest, rawManifest)
+}
+
+func (r *RegistryStorage) writeIndex(repoDir string, index v1.ImageIndex) error {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("read index manifest: %w", err)
+	}
+	for _, desc := range indexManifest.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			childIndex, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("read index %s: %w", desc.Digest, err)
+			}
+			if err = r.writeIndex(repoDir, childIndex); err != nil {
+				return err
+			}
+		case desc.MediaType.IsImage():
+			img, err := index.Image(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("read image %s: %w", desc.Digest, err)
+			}
+			if err = r.writeImage(repoDir, img); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("manifest %s has unsupported media type %q", desc.Digest, desc.MediaType)
+		}
+	}
+
+	indexDigest, err := index.Digest()
+	if err != nil {
+		return fmt.Errorf("read index digest: %w", err)
+	}
+	rawManifest, err := index.RawManifest()
+	if err != nil {
+		return fmt.Errorf("read index manifest: %w", err)
+	}
+	return r.writeManifest(repoDir, indexDigest, rawManifest)
+}
+
+// writeManifest stores the manifest in the blob store and links it to the repository, so that it can be pulled by digest.
+func (r *RegistryStorage) writeManifest(repoDir string, digest v1.Hash, rawManifest []byte) error {
+	if err := r.writeBlob(digest, bytesOpener(rawManifest)); err != nil {
+		return fmt.Errorf("write manifest %s: %w", digest, err)
+	}
+	return writeLink(filepath.Join(repoDir, "_manifests", "revisions", digest.Algorithm, digest.Hex, "link"), digest)
+}
+
+func writeTag(repoDir, tag string, digest v1.Hash) error {
+	tagDir := filepath.Join(repoDir, "_manifests", "tags", tag)
+	for _, link := range []string{
+		filepath.Join(tagDir, "index", digest.Algorithm, digest.Hex, "link"),
+		filepath.Join(tagDir, "current", "link"),
+	} {
+		if err := writeLink(link, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RegistryStorage) Close() error {
+	return nil
+}
+
+// writeBlob stores the blob in the shared blob store of the registry unless it is already there.
+func (r *RegistryStorage) writeBlob(digest v1.Hash, open func() (io.ReadCloser, error)) error {
+	blobPath := filepath.Join(r.root, "blobs", digest.Algorithm, digest.Hex[:2], digest.Hex, "data")
+	if _, err := os.Stat(blobPath); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	blob, err := open()
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	if err = os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(blobPath), "data-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err = io.Copy(tmpFile, blob); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), blobPath)
+}
+
+func writeLink(linkPath string, digest v1.Hash) error {
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0o755); err != nil {
+		return fmt.Errorf("write registry link: %w", err)
+	}
+	if err := os.WriteFile(linkPath, []byte(digest.String()), 0o644); err != nil {
+		return fmt.Errorf("write registry link: %w", err)
+	}
+	return nil
+}
+
+func bytesOpener(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryStorageTree(t *testing.T) {
+	storageDir := t.TempDir()
+	target, err := Open("docker-registry-storage:" + storageDir)
+	require.NoError(t, err)
+
+	img := randomImage(t)
+	require.NoError(t, target.WriteImage("registry.example.com:5000/deckhouse/ee/install", "v1.61.2", img))
+	require.NoError(t, target.WriteImage("registry.example.com:5000/deckhouse/ee/install-standalone", "v1.61.2", img))
+	require.NoError(t, target.Close())
+
+	root := filepath.Join(storageDir, "docker", "registry", "v2")
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	rawManifest, err := img.RawManifest()
+	require.NoError(t, err)
+
+	storedManifest, err := os.ReadFile(filepath.Join(root, "blobs", "sha256", digest.Hex[:2], digest.Hex, "data"))
+	require.NoError(t, err)
+	require.Equal(t, rawManifest, storedManifest)
+
+	for _, repo := range []string{"deckhouse/ee/install", "deckhouse/ee/install-standalone"} {
+		manifestsDir := filepath.Join(root, "repositories", repo, "_manifests")
+		requireLink(t, filepath.Join(manifestsDir, "tags", "v1.61.2", "current", "link"), digest.String())
+		requireLink(t, filepath.Join(manifestsDir, "tags", "v1.61.2", "index", "sha256", digest.Hex, "link"), digest.String())
+		requireLink(t, filepath.Join(manifestsDir, "revisions", "sha256", digest.Hex, "link"), digest.String())
+
+		layers, err := img.Layers()
+		require.NoError(t, err)
+		for _, layer := range layers {
+			layerDigest, err := layer.Digest()
+			require.NoError(t, err)
+			requireLink(t, filepath.Join(root, "repositories", repo, "_layers", "sha256", layerDigest.Hex, "link"), layerDigest.String())
+
+			blob, err := os.Stat(filepath.Join(root, "blobs", "sha256", layerDigest.Hex[:2], layerDigest.Hex, "data"))
+			require.NoError(t, err)
+			layerSize, err := layer.Size()
+			require.NoError(t, err)
+			require.Equal(t, layerSize, blob.Size())
+		}
+
+		configDigest, err := img.ConfigName()
+		require.NoError(t, err)
+		requireLink(t, filepath.Join(root, "repositories", repo, "_layers", "sha256", configDigest.Hex, "link"), configDigest.String())
+	}
+}
+
+func TestRegistryStorageWritesIndex(t *testing.T) {
+	storageDir := t.TempDir()
+	target, err := Open("docker-registry-storage:" + storageDir)
+	require.NoError(t, err)
+
+	index, err := random.Index(64, 1, 2)
+	require.NoError(t, err)
+	require.NoError(t, target.WriteIndex("registry.example.com/deckhouse/ee", "v1.61.2", index))
+	require.NoError(t, target.Close())
+
+	root := filepath.Join(storageDir, "docker", "registry", "v2")
+	manifestsDir := filepath.Join(root, "repositories", "deckhouse/ee", "_manifests")
+	indexDigest, err := index.Digest()
+	require.NoError(t, err)
+	requireLink(t, filepath.Join(manifestsDir, "tags", "v1.61.2", "current", "link"), indexDigest.String())
+	requireLink(t, filepath.Join(manifestsDir, "revisions", "sha256", indexDigest.Hex, "link"), indexDigest.String())
+
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, indexManifest.Manifests, 2)
+	for _, desc := range indexManifest.Manifests {
+		requireLink(t, filepath.Join(manifestsDir, "revisions", "sha256", desc.Digest.Hex, "link"), desc.Digest.String())
+		_, err = os.Stat(filepath.Join(root, "blobs", "sha256", desc.Digest.Hex[:2], desc.Digest.Hex, "data"))
+		require.NoError(t, err)
+	}
+}
+
+func requireLink(t *testing.T, linkPath, expectedTarget string) {
+	t.Helper()
+	link, err := os.ReadFile(linkPath)
+	require.NoError(t, err)
+	require.Equal(t, expectedTarget, string(link))
+}
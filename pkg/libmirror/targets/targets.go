@@ -0,0 +1,57 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targets
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Prefixes of push target locations that are written to the local file system instead of the registry.
+const (
+	OCILayoutPrefix       = "oci:"
+	RegistryStoragePrefix = "docker-registry-storage:"
+)
+
+// Target receives images that would otherwise be pushed into the registry.
+type Target interface {
+	// WriteImage stores img under repo:tag, repo is the full repository reference like registry.example.com/deckhouse/ee/install.
+	WriteImage(repo, tag string, img v1.Image) error
+	// WriteIndex stores index with all images it references under repo:tag.
+	WriteIndex(repo, tag string, index v1.ImageIndex) error
+	// Close flushes everything that was written to the target.
+	Close() error
+}
+
+// IsLocal reports whether location points to the local push target rather than to the registry.
+func IsLocal(location string) bool {
+	return strings.HasPrefix(location, OCILayoutPrefix) || strings.HasPrefix(location, RegistryStoragePrefix)
+}
+
+// Open creates the local push target at location, see IsLocal.
+func Open(location string) (Target, error) {
+	switch {
+	case strings.HasPrefix(location, OCILayoutPrefix):
+		return NewOCILayout(strings.TrimPrefix(location, OCILayoutPrefix))
+	case strings.HasPrefix(location, RegistryStoragePrefix):
+		return NewRegistryStorage(strings.TrimPrefix(location, RegistryStoragePrefix))
+	default:
+		return nil, fmt.Errorf("unknown push target %q", location)
+	}
+}
@@ -20,10 +20,10 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net/http"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/hashicorp/go-cleanhttp"
 
@@ -55,35 +55,6 @@ func ValidateReadAccessForImageContext(
 	return nil
 }
 
-func ValidateWriteAccessForRepo(repo string, authProvider authn.Authenticator, insecure, skipVerifyTLS bool) error {
-	return ValidateWriteAccessForRepoContext(context.Background(), repo, authProvider, insecure, skipVerifyTLS)
-}
-
-func ValidateWriteAccessForRepoContext(
-	ctx context.Context,
-	repo string,
-	authProvider authn.Authenticator,
-	insecure, skipVerifyTLS bool,
-) error {
-	nameOpts, remoteOpts := MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
-	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
-	ref, err := name.NewTag(repo+":d8WriteCheck", nameOpts...)
-	if err != nil {
-		return err
-	}
-
-	syntheticImage, err := random.Image(512, 1)
-	if err != nil {
-		return fmt.Errorf("Generate random image: %w", err)
-	}
-
-	// We do not delete uploaded synthetic image, not all registries are set up to take DELETE requests kindly
-	if err = remote.Write(ref, syntheticImage, remoteOpts...); err != nil {
-		return err
-	}
-	return nil
-}
-
 func MakeRemoteRegistryRequestOptions(authProvider authn.Authenticator, insecure, skipTLSVerification bool) ([]name.Option, []remote.Option) {
 	n, r := make([]name.Option, 0), make([]remote.Option, 0)
 	if insecure {
@@ -93,9 +64,7 @@ func MakeRemoteRegistryRequestOptions(authProvider authn.Authenticator, insecure
 		r = append(r, remote.WithAuth(authProvider))
 	}
 	if skipTLSVerification {
-		transport := cleanhttp.DefaultTransport()
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		r = append(r, remote.WithTransport(transport))
+		r = append(r, remote.WithTransport(MakeTransport(skipTLSVerification)))
 	}
 
 	return n, r
@@ -104,3 +73,13 @@ func MakeRemoteRegistryRequestOptions(authProvider authn.Authenticator, insecure
 func MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx *contexts.BaseContext) ([]name.Option, []remote.Option) {
 	return MakeRemoteRegistryRequestOptions(mirrorCtx.RegistryAuth, mirrorCtx.Insecure, mirrorCtx.SkipTLSVerification)
 }
+
+// MakeTransport returns HTTP transport for registry requests.
+func MakeTransport(skipTLSVerification bool) http.RoundTripper {
+	if !skipTLSVerification {
+		return remote.DefaultTransport
+	}
+	transport := cleanhttp.DefaultTransport()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return transport
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package auth
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
@@ -106,3 +107,50 @@ func TestWriteAccessValidationInsecure(t *testing.T) {
 	err := ValidateWriteAccessForRepo(repo, authn.Anonymous, true, false)
 	require.NoError(t, err, "Should validate successfully")
 }
+
+func TestWriteAccessCheckLeavesNoArtifacts(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.WithBlobHandler(registry.NewInMemoryBlobHandler())))
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test"
+
+	access, err := CheckWriteAccessForRepo(repo, authn.Anonymous, true, false)
+	require.NoError(t, err)
+	require.Equal(t, PermissionAllowed, access.Push)
+	require.Equal(t, PermissionUnknown, access.TagOverwrite)
+	require.Equal(t, PermissionUnknown, access.Delete)
+	require.Equal(t, "push allowed; could not verify: tag overwrite, delete", access.String())
+
+	repository, err := name.NewRepository(repo, name.Insecure)
+	require.NoError(t, err)
+	_, err = remote.List(repository)
+	require.Error(t, err, "Repository should not be created by write access check")
+}
+
+func TestWriteAccessCheckReportsDeniedOperations(t *testing.T) {
+	registryHandler := registry.New(registry.WithBlobHandler(registry.NewInMemoryBlobHandler()))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+		default:
+			registryHandler.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test"
+
+	access, err := CheckWriteAccessForRepo(repo, authn.Anonymous, true, false)
+	require.NoError(t, err)
+	require.Equal(t, PermissionDenied, access.Push)
+	require.Equal(t, PermissionDenied, access.TagOverwrite)
+	require.Equal(t, PermissionDenied, access.Delete)
+	require.Len(t, access.Notes, 2)
+	require.Equal(t, "push denied, tag overwrite denied, delete denied", access.String())
+
+	err = ValidateWriteAccessForRepo(repo, authn.Anonymous, true, false)
+	require.Error(t, err)
+}
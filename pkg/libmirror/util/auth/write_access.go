@@ -0,0 +1,229 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+type Permission string
+
+const (
+	PermissionAllowed Permission = "allowed"
+	PermissionDenied  Permission = "denied"
+	// PermissionUnknown is reported for operations that registry does not let to check without changing its contents.
+	PermissionUnknown Permission = "unknown"
+)
+
+// WriteAccess lists operations on the repository that are permitted for the user.
+type WriteAccess struct {
+	Push         Permission
+	TagOverwrite Permission
+	Delete       Permission
+	// Explanations for denied and unknown permissions.
+	Notes []string
+}
+
+// String lists checked permissions, permissions that could not be checked are reported separately.
+func (a *WriteAccess) String() string {
+	checked := make([]string, 0, 3)
+	unverified := make([]string, 0, 3)
+	for _, op := range []struct {
+		name       string
+		permission Permission
+	}{
+		{"push", a.Push},
+		{"tag overwrite", a.TagOverwrite},
+		{"delete", a.Delete},
+	} {
+		if op.permission == PermissionUnknown {
+			unverified = append(unverified, op.name)
+			continue
+		}
+		checked = append(checked, fmt.Sprintf("%s %s", op.name, op.permission))
+	}
+
+	if len(unverified) == 0 {
+		return strings.Join(checked, ", ")
+	}
+	return fmt.Sprintf("%s; could not verify: %s", strings.Join(checked, ", "), strings.Join(unverified, ", "))
+}
+
+// Digest of the empty blob, no manifest is ever stored under it.
+const nonExistentManifestDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func ValidateWriteAccessForRepo(repo string, authProvider authn.Authenticator, insecure, skipVerifyTLS bool) error {
+	return ValidateWriteAccessForRepoContext(context.Background(), repo, authProvider, insecure, skipVerifyTLS)
+}
+
+// ValidateWriteAccessForRepoContext returns an error if images can not be pushed to the repo.
+func ValidateWriteAccessForRepoContext(
+	ctx context.Context,
+	repo string,
+	authProvider authn.Authenticator,
+	insecure, skipVerifyTLS bool,
+) error {
+	access, err := CheckWriteAccessForRepoContext(ctx, repo, authProvider, insecure, skipVerifyTLS)
+	if err != nil {
+		return err
+	}
+	if access.Push != PermissionAllowed {
+		return fmt.Errorf("push to %s is not allowed: %v", repo, access.Notes)
+	}
+	return nil
+}
+
+func CheckWriteAccessForRepo(repo string, authProvider authn.Authenticator, insecure, skipVerifyTLS bool) (*WriteAccess, error) {
+	return CheckWriteAccessForRepoContext(context.Background(), repo, authProvider, insecure, skipVerifyTLS)
+}
+
+// CheckWriteAccessForRepoContext finds out which write operations on the repo are permitted without leaving anything in it.
+// Push permission is checked by starting blob upload session and then cancelling it.
+// Delete permission is checked by deleting the manifest that does not exist.
+// Registries do not expose tag immutability rules through the distribution API, so tag overwrite permission is left unknown
+// unless pushes are denied altogether. Callers that know registry-specific rules may fill it in.
+func CheckWriteAccessForRepoContext(
+	ctx context.Context,
+	repo string,
+	authProvider authn.Authenticator,
+	insecure, skipVerifyTLS bool,
+) (*WriteAccess, error) {
+	nameOpts, _ := MakeRemoteRegistryRequestOptions(authProvider, insecure, skipVerifyTLS)
+	repository, err := name.NewRepository(repo, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("Parse registry address: %w", err)
+	}
+	if authProvider == nil {
+		authProvider = authn.Anonymous
+	}
+
+	access := &WriteAccess{Push: PermissionUnknown, TagOverwrite: PermissionUnknown, Delete: PermissionUnknown}
+	scopes := []string{repository.Scope(transport.PushScope), repository.Scope("delete")}
+	rt, err := transport.NewWithContext(ctx, repository.Registry, authProvider, MakeTransport(skipVerifyTLS), scopes)
+	if err != nil {
+		if isAccessDenied(err) {
+			access.Push, access.TagOverwrite, access.Delete = PermissionDenied, PermissionDenied, PermissionDenied
+			access.Notes = append(access.Notes, err.Error())
+			return access, nil
+		}
+		return nil, fmt.Errorf("Authenticate to %s: %w", repository.RegistryStr(), err)
+	}
+	client := &http.Client{Transport: rt}
+	baseURL := url.URL{Scheme: repository.Registry.Scheme(), Host: repository.RegistryStr()}
+
+	if access.Push, err = checkPush(ctx, client, baseURL, repository, access); err != nil {
+		return nil, err
+	}
+	if access.Push == PermissionDenied {
+		access.TagOverwrite = PermissionDenied
+	} else {
+		access.Notes = append(access.Notes, "tag overwrite: tag immutability is not exposed through the distribution API, it was not checked")
+	}
+	if access.Delete, err = checkDelete(ctx, client, baseURL, repository, access); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+func checkPush(ctx context.Context, client *http.Client, baseURL url.URL, repo name.Repository, access *WriteAccess) (Permission, error) {
+	uploadURL := baseURL
+	uploadURL.Path = fmt.Sprintf("/v2/%s/blobs/uploads/", repo.RepositoryStr())
+	resp, err := doRequest(ctx, client, http.MethodPost, uploadURL.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err = transport.CheckError(resp, http.StatusAccepted); err != nil {
+		if isAccessDenied(err) {
+			access.Notes = append(access.Notes, "push: "+err.Error())
+			return PermissionDenied, nil
+		}
+		return "", fmt.Errorf("Start blob upload to %s: %w", repo, err)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		access.Notes = append(access.Notes, "push: registry did not return upload session location, it will expire the session itself")
+		return PermissionAllowed, nil
+	}
+	cancelResp, err := doRequest(ctx, client, http.MethodDelete, location.String())
+	if err != nil {
+		return "", err
+	}
+	defer cancelResp.Body.Close()
+	if err = transport.CheckError(cancelResp, http.StatusNoContent, http.StatusAccepted, http.StatusOK); err != nil {
+		access.Notes = append(access.Notes, "push: upload session was not cancelled, registry will expire it itself: "+err.Error())
+	}
+	return PermissionAllowed, nil
+}
+
+func checkDelete(ctx context.Context, client *http.Client, baseURL url.URL, repo name.Repository, access *WriteAccess) (Permission, error) {
+	manifestURL := baseURL
+	manifestURL.Path = fmt.Sprintf("/v2/%s/manifests/%s", repo.RepositoryStr(), nonExistentManifestDigest)
+	resp, err := doRequest(ctx, client, http.MethodDelete, manifestURL.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Registries are free to look up the manifest before authorizing the request, so not found does not tell
+	// whether deletes are allowed. Only an explicit denial is trusted.
+	if resp.StatusCode == http.StatusNotFound {
+		access.Notes = append(access.Notes, "delete: registry reported the probe manifest as not found, permission to delete was not checked")
+		return PermissionUnknown, nil
+	}
+	err = transport.CheckError(resp, http.StatusAccepted)
+	switch {
+	case err == nil:
+		return PermissionAllowed, nil
+	case isAccessDenied(err) || isUnsupported(err):
+		access.Notes = append(access.Notes, "delete: "+err.Error())
+		return PermissionDenied, nil
+	default:
+		access.Notes = append(access.Notes, "delete: "+err.Error())
+		return PermissionUnknown, nil
+	}
+}
+
+func doRequest(ctx context.Context, client *http.Client, method, requestURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func isAccessDenied(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) &&
+		(transportErr.StatusCode == http.StatusUnauthorized || transportErr.StatusCode == http.StatusForbidden)
+}
+
+func isUnsupported(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusMethodNotAllowed
+}
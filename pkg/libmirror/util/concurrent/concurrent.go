@@ -0,0 +1,56 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package concurrent
+
+import (
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ForEach calls fn for every item, running at most limit calls at once.
+// All items are processed even if some of them fail, errors of all failed calls are returned together.
+func ForEach[T any](items []T, limit int, fn func(item T) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		merr      *multierror.Error
+		semaphore = make(chan struct{}, limit)
+	)
+	for _, item := range items {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(item T) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := fn(item); err != nil {
+				mu.Lock()
+				merr = multierror.Append(merr, err)
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+
+	return merr.ErrorOrNil()
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package concurrent
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachLimitsConcurrency(t *testing.T) {
+	var running, maxRunning, calls atomic.Int32
+	err := ForEach([]int{1, 2, 3, 4, 5, 6, 7, 8}, 3, func(_ int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			observed := maxRunning.Load()
+			if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(8), calls.Load())
+	require.LessOrEqual(t, maxRunning.Load(), int32(3))
+	require.Greater(t, maxRunning.Load(), int32(1))
+}
+
+func TestForEachCollectsAllErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	var calls atomic.Int32
+	err := ForEach([]int{1, 2, 3, 4, 5}, 2, func(item int) error {
+		calls.Add(1)
+		if item%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+	require.Equal(t, int32(5), calls.Load(), "All items should be processed despite errors")
+	require.ErrorIs(t, err, errOdd)
+
+	var merr *multierror.Error
+	require.ErrorAs(t, err, &merr)
+	require.Len(t, merr.Errors, 3)
+}
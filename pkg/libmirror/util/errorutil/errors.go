@@ -16,7 +16,13 @@ limitations under the License.
 
 package errorutil
 
-import "strings"
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
 
 const CustomTrivyMediaTypesWarning = `` +
 	"It looks like you are using Project Quay registry and it is not configured correctly for hosting Deckhouse.\n" +
@@ -31,6 +37,9 @@ ALLOWED_OCI_ARTIFACT_TYPES:
     - "application/vnd.aquasec.trivy.javadb.layer.v1.tar+gzip"
     - "application/vnd.aquasec.trivy.db.layer.v1.tar+gzip"`
 
+// ErrCustomMediaTypesNotAllowed is returned if registry rejects media types of security databases artifacts.
+var ErrCustomMediaTypesNotAllowed = errors.New(CustomTrivyMediaTypesWarning)
+
 func IsImageNotFoundError(err error) bool {
 	if err == nil {
 		return false
@@ -40,6 +49,12 @@ func IsImageNotFoundError(err error) bool {
 	return strings.Contains(errMsg, "MANIFEST_UNKNOWN") || strings.Contains(errMsg, "404 Not Found")
 }
 
+// IsNotFoundError reports whether the registry responded with 404 status, whatever the error code is.
+func IsNotFoundError(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound
+}
+
 func IsRepoNotFoundError(err error) bool {
 	if err == nil {
 		return false
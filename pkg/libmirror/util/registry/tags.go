@@ -0,0 +1,39 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
+)
+
+// ListTags returns tags of the repo, missing repos have no tags.
+func ListTags(repo string, nameOpts []name.Option, remoteOpts []remote.Option) ([]string, error) {
+	repository, err := name.NewRepository(repo, nameOpts...)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := remote.List(repository, remoteOpts...)
+	if err != nil && !errorutil.IsNotFoundError(err) {
+		return nil, fmt.Errorf("list tags of %s: %w", repo, err)
+	}
+	return tags, nil
+}
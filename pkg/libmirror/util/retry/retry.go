@@ -38,6 +38,9 @@ func RunTaskWithContext(ctx context.Context, logger contexts.Logger, name string
 		if lastErr == nil {
 			return nil
 		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%q: task cancelled: %w", name, ctx.Err())
+		}
 
 		restarts += 1
 	}
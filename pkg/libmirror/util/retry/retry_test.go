@@ -95,3 +95,31 @@ func (s *eventualSuccessTask) Interval(_ uint) time.Duration {
 func (s *eventualSuccessTask) MaxRetries() uint {
 	return 4
 }
+
+func TestRunCancelledTask(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &cancellingTask{cancel: cancel}
+	require.ErrorIsf(t, RunTaskWithContext(ctx, testLogger, "TestRunCancelledTask", task), context.Canceled, "Task should be cancelled")
+	require.Equalf(t, uint(1), task.runCount, "Cancelled task should not be retried")
+}
+
+var _ Task = &cancellingTask{}
+
+type cancellingTask struct {
+	cancel   context.CancelFunc
+	runCount uint
+}
+
+func (s *cancellingTask) Do(_ context.Context, _ uint) error {
+	s.runCount += 1
+	s.cancel()
+	return errors.New("cancelled task")
+}
+
+func (s *cancellingTask) Interval(_ uint) time.Duration {
+	return time.Minute
+}
+
+func (s *cancellingTask) MaxRetries() uint {
+	return 3
+}
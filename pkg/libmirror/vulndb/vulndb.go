@@ -0,0 +1,237 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vulndb
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/errorutil"
+)
+
+// MetadataFileName is the file vulnerability databases bundle keeps the state of pulled databases in.
+const MetadataFileName = "vulndb.json"
+
+var ErrNoMetadata = errors.New("no metadata.json in the database")
+
+// Metadata is the metadata.json shipped by Trivy along with the database.
+type Metadata struct {
+	Version      int       `json:"Version"`
+	NextUpdate   time.Time `json:"NextUpdate"`
+	UpdatedAt    time.Time `json:"UpdatedAt"`
+	DownloadedAt time.Time `json:"DownloadedAt"`
+}
+
+type Freshness string
+
+const (
+	FreshnessFresh   Freshness = "fresh"
+	FreshnessStale   Freshness = "stale"
+	FreshnessUnknown Freshness = "unknown"
+	FreshnessMissing Freshness = "missing"
+)
+
+// Status describes the copy of the database in the bundle or in the registry.
+type Status struct {
+	Name       string     `json:"name"`
+	Tag        string     `json:"tag"`
+	Digest     string     `json:"digest,omitempty"`
+	Missing    bool       `json:"missing,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+	NextUpdate *time.Time `json:"nextUpdate,omitempty"`
+}
+
+// Freshness tells whether the database should have been updated by now.
+// Databases without metadata, like trivy-checks, are of unknown freshness.
+func (s *Status) Freshness(now time.Time) Freshness {
+	switch {
+	case s.Missing:
+		return FreshnessMissing
+	case s.NextUpdate == nil:
+		return FreshnessUnknown
+	case now.After(*s.NextUpdate):
+		return FreshnessStale
+	default:
+		return FreshnessFresh
+	}
+}
+
+// Age is the time passed since the database was built, zero if it is unknown.
+func (s *Status) Age(now time.Time) time.Duration {
+	if s.UpdatedAt == nil {
+		return 0
+	}
+	return now.Sub(*s.UpdatedAt)
+}
+
+// BundleMetadata is written to the vulnerability databases bundle by the pull.
+type BundleMetadata struct {
+	PulledAt  time.Time `json:"pulledAt"`
+	Databases []Status  `json:"databases"`
+}
+
+// ReadMetadata finds metadata.json in the layers of the database image.
+// ErrNoMetadata is returned if there is none.
+func ReadMetadata(img v1.Image) (*Metadata, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("get image layers: %w", err)
+	}
+
+	for _, layer := range layers {
+		metadata, err := readMetadataFromLayer(layer)
+		if errors.Is(err, ErrNoMetadata) {
+			continue
+		}
+		return metadata, err
+	}
+
+	return nil, ErrNoMetadata
+}
+
+func readMetadataFromLayer(layer v1.Layer) (*Metadata, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("read layer: %w", err)
+	}
+	defer rc.Close()
+
+	tarReader := tar.NewReader(rc)
+	for {
+		hdr, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoMetadata
+		}
+		if err != nil {
+			// Layer is not a tar archive
+			return nil, ErrNoMetadata
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Base(hdr.Name) != "metadata.json" {
+			continue
+		}
+
+		metadata := &Metadata{}
+		if err = json.NewDecoder(tarReader).Decode(metadata); err != nil {
+			return nil, fmt.Errorf("parse metadata.json: %w", err)
+		}
+		return metadata, nil
+	}
+}
+
+// StatusFromLayout describes the database pulled into the OCI layout, missing if it was not pulled.
+func StatusFromLayout(l layout.Path, db security.Artifact) (*Status, error) {
+	index, err := l.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range indexManifest.Manifests {
+		if desc.Annotations["io.deckhouse.image.short_tag"] != db.Tag {
+			continue
+		}
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("read %s:%s image: %w", db.Name, db.Tag, err)
+		}
+		return statusOf(db, img)
+	}
+
+	return &Status{Name: db.Name, Tag: db.Tag, Missing: true}, nil
+}
+
+// StatusFromRegistry describes the database pushed to <repo>/security/<name> in the registry, missing if there is no such image.
+func StatusFromRegistry(ctx context.Context, mirrorCtx *contexts.BaseContext, repo string, db security.Artifact) (*Status, error) {
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptionsFromMirrorContext(mirrorCtx)
+	imageRef := path.Join(repo, "security", db.Name) + ":" + db.Tag
+	ref, err := name.ParseReference(imageRef, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", imageRef, err)
+	}
+
+	img, err := remote.Image(ref, append(remoteOpts, remote.WithContext(ctx))...)
+	if err != nil {
+		if errorutil.IsImageNotFoundError(err) || errorutil.IsRepoNotFoundError(err) {
+			return &Status{Name: db.Name, Tag: db.Tag, Missing: true}, nil
+		}
+		return nil, fmt.Errorf("get %s: %w", imageRef, err)
+	}
+
+	return statusOf(db, img)
+}
+
+func statusOf(db security.Artifact, img v1.Image) (*Status, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("get %s:%s digest: %w", db.Name, db.Tag, err)
+	}
+
+	status := &Status{Name: db.Name, Tag: db.Tag, Digest: digest.String()}
+	metadata, err := ReadMetadata(img)
+	switch {
+	case errors.Is(err, ErrNoMetadata):
+		return status, nil
+	case err != nil:
+		return nil, fmt.Errorf("read %s:%s metadata: %w", db.Name, db.Tag, err)
+	}
+
+	status.UpdatedAt = &metadata.UpdatedAt
+	status.NextUpdate = &metadata.NextUpdate
+	return status, nil
+}
+
+// WriteBundleMetadata stores statuses of the databases pulled into the bundle at dir.
+func WriteBundleMetadata(dir string, metadata *BundleMetadata) error {
+	rawJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, MetadataFileName), rawJSON, 0o644)
+}
+
+// ReadBundleMetadata reads statuses of the databases pulled into the bundle at dir.
+// os.ErrNotExist is returned for bundles pulled by older versions of d8, which do not have it.
+func ReadBundleMetadata(dir string) (*BundleMetadata, error) {
+	rawJSON, err := os.ReadFile(filepath.Join(dir, MetadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	metadata := &BundleMetadata{}
+	if err = json.Unmarshal(rawJSON, metadata); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", MetadataFileName, err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vulndb
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/security"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
+)
+
+var (
+	updatedAt  = time.Date(2024, 10, 1, 6, 0, 0, 0, time.UTC)
+	nextUpdate = time.Date(2024, 10, 2, 6, 0, 0, 0, time.UTC)
+)
+
+func TestReadMetadata(t *testing.T) {
+	metadata, err := ReadMetadata(databaseImage(t))
+	require.NoError(t, err)
+	require.Equal(t, 2, metadata.Version)
+	require.True(t, updatedAt.Equal(metadata.UpdatedAt))
+	require.True(t, nextUpdate.Equal(metadata.NextUpdate))
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	_, err = ReadMetadata(img)
+	require.ErrorIs(t, err, ErrNoMetadata)
+}
+
+func TestStatusFreshness(t *testing.T) {
+	status := &Status{UpdatedAt: &updatedAt, NextUpdate: &nextUpdate}
+	require.Equal(t, FreshnessFresh, status.Freshness(updatedAt.Add(time.Hour)))
+	require.Equal(t, FreshnessStale, status.Freshness(nextUpdate.Add(time.Hour)))
+	require.Equal(t, 25*time.Hour, status.Age(nextUpdate.Add(time.Hour)))
+	require.Equal(t, FreshnessUnknown, (&Status{}).Freshness(updatedAt))
+	require.Equal(t, FreshnessMissing, (&Status{Missing: true}).Freshness(updatedAt))
+}
+
+func TestStatusFromLayout(t *testing.T) {
+	l, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	img := databaseImage(t)
+	require.NoError(t, l.AppendImage(img, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "registry.deckhouse.io/deckhouse/ee/security/trivy-db:2",
+		"io.deckhouse.image.short_tag":      "2",
+	})))
+
+	status, err := StatusFromLayout(l, security.Artifact{Name: "trivy-db", Tag: "2"})
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest.String(), status.Digest)
+	require.True(t, updatedAt.Equal(*status.UpdatedAt))
+
+	status, err = StatusFromLayout(l, security.Artifact{Name: "trivy-bdu", Tag: "1"})
+	require.NoError(t, err)
+	require.True(t, status.Missing)
+}
+
+func TestStatusFromRegistry(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/deckhouse/ee"
+	mirrorCtx := &contexts.BaseContext{
+		Logger:       log.NewSLogger(slog.LevelDebug),
+		RegistryAuth: authn.Anonymous,
+		Insecure:     true,
+	}
+
+	ref, err := name.ParseReference(repo+"/security/trivy-db:2", name.Insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, databaseImage(t)))
+	checksRef, err := name.ParseReference(repo+"/security/trivy-checks:0", name.Insecure)
+	require.NoError(t, err)
+	checks, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(checksRef, checks))
+
+	status, err := StatusFromRegistry(context.Background(), mirrorCtx, repo, security.Artifact{Name: "trivy-db", Tag: "2"})
+	require.NoError(t, err)
+	require.Equal(t, FreshnessStale, status.Freshness(nextUpdate.Add(time.Minute)))
+
+	status, err = StatusFromRegistry(context.Background(), mirrorCtx, repo, security.Artifact{Name: "trivy-checks", Tag: "0"})
+	require.NoError(t, err)
+	require.False(t, status.Missing)
+	require.Equal(t, FreshnessUnknown, status.Freshness(nextUpdate))
+
+	status, err = StatusFromRegistry(context.Background(), mirrorCtx, repo, security.Artifact{Name: "trivy-java-db", Tag: "1"})
+	require.NoError(t, err)
+	require.True(t, status.Missing)
+}
+
+func TestBundleMetadataRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	want := &BundleMetadata{
+		PulledAt: nextUpdate,
+		Databases: []Status{
+			{Name: "trivy-db", Tag: "2", Digest: "sha256:abc", UpdatedAt: &updatedAt, NextUpdate: &nextUpdate},
+			{Name: "trivy-bdu", Tag: "1", Missing: true},
+		},
+	}
+	require.NoError(t, WriteBundleMetadata(dir, want))
+
+	got, err := ReadBundleMetadata(dir)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+// databaseImage is built like trivy-db artifact: single layer with the database and its metadata.
+func databaseImage(t *testing.T) v1.Image {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	files := []struct{ name, contents string }{
+		{"trivy.db", "database contents"},
+		{"metadata.json", `{"Version":2,"NextUpdate":"2024-10-02T06:00:00Z","UpdatedAt":"2024-10-01T06:00:00Z","DownloadedAt":"0001-01-01T00:00:00Z"}`},
+	}
+	for _, file := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.contents)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+	return img
+}
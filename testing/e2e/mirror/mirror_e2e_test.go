@@ -40,6 +40,7 @@ import (
 
 	"github.com/deckhouse/deckhouse-cli/internal/mirror/cmd/pull"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/contexts"
+	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/extra"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/operations"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/auth"
 	"github.com/deckhouse/deckhouse-cli/pkg/libmirror/util/log"
@@ -60,6 +61,9 @@ func TestMirrorE2E(t *testing.T) {
 	createDeckhouseControllersAndInstallersInRegistry(t, sourceHost+sourceRepoPath)
 	createTrivyVulnerabilityDatabasesInRegistry(t, sourceHost+sourceRepoPath, true, false)
 	createDeckhouseReleaseChannelsInRegistry(t, sourceHost+sourceRepoPath)
+	extraImageDigest := createRandomImageInRegistry(t, sourceHost+"/monitoring/grafana:10.4.2")
+	extraImages, err := extra.Parse([]byte("images:\n  - " + sourceHost + "/monitoring/grafana:10.4.2\n"))
+	require.NoError(t, err)
 
 	testLogger := log.NewSLogger(slog.LevelDebug)
 	pullCtx := &contexts.PullContext{
@@ -70,6 +74,7 @@ func TestMirrorE2E(t *testing.T) {
 			DeckhouseRegistryRepo: sourceHost + sourceRepoPath,
 			UnpackedImagesPath:    workingDir,
 		},
+		ExtraImages: extraImages,
 	}
 	pushCtx := &contexts.PushContext{
 		BaseContext: contexts.BaseContext{
@@ -100,6 +105,13 @@ func TestMirrorE2E(t *testing.T) {
 	require.NoError(t, err, "Push should be completed without errors")
 
 	require.Subset(t, sourceBlobHandler.ListBlobs(), targetBlobHandler.ListBlobs())
+
+	nameOpts, remoteOpts := auth.MakeRemoteRegistryRequestOptions(nil, true, false)
+	extraImageRef, err := name.ParseReference(targetHost+targetRepoPath+"/extra/monitoring/grafana:10.4.2", nameOpts...)
+	require.NoError(t, err)
+	desc, err := remote.Head(extraImageRef, remoteOpts...)
+	require.NoError(t, err, "Extra image should be pushed under the extra repo")
+	require.Equal(t, extraImageDigest, desc.Digest.String())
 }
 
 func createDeckhouseReleaseChannelsInRegistry(t *testing.T, repo string) {